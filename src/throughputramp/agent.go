@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"throughputramp/agent"
+	"throughputramp/loadgen"
+)
+
+// runAgent implements the agent subcommand, which runs steps on behalf of a
+// coordinator until it is stopped. It returns 2 on errors, including a
+// missing token: an agent sends load to any URL it is asked to.
+func runAgent(args []string) int {
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	listen := flags.String("listen", ":8090", "Address the control API listens on")
+	token := flags.String("token", "", "Bearer token the coordinator has to send. Required, can also be set with THROUGHPUTRAMP_AGENT_TOKEN")
+	tlsCert := flags.String("tls-cert", "", "PEM file with the certificate to serve the control API over https with")
+	tlsKey := flags.String("tls-key", "", "PEM file with the key of the certificate")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: throughputramp agent [flags]\n\n"+
+			"Runs shares of the steps of a coordinator started with -agents.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	if *token == "" {
+		*token = os.Getenv("THROUGHPUTRAMP_AGENT_TOKEN")
+	}
+	if *token == "" {
+		fmt.Fprintf(os.Stderr, "A token is required, set -token or THROUGHPUTRAMP_AGENT_TOKEN\n")
+		flags.Usage()
+		return 2
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintf(os.Stderr, "-tls-cert and -tls-key have to be set together\n")
+		flags.Usage()
+		return 2
+	}
+
+	server := &agent.Server{
+		Version:      version,
+		HeyVersion:   loadgen.HeyVersion(),
+		Token:        *token,
+		NewGenerator: newGenerator,
+	}
+	fmt.Fprintf(os.Stdout, "agent listening on %s\n", *listen)
+	var err error
+	if *tlsCert != "" {
+		err = http.ListenAndServeTLS(*listen, *tlsCert, *tlsKey, server)
+	} else {
+		err = http.ListenAndServe(*listen, server)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+	return 0
+}
+
+// agentURLs parses the -agents flag. Agents without a scheme use http.
+func agentURLs(list string) []string {
+	var urls []string
+	for _, a := range strings.Split(list, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if !strings.Contains(a, "://") {
+			a = "http://" + a
+		}
+		urls = append(urls, a)
+	}
+	return urls
+}
+
+// agentClient returns the client the agents are reached with, which
+// verifies agents served over https with the CA certificates in the PEM file
+// at caPath. It returns nil, for http.DefaultClient, when caPath is empty.
+func agentClient(caPath string) (*http.Client, error) {
+	if caPath == "" {
+		return nil, nil
+	}
+	ca, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", caPath)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}, nil
+}
+
+// allHTTPS reports whether every agent is reached over https.
+func allHTTPS(urls []string) bool {
+	for _, u := range urls {
+		if !strings.HasPrefix(u, "https://") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,288 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"throughputramp/loadgen"
+)
+
+// DefaultStartDelay is the time the agents are given to receive a step
+// before it starts.
+const DefaultStartDelay = time.Second
+
+// DefaultTimeout is the time agents are given to respond, beyond the length
+// of a step, when Generator.Timeout is 0.
+const DefaultTimeout = 30 * time.Second
+
+// Generator runs every step on a set of agents, given by the base URLs of
+// their control APIs. The load of a step is split evenly across the agents:
+// each sends its share of the requests, the concurrency and, for open-loop
+// steps, the rate. All agents start at the same time and their results are
+// merged into one.
+//
+// Agents are given Timeout to respond, DefaultTimeout if it is 0, in addition
+// to the longest a step can take.
+type Generator struct {
+	Agents     []string
+	Generator  string
+	Config     loadgen.Config
+	Token      string
+	StartDelay time.Duration
+	Timeout    time.Duration
+	Client     *http.Client
+}
+
+// Check asks every agent for its version and returns an error naming the
+// first agent that cannot be reached.
+func (g *Generator) Check(ctx context.Context) ([]Info, error) {
+	var infos []Info
+	for _, agent := range g.Agents {
+		var info Info
+		if err := g.do(ctx, agent, time.Now().Add(g.timeout()), http.MethodGet, "/info", nil, &info); err != nil {
+			return nil, fmt.Errorf("agent %s: %s", Name(agent), err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (g *Generator) Run(ctx context.Context, step loadgen.Step) (loadgen.Result, error) {
+	startDelay := g.StartDelay
+	if startDelay == 0 {
+		startDelay = DefaultStartDelay
+	}
+	startAt := time.Now().Add(startDelay)
+
+	shares := Split(step, len(g.Agents))
+	results := make([]loadgen.Result, len(g.Agents))
+	errs := make([]error, len(g.Agents))
+	var wg sync.WaitGroup
+	for i, agent := range g.Agents {
+		if shares[i].Concurrency == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, agent string) {
+			defer wg.Done()
+			results[i], errs[i] = g.runShare(ctx, agent, shares[i], startAt)
+		}(i, agent)
+	}
+	wg.Wait()
+
+	var ran []loadgen.Result
+	for i, agent := range g.Agents {
+		if errs[i] != nil {
+			return loadgen.Result{}, fmt.Errorf("agent %s: %s", Name(agent), errs[i])
+		}
+		if shares[i].Concurrency != 0 {
+			ran = append(ran, results[i])
+		}
+	}
+	return Merge(step, ran)
+}
+
+func (g *Generator) runShare(ctx context.Context, agent string, step loadgen.Step, startAt time.Time) (loadgen.Result, error) {
+	req := StepRequest{
+		Generator: g.Generator,
+		Config:    g.Config,
+		Step:      step,
+		StartAt:   startAt,
+	}
+	var resp StepResponse
+	if err := g.do(ctx, agent, g.deadline(step, startAt), http.MethodPost, "/step", req, &resp); err != nil {
+		return loadgen.Result{}, err
+	}
+	if resp.Error != "" {
+		return loadgen.Result{}, fmt.Errorf("step failed: %s", resp.Error)
+	}
+	return resp.Result(Name(agent), step)
+}
+
+// deadline returns the time by which an agent has to respond to step
+// starting at startAt: Timeout after the end of its warm-up and duration or,
+// for steps bounded by their number of requests, of the time they take when
+// every request times out. Steps of requests without a timeout have no
+// deadline.
+func (g *Generator) deadline(step loadgen.Step, startAt time.Time) time.Time {
+	length := step.Warmup + step.Duration
+	if g.Config.Timeout > 0 {
+		// Requests in flight when the warm-up and the step end complete.
+		length += 2 * g.Config.Timeout
+	}
+	if step.Duration == 0 {
+		if g.Config.Timeout == 0 {
+			return time.Time{}
+		}
+		perRequest := g.Config.Timeout
+		if step.RateLimit > 0 {
+			perRequest += time.Second / time.Duration(step.RateLimit)
+		}
+		perWorker := (step.NumRequests + step.Concurrency - 1) / step.Concurrency
+		length += time.Duration(perWorker) * perRequest
+		if step.Rate > 0 {
+			length += time.Duration(step.NumRequests) * time.Second / time.Duration(step.Rate)
+		}
+	}
+	return startAt.Add(length + g.timeout())
+}
+
+func (g *Generator) timeout() time.Duration {
+	if g.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return g.Timeout
+}
+
+// do sends a request to agent and decodes its response into v. It is
+// cancelled at deadline, unless that is zero.
+func (g *Generator) do(ctx context.Context, agent string, deadline time.Time, method, path string, body, v interface{}) error {
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(agent, "/")+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return json.Unmarshal(respBody, v)
+}
+
+// Name returns the name results of the agent at the given URL are
+// attributed to, its host and port.
+func Name(agent string) string {
+	u, err := url.Parse(agent)
+	if err != nil || u.Host == "" {
+		return agent
+	}
+	return u.Host
+}
+
+// Split divides the load of step into n shares. Shares without any load
+// have a concurrency of 0 and are not run.
+func Split(step loadgen.Step, n int) []loadgen.Step {
+	shares := make([]loadgen.Step, n)
+	for i := range shares {
+		share := step
+		share.NumRequests = part(step.NumRequests, n, i)
+		if step.Rate > 0 {
+			share.Rate = part(step.Rate, n, i)
+			share.Concurrency = part(step.Concurrency, n, i)
+			if share.Concurrency == 0 {
+				share.Concurrency = 1
+			}
+			if share.Rate == 0 {
+				share.Concurrency = 0
+			}
+		} else {
+			share.Concurrency = part(step.Concurrency, n, i)
+		}
+		if step.NumRequests > 0 && share.NumRequests == 0 {
+			share.Concurrency = 0
+		}
+		shares[i] = share
+	}
+	return shares
+}
+
+// part returns the i-th of n even parts of total. The remainder goes to the
+// first parts.
+func part(total, n, i int) int {
+	p := total / n
+	if i < total%n {
+		p++
+	}
+	return p
+}
+
+// Merge combines the results of the agents that ran a share of step. The
+// measured window of the merged result spans the windows of all agents and
+// Agents keeps their individual results.
+func Merge(step loadgen.Step, results []loadgen.Result) (loadgen.Result, error) {
+	if len(results) == 0 {
+		return loadgen.Result{}, fmt.Errorf("no agent ran the step")
+	}
+	start, end := results[0].Start, results[0].End
+	for _, r := range results[1:] {
+		if r.Start.Before(start) {
+			start = r.Start
+		}
+		if r.End.After(end) {
+			end = r.End
+		}
+	}
+
+	merged := loadgen.NewResult(step, start)
+	merged.End = end
+	for _, r := range results {
+		merged.Requests += r.Requests
+		merged.Errors += r.Errors
+		merged.ConnectErrors += r.ConnectErrors
+		merged.NonSuccess += r.NonSuccess
+		merged.TLSHandshakes += r.TLSHandshakes
+		merged.TLSResumed += r.TLSResumed
+		merged.TLSHandshakeTime += r.TLSHandshakeTime
+		merged.ConnectionsOpened += r.ConnectionsOpened
+		merged.ConnectionsClosed += r.ConnectionsClosed
+		merged.Upgrades += r.Upgrades
+		merged.UpgradeTime += r.UpgradeTime
+		merged.Drops += r.Drops
+		if err := merged.Latency.Merge(r.Latency); err != nil {
+			return loadgen.Result{}, err
+		}
+		offset := int(r.Start.Sub(start) / time.Second)
+		for i, count := range r.Completed {
+			for len(merged.Completed) <= offset+i {
+				merged.Completed = append(merged.Completed, 0)
+			}
+			merged.Completed[offset+i] += count
+		}
+		for protocol, count := range r.Protocols {
+			if merged.Protocols == nil {
+				merged.Protocols = make(map[string]int)
+			}
+			merged.Protocols[protocol] += count
+		}
+		merged.Samples = append(merged.Samples, r.Samples...)
+	}
+	merged.Agents = results
+	return merged, nil
+}
@@ -0,0 +1,230 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"throughputramp/agent"
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeGenerator completes one request per worker and remembers the steps it
+// was asked to run and when. With hang set it runs until it is cancelled.
+type fakeGenerator struct {
+	mu     sync.Mutex
+	config loadgen.Config
+	steps  []loadgen.Step
+	starts []time.Time
+	err    error
+	hang   bool
+}
+
+func (g *fakeGenerator) Run(ctx context.Context, step loadgen.Step) (loadgen.Result, error) {
+	g.mu.Lock()
+	g.steps = append(g.steps, step)
+	g.starts = append(g.starts, time.Now())
+	g.mu.Unlock()
+	if g.err != nil {
+		return loadgen.Result{}, g.err
+	}
+	if g.hang {
+		<-ctx.Done()
+		return loadgen.Result{}, ctx.Err()
+	}
+	result := loadgen.NewResult(step, time.Now())
+	for i := 0; i < step.Concurrency; i++ {
+		result.Record(loadgen.Sample{Start: result.Start, ResponseTime: time.Millisecond, StatusCode: 200})
+	}
+	result.End = result.Start.Add(time.Second)
+	return result, nil
+}
+
+var _ = Describe("Split", func() {
+	It("divides requests and concurrency evenly", func() {
+		shares := agent.Split(loadgen.Step{NumRequests: 1000, Concurrency: 5, RateLimit: 10}, 2)
+		Expect(shares).To(Equal([]loadgen.Step{
+			{NumRequests: 500, Concurrency: 3, RateLimit: 10},
+			{NumRequests: 500, Concurrency: 2, RateLimit: 10},
+		}))
+	})
+
+	It("divides the rate of open-loop steps and keeps a worker for every share", func() {
+		shares := agent.Split(loadgen.Step{Rate: 1001, Concurrency: 2, Duration: time.Minute}, 3)
+		Expect(shares).To(Equal([]loadgen.Step{
+			{Rate: 334, Concurrency: 1, Duration: time.Minute},
+			{Rate: 334, Concurrency: 1, Duration: time.Minute},
+			{Rate: 333, Concurrency: 1, Duration: time.Minute},
+		}))
+	})
+
+	It("leaves agents idle when there is not enough load", func() {
+		shares := agent.Split(loadgen.Step{Concurrency: 1, Duration: time.Minute}, 2)
+		Expect(shares[0].Concurrency).To(Equal(1))
+		Expect(shares[1].Concurrency).To(BeZero())
+	})
+})
+
+var _ = Describe("Merge", func() {
+	It("sums the counts and aligns the throughput of every agent", func() {
+		start := time.Date(2016, 12, 15, 23, 0, 0, 0, time.UTC)
+		a := loadgen.NewResult(loadgen.Step{Concurrency: 1}, start)
+		a.End = start.Add(2 * time.Second)
+		a.Completed = []int{5, 5}
+		a.Requests = 10
+		a.Latency.RecordN(1000, 10)
+		a.Protocols = map[string]int{"HTTP/2.0": 10}
+		a.Upgrades, a.Drops = 1, 1
+		b := loadgen.NewResult(loadgen.Step{Concurrency: 1}, start.Add(time.Second))
+		b.End = start.Add(3 * time.Second)
+		b.Completed = []int{7, 7}
+		b.Requests = 15
+		b.Errors = 1
+		b.Latency.RecordN(3000, 14)
+		b.Protocols = map[string]int{"HTTP/2.0": 12, "HTTP/1.1": 2}
+		b.Upgrades = 2
+
+		merged, err := agent.Merge(loadgen.Step{Concurrency: 2}, []loadgen.Result{a, b})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged.Step).To(Equal(loadgen.Step{Concurrency: 2}))
+		Expect(merged.Start).To(Equal(start))
+		Expect(merged.End).To(Equal(start.Add(3 * time.Second)))
+		Expect(merged.Requests).To(Equal(25))
+		Expect(merged.Errors).To(Equal(1))
+		Expect(merged.Latency.TotalCount()).To(Equal(int64(24)))
+		Expect(merged.Completed).To(Equal([]int{5, 12, 7}))
+		Expect(merged.Protocols).To(Equal(map[string]int{"HTTP/2.0": 22, "HTTP/1.1": 2}))
+		Expect(merged.Upgrades).To(Equal(3))
+		Expect(merged.Drops).To(Equal(1))
+		Expect(merged.Agents).To(HaveLen(2))
+	})
+
+	It("needs a result", func() {
+		_, err := agent.Merge(loadgen.Step{}, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Generator", func() {
+	var (
+		generators []*fakeGenerator
+		servers    []*httptest.Server
+		g          *agent.Generator
+	)
+
+	BeforeEach(func() {
+		generators = nil
+		servers = nil
+		g = &agent.Generator{
+			Generator:  "native",
+			Config:     loadgen.Config{URL: "http://router.example.com", Host: "app.example.com"},
+			Token:      "secret",
+			StartDelay: 200 * time.Millisecond,
+		}
+		for i := 0; i < 2; i++ {
+			fake := &fakeGenerator{}
+			generators = append(generators, fake)
+			server := httptest.NewServer(&agent.Server{
+				Version:    "1.2.3",
+				HeyVersion: "v0.1.4",
+				Token:      "secret",
+				NewGenerator: func(name string, config loadgen.Config) (loadgen.Generator, error) {
+					if name != "native" {
+						return nil, errors.New("unknown generator")
+					}
+					fake.config = config
+					return fake, nil
+				},
+			})
+			servers = append(servers, server)
+			g.Agents = append(g.Agents, server.URL)
+		}
+	})
+
+	AfterEach(func() {
+		for _, s := range servers {
+			s.Close()
+		}
+	})
+
+	It("checks that every agent is reachable", func() {
+		infos, err := g.Check(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(Equal([]agent.Info{{Version: "1.2.3", HeyVersion: "v0.1.4"}, {Version: "1.2.3", HeyVersion: "v0.1.4"}}))
+
+		servers[1].Close()
+		_, err = g.Check(context.Background())
+		Expect(err).To(MatchError(HavePrefix("agent " + agent.Name(servers[1].URL) + ":")))
+	})
+
+	It("rejects requests without the token", func() {
+		g.Token = "wrong"
+		_, err := g.Check(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("401 Unauthorized")))
+	})
+
+	It("runs a share of the step on every agent at the same time and merges the results", func() {
+		before := time.Now()
+		result, err := g.Run(context.Background(), loadgen.Step{Concurrency: 3, Duration: time.Second})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(generators[0].config).To(Equal(g.Config))
+		Expect(generators[0].steps).To(Equal([]loadgen.Step{{Concurrency: 2, Duration: time.Second}}))
+		Expect(generators[1].steps).To(Equal([]loadgen.Step{{Concurrency: 1, Duration: time.Second}}))
+		Expect(generators[0].starts[0]).To(BeTemporally(">=", before.Add(200*time.Millisecond)))
+		Expect(generators[0].starts[0]).To(BeTemporally("~", generators[1].starts[0], 50*time.Millisecond))
+
+		Expect(result.Requests).To(Equal(3))
+		Expect(result.Step.Concurrency).To(Equal(3))
+		Expect(result.Agents).To(HaveLen(2))
+		Expect(result.Agents[0].Agent).To(Equal(agent.Name(servers[0].URL)))
+		Expect(result.Agents[1].Requests).To(Equal(1))
+	})
+
+	It("skips agents without a share", func() {
+		result, err := g.Run(context.Background(), loadgen.Step{Concurrency: 1, Duration: time.Second})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(generators[1].steps).To(BeEmpty())
+		Expect(result.Agents).To(HaveLen(1))
+	})
+
+	It("fails the step when an agent fails", func() {
+		generators[1].err = errors.New("hey error")
+		_, err := g.Run(context.Background(), loadgen.Step{Concurrency: 2, Duration: time.Second})
+		Expect(err).To(MatchError("agent " + agent.Name(servers[1].URL) + ": step failed: hey error"))
+	})
+
+	It("gives up on agents that do not respond in time", func() {
+		hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			<-req.Context().Done()
+		}))
+		defer hung.Close()
+		g.Agents = append(g.Agents, hung.URL)
+		g.Timeout = 100 * time.Millisecond
+		_, err := g.Check(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+	})
+
+	It("gives up on steps that take longer than they can", func() {
+		generators[1].hang = true
+		g.Timeout = 100 * time.Millisecond
+		g.Config.Timeout = 100 * time.Millisecond
+		before := time.Now()
+		_, err := g.Run(context.Background(), loadgen.Step{NumRequests: 2, Concurrency: 2})
+		Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+		// The start delay, two request timeouts, one request and the timeout.
+		Expect(time.Since(before)).To(BeNumerically("~", 600*time.Millisecond, 300*time.Millisecond))
+	})
+
+	It("reports unknown generators", func() {
+		g.Generator = "wrk"
+		_, err := g.Run(context.Background(), loadgen.Step{Concurrency: 2, Duration: time.Second})
+		Expect(err).To(MatchError(ContainSubstring("400 Bad Request: unknown generator")))
+	})
+})
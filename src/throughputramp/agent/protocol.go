@@ -0,0 +1,183 @@
+// Package agent distributes the steps of a throughputramp run across load
+// agents: other throughputramp processes that each send a share of the load
+// of every step and report their results back to the coordinator, which
+// merges them into one dataset.
+//
+// The control API is JSON over HTTP. GET /info returns the agent's version,
+// POST /step runs a share of a step starting at a given time and responds
+// with its result once the share is done.
+package agent
+
+import (
+	"time"
+
+	"throughputramp/histogram"
+	"throughputramp/loadgen"
+)
+
+// Info describes an agent. HeyVersion is empty when the agent has no hey
+// binary with a version.
+type Info struct {
+	Version    string `json:"version"`
+	HeyVersion string `json:"hey_version,omitempty"`
+}
+
+// StepRequest asks an agent to run Step against the router of Config with
+// the named generator. The agent waits until StartAt before it starts,
+// including any warm-up, so the clocks of all agents need to be in sync.
+type StepRequest struct {
+	Generator string         `json:"generator"`
+	Config    loadgen.Config `json:"config"`
+	Step      loadgen.Step   `json:"step"`
+	StartAt   time.Time      `json:"start_at"`
+}
+
+// StepResponse is the result of a step as returned by an agent. Latency is
+// the encoded latency histogram. Error is set when the step failed.
+type StepResponse struct {
+	Start             time.Time      `json:"start"`
+	End               time.Time      `json:"end"`
+	Requests          int            `json:"requests"`
+	Errors            int            `json:"errors"`
+	ConnectErrors     int            `json:"connect_errors"`
+	NonSuccess        int            `json:"non_2xx"`
+	Latency           []byte         `json:"latency"`
+	Completed         []int          `json:"completed"`
+	Protocols         map[string]int `json:"protocols,omitempty"`
+	TLSHandshakes     int            `json:"tls_handshakes,omitempty"`
+	TLSResumed        int            `json:"tls_resumed,omitempty"`
+	TLSHandshakeTime  time.Duration  `json:"tls_handshake_time,omitempty"`
+	ConnectionsOpened int            `json:"connections_opened"`
+	ConnectionsClosed int            `json:"connections_closed"`
+	Upgrades          int            `json:"upgrades,omitempty"`
+	UpgradeTime       time.Duration  `json:"upgrade_time,omitempty"`
+	Drops             int            `json:"drops,omitempty"`
+	Samples           []Sample       `json:"samples,omitempty"`
+	Error             string         `json:"error,omitempty"`
+}
+
+// Sample is a loadgen.Sample with its error reduced to its class and
+// message.
+type Sample struct {
+	Start         time.Time     `json:"start"`
+	ResponseTime  time.Duration `json:"response_time"`
+	ScheduleDelay time.Duration `json:"schedule_delay"`
+	StatusCode    int           `json:"status_code"`
+	Host          string        `json:"host,omitempty"`
+	Protocol      string        `json:"protocol,omitempty"`
+	ErrorClass    string        `json:"error_class,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	ConnReused    bool          `json:"conn_reused"`
+	DNS           time.Duration `json:"dns"`
+	Connect       time.Duration `json:"connect"`
+	RequestWrite  time.Duration `json:"request_write"`
+	ResponseDelay time.Duration `json:"response_delay"`
+	ResponseRead  time.Duration `json:"response_read"`
+	TLSHandshake  time.Duration `json:"tls_handshake,omitempty"`
+	TLSResumed    bool          `json:"tls_resumed,omitempty"`
+}
+
+// NewStepResponse converts the result of a step for the wire.
+func NewStepResponse(result loadgen.Result) (StepResponse, error) {
+	latency, err := result.Latency.Encode()
+	if err != nil {
+		return StepResponse{}, err
+	}
+	resp := StepResponse{
+		Start:             result.Start,
+		End:               result.End,
+		Requests:          result.Requests,
+		Errors:            result.Errors,
+		ConnectErrors:     result.ConnectErrors,
+		NonSuccess:        result.NonSuccess,
+		Latency:           latency,
+		Completed:         result.Completed,
+		Protocols:         result.Protocols,
+		TLSHandshakes:     result.TLSHandshakes,
+		TLSResumed:        result.TLSResumed,
+		TLSHandshakeTime:  result.TLSHandshakeTime,
+		ConnectionsOpened: result.ConnectionsOpened,
+		ConnectionsClosed: result.ConnectionsClosed,
+		Upgrades:          result.Upgrades,
+		UpgradeTime:       result.UpgradeTime,
+		Drops:             result.Drops,
+	}
+	for _, s := range result.Samples {
+		sample := Sample{
+			Start:         s.Start,
+			ResponseTime:  s.ResponseTime,
+			ScheduleDelay: s.ScheduleDelay,
+			StatusCode:    s.StatusCode,
+			Host:          s.Host,
+			Protocol:      s.Protocol,
+			ErrorClass:    loadgen.ErrorClass(s.Err),
+			ConnReused:    s.ConnReused,
+			DNS:           s.DNS,
+			Connect:       s.Connect,
+			RequestWrite:  s.RequestWrite,
+			ResponseDelay: s.ResponseDelay,
+			ResponseRead:  s.ResponseRead,
+			TLSHandshake:  s.TLSHandshake,
+			TLSResumed:    s.TLSResumed,
+		}
+		if s.Err != nil {
+			sample.Error = s.Err.Error()
+		}
+		resp.Samples = append(resp.Samples, sample)
+	}
+	return resp, nil
+}
+
+// Result converts the response of the named agent back into the result of
+// step.
+func (r StepResponse) Result(agent string, step loadgen.Step) (loadgen.Result, error) {
+	latency, err := histogram.Decode(r.Latency)
+	if err != nil {
+		return loadgen.Result{}, err
+	}
+	result := loadgen.Result{
+		Step:              step,
+		Start:             r.Start,
+		End:               r.End,
+		Requests:          r.Requests,
+		Errors:            r.Errors,
+		ConnectErrors:     r.ConnectErrors,
+		NonSuccess:        r.NonSuccess,
+		Latency:           latency,
+		Completed:         r.Completed,
+		Protocols:         r.Protocols,
+		TLSHandshakes:     r.TLSHandshakes,
+		TLSResumed:        r.TLSResumed,
+		TLSHandshakeTime:  r.TLSHandshakeTime,
+		ConnectionsOpened: r.ConnectionsOpened,
+		ConnectionsClosed: r.ConnectionsClosed,
+		Upgrades:          r.Upgrades,
+		UpgradeTime:       r.UpgradeTime,
+		Drops:             r.Drops,
+		Agent:             agent,
+	}
+	for _, s := range r.Samples {
+		sample := loadgen.Sample{
+			Start:         s.Start,
+			ResponseTime:  s.ResponseTime,
+			ScheduleDelay: s.ScheduleDelay,
+			StatusCode:    s.StatusCode,
+			Host:          s.Host,
+			Protocol:      s.Protocol,
+			ConnReused:    s.ConnReused,
+			DNS:           s.DNS,
+			Connect:       s.Connect,
+			RequestWrite:  s.RequestWrite,
+			ResponseDelay: s.ResponseDelay,
+			ResponseRead:  s.ResponseRead,
+			TLSHandshake:  s.TLSHandshake,
+			TLSResumed:    s.TLSResumed,
+			Agent:         agent,
+		}
+		if s.ErrorClass != "" {
+			sample.Err = &loadgen.RemoteError{Class: s.ErrorClass, Message: s.Error}
+		}
+		result.Samples = append(result.Samples, sample)
+	}
+	return result, nil
+}
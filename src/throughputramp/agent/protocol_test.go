@@ -0,0 +1,68 @@
+package agent_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+
+	"throughputramp/agent"
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StepResponse", func() {
+	It("carries a result and its samples across the wire", func() {
+		start := time.Date(2016, 12, 15, 23, 0, 0, 0, time.UTC)
+		step := loadgen.Step{Concurrency: 2, NumRequests: 2}
+		result := loadgen.NewResult(step, start)
+		result.End = start.Add(time.Second)
+		samples := []loadgen.Sample{
+			{Start: start, ResponseTime: 2 * time.Millisecond, StatusCode: 200, Protocol: "HTTP/2.0", ConnReused: true, TLSHandshake: time.Millisecond, TLSResumed: true, ResponseDelay: time.Millisecond},
+			{Start: start, ResponseTime: time.Second, Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}},
+		}
+		for _, s := range samples {
+			result.Record(s)
+		}
+		result.Samples = samples
+		result.Upgrades, result.UpgradeTime, result.Drops = 2, 3*time.Millisecond, 1
+
+		resp, err := agent.NewStepResponse(result)
+		Expect(err).NotTo(HaveOccurred())
+		b, err := json.Marshal(resp)
+		Expect(err).NotTo(HaveOccurred())
+		var decoded agent.StepResponse
+		Expect(json.Unmarshal(b, &decoded)).To(Succeed())
+
+		got, err := decoded.Result("10.0.0.7:8090", step)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Agent).To(Equal("10.0.0.7:8090"))
+		Expect(got.Step).To(Equal(step))
+		Expect(got.Start.Equal(start)).To(BeTrue())
+		Expect(got.Requests).To(Equal(2))
+		Expect(got.ConnectErrors).To(Equal(1))
+		Expect(got.Completed).To(Equal([]int{1}))
+		Expect(got.Protocols).To(Equal(map[string]int{"HTTP/2.0": 1}))
+		Expect(got.TLSHandshakes).To(Equal(1))
+		Expect(got.TLSResumed).To(Equal(1))
+		Expect(got.TLSHandshakeTime).To(Equal(time.Millisecond))
+		Expect(got.Upgrades).To(Equal(2))
+		Expect(got.UpgradeTime).To(Equal(3 * time.Millisecond))
+		Expect(got.Drops).To(Equal(1))
+		Expect(got.Latency.TotalCount()).To(Equal(int64(1)))
+		Expect(got.Latency.Max()).To(Equal(result.Latency.Max()))
+
+		Expect(got.Samples).To(HaveLen(2))
+		Expect(got.Samples[0].Agent).To(Equal("10.0.0.7:8090"))
+		Expect(got.Samples[0].ResponseDelay).To(Equal(time.Millisecond))
+		Expect(got.Samples[0].ConnReused).To(BeTrue())
+		Expect(got.Samples[0].Protocol).To(Equal("HTTP/2.0"))
+		Expect(got.Samples[0].TLSHandshake).To(Equal(time.Millisecond))
+		Expect(got.Samples[0].TLSResumed).To(BeTrue())
+		Expect(got.Samples[0].Err).To(BeNil())
+		Expect(loadgen.ErrorClass(got.Samples[1].Err)).To(Equal(loadgen.ErrorClassConnect))
+		Expect(got.Samples[1].Err).To(MatchError("dial: connection refused"))
+	})
+})
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"throughputramp/loadgen"
+)
+
+// Server is the control API of an agent. It runs one step at a time. When
+// Token is set every request has to carry it as a bearer token.
+type Server struct {
+	Version      string
+	HeyVersion   string
+	Token        string
+	NewGenerator func(name string, config loadgen.Config) (loadgen.Generator, error)
+
+	mu   sync.Mutex
+	busy bool
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if s.Token != "" && subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+s.Token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case req.URL.Path == "/info" && req.Method == http.MethodGet:
+		writeJSON(w, Info{Version: s.Version, HeyVersion: s.HeyVersion})
+	case req.URL.Path == "/step" && req.Method == http.MethodPost:
+		s.runStep(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (s *Server) runStep(w http.ResponseWriter, req *http.Request) {
+	var stepReq StepRequest
+	if err := json.NewDecoder(req.Body).Decode(&stepReq); err != nil {
+		http.Error(w, fmt.Sprintf("parsing step request: %s", err), http.StatusBadRequest)
+		return
+	}
+	generator, err := s.NewGenerator(stepReq.Generator, stepReq.Config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.acquire() {
+		http.Error(w, "agent is running another step", http.StatusConflict)
+		return
+	}
+	defer s.release()
+
+	ctx := req.Context()
+	select {
+	case <-time.After(time.Until(stepReq.StartAt)):
+	case <-ctx.Done():
+		return
+	}
+
+	result, err := generator.Run(ctx, stepReq.Step)
+	if err != nil {
+		writeJSON(w, StepResponse{Error: err.Error()})
+		return
+	}
+	resp, err := NewStepResponse(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy {
+		return false
+	}
+	s.busy = true
+	return true
+}
+
+func (s *Server) release() {
+	s.mu.Lock()
+	s.busy = false
+	s.mu.Unlock()
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,63 @@
+package agent_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"throughputramp/agent"
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		server = httptest.NewServer(&agent.Server{
+			NewGenerator: func(string, loadgen.Config) (loadgen.Generator, error) {
+				return &fakeGenerator{}, nil
+			},
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	postStep := func(startAt time.Time) *http.Response {
+		body, err := json.Marshal(agent.StepRequest{Step: loadgen.Step{Concurrency: 1}, StartAt: startAt})
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := http.Post(server.URL+"/step", "application/json", bytes.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		return resp
+	}
+
+	It("runs one step at a time", func() {
+		done := make(chan *http.Response)
+		go func() {
+			defer GinkgoRecover()
+			done <- postStep(time.Now().Add(500 * time.Millisecond))
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		Expect(postStep(time.Now()).StatusCode).To(Equal(http.StatusConflict))
+		Eventually(done).Should(Receive(WithTransform(func(r *http.Response) int { return r.StatusCode }, Equal(http.StatusOK))))
+		Expect(postStep(time.Now()).StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("rejects malformed requests and unknown paths", func() {
+		resp, err := http.Post(server.URL+"/step", "application/json", bytes.NewBufferString("{"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+		resp, err = http.Get(server.URL + "/steps")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,242 @@
+package main_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"throughputramp/analysis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/ginkgomon"
+)
+
+var _ = Describe("Agents", func() {
+	var (
+		testServer     *ghttp.Server
+		agentProcesses []ifrit.Process
+		agentAddrs     []string
+		dir            string
+	)
+
+	freeAddr := func() string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		return l.Addr().String()
+	}
+
+	BeforeEach(func() {
+		testServer = ghttp.NewServer()
+		testServer.AllowUnhandledRequests = true
+
+		agentProcesses = nil
+		agentAddrs = nil
+		for i := 0; i < 2; i++ {
+			addr := freeAddr()
+			agentAddrs = append(agentAddrs, addr)
+			agentProcesses = append(agentProcesses, ginkgomon.Invoke(ginkgomon.New(ginkgomon.Config{
+				Name:       fmt.Sprintf("agent-%d", i),
+				Command:    exec.Command(binPath, "agent", "-listen", addr, "-token", "secret"),
+				StartCheck: "agent listening",
+			})))
+		}
+
+		var err error
+		dir, err = ioutil.TempDir("", "agents")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		for _, p := range agentProcesses {
+			ginkgomon.Interrupt(p)
+		}
+		testServer.Close()
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	runCoordinator := func(args ...string) *ginkgomon.Runner {
+		runner := ginkgomon.New(ginkgomon.Config{
+			Name:    "throughputramp-coordinator",
+			Command: exec.Command(binPath, args...),
+		})
+		process := ifrit.Background(runner)
+		Eventually(process.Wait(), "10s").Should(Receive())
+		return runner
+	}
+
+	It("splits every step across the agents and attributes the results", func() {
+		runner := runCoordinator(
+			"-agents", strings.Join(agentAddrs, ","),
+			"-agent-token", "secret",
+			"-agent-start-delay", "100ms",
+			"-n", "20", "-lower-concurrency", "2", "-upper-concurrency", "4", "-concurrency-step", "2",
+			"-samples", "-local-csv", dir,
+			testServer.URL(),
+		)
+		Expect(runner.ExitCode()).To(Equal(0))
+		Expect(testServer.ReceivedRequests()).To(HaveLen(40))
+
+		agentsCSV, err := ioutil.ReadFile(filepath.Join(dir, "agents.csv"))
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(strings.TrimSpace(string(agentsCSV)), "\n")
+		Expect(lines).To(HaveLen(5))
+		Expect(lines[0]).To(HavePrefix("step,agent,start-time"))
+		Expect(lines[1]).To(HavePrefix("1," + agentAddrs[0] + ","))
+		Expect(lines[2]).To(HavePrefix("1," + agentAddrs[1] + ","))
+		Expect(lines[3]).To(MatchRegexp(`^2,` + agentAddrs[0] + `,[^,]+,[^,]+,2,0,0,[^,]+,10,`))
+
+		samples, err := ioutil.ReadFile(filepath.Join(dir, "perfResults.csv"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(string(samples), ","+agentAddrs[1]+",HTTP/1.1,0.000000,false,")).To(Equal(20))
+
+		summaryJSON, err := ioutil.ReadFile(filepath.Join(dir, "summary.json"))
+		Expect(err).NotTo(HaveOccurred())
+		var summary analysis.Summary
+		Expect(json.Unmarshal(summaryJSON, &summary)).To(Succeed())
+		Expect(summary.Steps[1].Requests).To(Equal(20))
+		Expect(summary.Steps[1].Concurrency).To(Equal(4))
+		Expect(summary.Steps[1].Agents).To(HaveLen(2))
+
+		runJSON, err := ioutil.ReadFile(filepath.Join(dir, "run.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(runJSON)).To(ContainSubstring(`"agents": [`))
+		Expect(string(runJSON)).NotTo(ContainSubstring("secret"))
+	})
+
+	It("prints progress without the rolling statistics the agents do not report", func() {
+		runner := runCoordinator(
+			"-agents", strings.Join(agentAddrs, ","),
+			"-agent-token", "secret",
+			"-n", "10", "-lower-concurrency", "2", "-upper-concurrency", "4", "-concurrency-step", "2",
+			"-progress-interval", "100ms",
+			"-stdout",
+			testServer.URL(),
+		)
+		Expect(runner.ExitCode()).To(Equal(0))
+		Expect(runner).To(gbytes.Say(`Progress: step 2/2, \d+s elapsed, 10 requests, 0 errors, \d+ non-2xx`))
+		Expect(string(runner.Buffer().Contents())).NotTo(MatchRegexp(`Progress: .*requests per second`))
+	})
+
+	It("exits 1 when an agent cannot be reached", func() {
+		runner := runCoordinator(
+			"-agents", agentAddrs[0]+","+freeAddr(),
+			"-agent-token", "secret",
+			"-stdout",
+			testServer.URL(),
+		)
+		Expect(runner.ExitCode()).To(Equal(1))
+		Expect(runner.Err()).To(gbytes.Say("agent 127.0.0.1:"))
+		Expect(testServer.ReceivedRequests()).To(BeEmpty())
+	})
+
+	It("refuses to start an agent without a token", func() {
+		command := exec.Command(binPath, "agent", "-listen", freeAddr())
+		command.Env = []string{}
+		runner := ginkgomon.New(ginkgomon.Config{
+			Name:    "agent-without-token",
+			Command: command,
+		})
+		process := ifrit.Background(runner)
+		Eventually(process.Wait(), "10s").Should(Receive())
+		Expect(runner.ExitCode()).To(Equal(2))
+		Expect(runner.Err()).To(gbytes.Say("A token is required"))
+	})
+
+	It("warns about agents that run another version", func() {
+		oldAgent := ghttp.NewServer()
+		defer oldAgent.Close()
+		oldAgent.RouteToHandler("GET", "/info", ghttp.RespondWithJSONEncoded(200, map[string]string{"version": "1.2.2"}))
+		oldAgent.RouteToHandler("POST", "/step", ghttp.RespondWith(503, "busy"))
+		runner := runCoordinator(
+			"-agents", agentAddrs[0]+","+oldAgent.URL(),
+			"-agent-token", "secret",
+			"-stdout",
+			testServer.URL(),
+		)
+		Expect(runner.Err()).To(gbytes.Say(`Agent 127.0.0.1:\d+ runs throughputramp 1.2.2, the coordinator 1.2.3`))
+		Expect(runner.Err().Contents()).NotTo(ContainSubstring("Agent " + agentAddrs[0] + " runs"))
+	})
+
+	It("reaches agents served over https", func() {
+		cert, key := selfSignedCert()
+		certPath := filepath.Join(dir, "agent.pem")
+		keyPath := filepath.Join(dir, "agent.key")
+		Expect(ioutil.WriteFile(certPath, cert, 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(keyPath, key, 0600)).To(Succeed())
+		addr := freeAddr()
+		agentProcesses = append(agentProcesses, ginkgomon.Invoke(ginkgomon.New(ginkgomon.Config{
+			Name:       "agent-tls",
+			Command:    exec.Command(binPath, "agent", "-listen", addr, "-token", "secret", "-tls-cert", certPath, "-tls-key", keyPath),
+			StartCheck: "agent listening",
+		})))
+
+		runner := runCoordinator(
+			"-agents", "https://"+addr,
+			"-agent-ca", certPath,
+			"-agent-token", "secret",
+			"-n", "10", "-lower-concurrency", "1", "-upper-concurrency", "1",
+			"-stdout",
+			testServer.URL(),
+		)
+		Expect(runner.ExitCode()).To(Equal(0))
+		Expect(testServer.ReceivedRequests()).To(HaveLen(10))
+	})
+
+	It("refuses to start an agent with a certificate but no key", func() {
+		runner := ginkgomon.New(ginkgomon.Config{
+			Name:    "agent-without-key",
+			Command: exec.Command(binPath, "agent", "-listen", freeAddr(), "-token", "secret", "-tls-cert", "agent.pem"),
+		})
+		process := ifrit.Background(runner)
+		Eventually(process.Wait(), "10s").Should(Receive())
+		Expect(runner.ExitCode()).To(Equal(2))
+		Expect(runner.Err()).To(gbytes.Say("-tls-cert and -tls-key have to be set together"))
+	})
+
+	It("exits 1 when the token is wrong", func() {
+		runner := runCoordinator("-agents", agentAddrs[0], "-stdout", testServer.URL())
+		Expect(runner.ExitCode()).To(Equal(1))
+		Expect(runner.Err()).To(gbytes.Say("401 Unauthorized"))
+	})
+})
+
+// selfSignedCert returns a PEM encoded certificate for 127.0.0.1 and its key.
+func selfSignedCert() ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "throughputramp agent"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
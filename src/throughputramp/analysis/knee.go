@@ -0,0 +1,97 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SLO is the latency objective a step has to meet to be considered for the
+// knee. A zero Latency accepts every step.
+type SLO struct {
+	Percentile float64       `json:"percentile"`
+	Latency    time.Duration `json:"-"`
+}
+
+func (s SLO) Validate() error {
+	switch s.Percentile {
+	case 50, 90, 99, 99.9, 100:
+		return nil
+	}
+	return fmt.Errorf("unsupported SLO percentile %v, must be one of 50, 90, 99, 99.9 or 100", s.Percentile)
+}
+
+func (s SLO) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Percentile float64 `json:"percentile"`
+		LatencyMs  float64 `json:"latency_ms"`
+	}{s.Percentile, milliseconds(s.Latency)})
+}
+
+func (s *SLO) UnmarshalJSON(b []byte) error {
+	var slo struct {
+		Percentile float64 `json:"percentile"`
+		LatencyMs  float64 `json:"latency_ms"`
+	}
+	if err := json.Unmarshal(b, &slo); err != nil {
+		return err
+	}
+	s.Percentile = slo.Percentile
+	s.Latency = time.Duration(slo.LatencyMs * float64(time.Millisecond))
+	return nil
+}
+
+func (s SLO) met(summary StepSummary) bool {
+	if s.Latency == 0 {
+		return true
+	}
+	return summary.Requests > summary.Errors && summary.Percentile(s.Percentile) <= milliseconds(s.Latency)
+}
+
+// Summary is the machine-readable outcome of a run. StopReason is set when
+// the ramp ended before its last step, and Incomplete when it was
+// interrupted.
+type Summary struct {
+	SLO        SLO           `json:"slo"`
+	Knee       *StepSummary  `json:"knee"`
+	StopReason string        `json:"stop_reason,omitempty"`
+	Incomplete bool          `json:"incomplete,omitempty"`
+	Steps      []StepSummary `json:"steps"`
+}
+
+// FindKnee returns the step with the highest throughput among the complete
+// steps that meet the SLO, or nil if none does.
+func FindKnee(steps []StepSummary, slo SLO) *StepSummary {
+	var knee *StepSummary
+	for i := range steps {
+		if steps[i].Incomplete || !slo.met(steps[i]) {
+			continue
+		}
+		if knee == nil || steps[i].Throughput > knee.Throughput {
+			knee = &steps[i]
+		}
+	}
+	return knee
+}
+
+func NewSummary(steps []StepSummary, slo SLO) Summary {
+	return Summary{
+		SLO:   slo,
+		Knee:  FindKnee(steps, slo),
+		Steps: steps,
+	}
+}
+
+func (s Summary) String() string {
+	if s.Knee == nil {
+		return fmt.Sprintf("no step met the p%v latency SLO of %s", s.SLO.Percentile, s.SLO.Latency)
+	}
+	return fmt.Sprintf("knee at step %d (concurrency %d, rate %d): %.1f requests per second, p%v latency %.3fms",
+		s.Knee.Step,
+		s.Knee.Concurrency,
+		s.Knee.Rate,
+		s.Knee.Throughput,
+		s.SLO.Percentile,
+		s.Knee.Percentile(s.SLO.Percentile),
+	)
+}
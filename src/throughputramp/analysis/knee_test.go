@@ -0,0 +1,82 @@
+package analysis_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"throughputramp/analysis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Knee", func() {
+	var steps []analysis.StepSummary
+
+	BeforeEach(func() {
+		steps = []analysis.StepSummary{
+			{Step: 1, Concurrency: 1, Requests: 10, Throughput: 100, P99: 5},
+			{Step: 2, Concurrency: 2, Requests: 10, Throughput: 190, P99: 8},
+			{Step: 3, Concurrency: 3, Requests: 10, Throughput: 200, P99: 40},
+			{Step: 4, Concurrency: 4, Requests: 10, Throughput: 180, P99: 90},
+		}
+	})
+
+	It("finds the step with the highest throughput within the SLO", func() {
+		knee := analysis.FindKnee(steps, analysis.SLO{Percentile: 99, Latency: 10 * time.Millisecond})
+		Expect(knee).ToNot(BeNil())
+		Expect(knee.Step).To(Equal(2))
+	})
+
+	It("finds the step with the highest throughput without an SLO latency", func() {
+		knee := analysis.FindKnee(steps, analysis.SLO{Percentile: 99})
+		Expect(knee.Step).To(Equal(3))
+	})
+
+	It("ignores steps in which every request failed", func() {
+		steps[0].Errors = 10
+		knee := analysis.FindKnee(steps, analysis.SLO{Percentile: 99, Latency: 6 * time.Millisecond})
+		Expect(knee).To(BeNil())
+	})
+
+	It("ignores interrupted steps", func() {
+		steps[2].Incomplete = true
+		knee := analysis.FindKnee(steps, analysis.SLO{Percentile: 99})
+		Expect(knee.Step).To(Equal(2))
+	})
+
+	It("rejects unsupported percentiles", func() {
+		Expect(analysis.SLO{Percentile: 95}.Validate()).To(HaveOccurred())
+		Expect(analysis.SLO{Percentile: 99.9}.Validate()).To(Succeed())
+	})
+
+	Describe("Summary", func() {
+		It("marshals the SLO, knee and steps", func() {
+			summary := analysis.NewSummary(steps[:1], analysis.SLO{Percentile: 99, Latency: 10 * time.Millisecond})
+			Expect(summary.String()).To(Equal("knee at step 1 (concurrency 1, rate 0): 100.0 requests per second, p99 latency 5.000ms"))
+
+			b, err := json.Marshal(summary)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(MatchJSON(`{
+				"slo": {"percentile": 99, "latency_ms": 10},
+				"knee": {"step": 1, "start_time": "0001-01-01T00:00:00Z", "end_time": "0001-01-01T00:00:00Z", "concurrency": 1, "rate_limit": 0, "rate": 0, "warmup_seconds": 0, "requests": 10, "errors": 0, "connect_errors": 0, "non_2xx": 0, "duration_seconds": 0, "throughput": 100, "p50_ms": 0, "p90_ms": 0, "p99_ms": 5, "p99_9_ms": 0, "max_ms": 0, "connections_opened": 0, "connections_closed": 0},
+				"steps": [{"step": 1, "start_time": "0001-01-01T00:00:00Z", "end_time": "0001-01-01T00:00:00Z", "concurrency": 1, "rate_limit": 0, "rate": 0, "warmup_seconds": 0, "requests": 10, "errors": 0, "connect_errors": 0, "non_2xx": 0, "duration_seconds": 0, "throughput": 100, "p50_ms": 0, "p90_ms": 0, "p99_ms": 5, "p99_9_ms": 0, "max_ms": 0, "connections_opened": 0, "connections_closed": 0}]
+			}`))
+		})
+
+		It("reads back the SLO latency", func() {
+			b, err := json.Marshal(analysis.NewSummary(steps, analysis.SLO{Percentile: 99.9, Latency: 2500 * time.Microsecond}))
+			Expect(err).ToNot(HaveOccurred())
+
+			var summary analysis.Summary
+			Expect(json.Unmarshal(b, &summary)).To(Succeed())
+			Expect(summary.SLO).To(Equal(analysis.SLO{Percentile: 99.9, Latency: 2500 * time.Microsecond}))
+		})
+
+		It("reports when no step met the SLO", func() {
+			summary := analysis.NewSummary(steps, analysis.SLO{Percentile: 99, Latency: time.Millisecond})
+			Expect(summary.Knee).To(BeNil())
+			Expect(summary.String()).To(Equal("no step met the p99 latency SLO of 1ms"))
+		})
+	})
+})
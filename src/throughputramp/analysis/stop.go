@@ -0,0 +1,29 @@
+package analysis
+
+import (
+	"fmt"
+	"time"
+)
+
+// StopConditions end a ramp early once a step shows that the router is
+// overloaded. Zero values disable the corresponding condition.
+type StopConditions struct {
+	P99           time.Duration
+	ErrorRatio    float64
+	ConnectErrors int
+}
+
+// Check returns the reason to stop the ramp after the given step, or an
+// empty string if the ramp should continue.
+func (c StopConditions) Check(s StepSummary) string {
+	if c.P99 > 0 && s.P99 > milliseconds(c.P99) {
+		return fmt.Sprintf("step %d p99 latency %.3fms is above %s", s.Step, s.P99, c.P99)
+	}
+	if c.ErrorRatio > 0 && s.ErrorRatio() > c.ErrorRatio {
+		return fmt.Sprintf("step %d non-2xx ratio %.4f is above %v", s.Step, s.ErrorRatio(), c.ErrorRatio)
+	}
+	if c.ConnectErrors > 0 && s.ConnectErrors > c.ConnectErrors {
+		return fmt.Sprintf("step %d had %d connect errors, more than %d", s.Step, s.ConnectErrors, c.ConnectErrors)
+	}
+	return ""
+}
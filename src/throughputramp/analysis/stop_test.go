@@ -0,0 +1,42 @@
+package analysis_test
+
+import (
+	"time"
+
+	"throughputramp/analysis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StopConditions", func() {
+	var step analysis.StepSummary
+
+	BeforeEach(func() {
+		step = analysis.StepSummary{Step: 7, Requests: 100, NonSuccess: 5, ConnectErrors: 3, P99: 25}
+	})
+
+	It("does not stop when no condition is configured", func() {
+		Expect(analysis.StopConditions{}.Check(step)).To(BeEmpty())
+	})
+
+	It("does not stop when every condition is met", func() {
+		conditions := analysis.StopConditions{P99: 30 * time.Millisecond, ErrorRatio: 0.1, ConnectErrors: 3}
+		Expect(conditions.Check(step)).To(BeEmpty())
+	})
+
+	It("stops when the p99 latency is too high", func() {
+		conditions := analysis.StopConditions{P99: 20 * time.Millisecond}
+		Expect(conditions.Check(step)).To(Equal("step 7 p99 latency 25.000ms is above 20ms"))
+	})
+
+	It("stops when too many requests did not succeed", func() {
+		conditions := analysis.StopConditions{ErrorRatio: 0.01}
+		Expect(conditions.Check(step)).To(Equal("step 7 non-2xx ratio 0.0500 is above 0.01"))
+	})
+
+	It("stops when there are too many connect errors", func() {
+		conditions := analysis.StopConditions{ConnectErrors: 2}
+		Expect(conditions.Check(step)).To(Equal("step 7 had 3 connect errors, more than 2"))
+	})
+})
@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"math"
+	"time"
+
+	"throughputramp/loadgen"
+)
+
+// StepSummary holds the throughput and latency percentiles of one step.
+// Latencies are in milliseconds, taken from the step's latency histogram with
+// three significant digits, and only include requests that received a
+// response. NonSuccess counts the requests that did not receive a 2xx
+// response, including the ones that failed. Protocols counts the responses
+// received with each protocol. TLSHandshakes counts the new TLS connections of
+// the step and TLSResumed the ones that resumed a session. ConnectionsOpened
+// and ConnectionsClosed count the connections opened and closed during the
+// step. For streams, Upgrades counts the connections upgraded, UpgradeMean is
+// their mean upgrade latency and Drops counts the connections that failed
+// before the end of the step. Incomplete is set for a step that was
+// interrupted, which only covers the requests sent until then. Agents
+// summarizes the share of every load agent in distributed runs.
+type StepSummary struct {
+	Step          int       `json:"step"`
+	Start         time.Time `json:"start_time"`
+	End           time.Time `json:"end_time"`
+	Concurrency   int       `json:"concurrency"`
+	RateLimit     int       `json:"rate_limit"`
+	Rate          int       `json:"rate"`
+	Warmup        float64   `json:"warmup_seconds"`
+	Requests      int       `json:"requests"`
+	Errors        int       `json:"errors"`
+	ConnectErrors int       `json:"connect_errors"`
+	NonSuccess    int       `json:"non_2xx"`
+	Duration      float64   `json:"duration_seconds"`
+	Throughput    float64   `json:"throughput"`
+	P50           float64   `json:"p50_ms"`
+	P90           float64   `json:"p90_ms"`
+	P99           float64   `json:"p99_ms"`
+	P999          float64   `json:"p99_9_ms"`
+	Max           float64   `json:"max_ms"`
+
+	ConnectionsOpened int `json:"connections_opened"`
+	ConnectionsClosed int `json:"connections_closed"`
+
+	Protocols        map[string]int `json:"protocols,omitempty"`
+	TLSHandshakes    int            `json:"tls_handshakes,omitempty"`
+	TLSResumed       int            `json:"tls_resumed,omitempty"`
+	TLSHandshakeMean float64        `json:"tls_handshake_mean_ms,omitempty"`
+
+	Upgrades    int     `json:"upgrades,omitempty"`
+	UpgradeMean float64 `json:"upgrade_mean_ms,omitempty"`
+	Drops       int     `json:"drops,omitempty"`
+
+	Incomplete bool `json:"incomplete,omitempty"`
+
+	Agent  string        `json:"agent,omitempty"`
+	Agents []StepSummary `json:"agents,omitempty"`
+}
+
+func Summarize(step int, result loadgen.Result) StepSummary {
+	summary := StepSummary{
+		Step:              step,
+		Start:             result.Start,
+		End:               result.End,
+		Concurrency:       result.Step.Concurrency,
+		RateLimit:         result.Step.RateLimit,
+		Rate:              result.Step.Rate,
+		Warmup:            result.Step.Warmup.Seconds(),
+		Requests:          result.Requests,
+		Errors:            result.Errors,
+		ConnectErrors:     result.ConnectErrors,
+		NonSuccess:        result.NonSuccess,
+		Duration:          result.End.Sub(result.Start).Seconds(),
+		Protocols:         result.Protocols,
+		TLSHandshakes:     result.TLSHandshakes,
+		TLSResumed:        result.TLSResumed,
+		ConnectionsOpened: result.ConnectionsOpened,
+		ConnectionsClosed: result.ConnectionsClosed,
+		Upgrades:          result.Upgrades,
+		Drops:             result.Drops,
+		Agent:             result.Agent,
+	}
+	if result.TLSHandshakes > 0 {
+		summary.TLSHandshakeMean = milliseconds(result.TLSHandshakeTime / time.Duration(result.TLSHandshakes))
+	}
+	if result.Upgrades > 0 {
+		summary.UpgradeMean = milliseconds(result.UpgradeTime / time.Duration(result.Upgrades))
+	}
+	for _, agent := range result.Agents {
+		summary.Agents = append(summary.Agents, Summarize(step, agent))
+	}
+	if result.Latency == nil || result.Latency.TotalCount() == 0 {
+		return summary
+	}
+
+	if summary.Duration > 0 {
+		summary.Throughput = float64(result.Latency.TotalCount()) / summary.Duration
+	}
+	summary.P50 = percentile(result, 50)
+	summary.P90 = percentile(result, 90)
+	summary.P99 = percentile(result, 99)
+	summary.P999 = percentile(result, 99.9)
+	summary.Max = milliseconds(time.Duration(result.Latency.Max()) * time.Microsecond)
+	return summary
+}
+
+// ErrorRatio is the fraction of requests that did not receive a 2xx response.
+func (s StepSummary) ErrorRatio() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.NonSuccess) / float64(s.Requests)
+}
+
+// Percentile returns the latency in milliseconds for the given percentile
+// (0-100) of the step.
+func (s StepSummary) Percentile(p float64) float64 {
+	switch p {
+	case 50:
+		return s.P50
+	case 90:
+		return s.P90
+	case 99:
+		return s.P99
+	case 99.9:
+		return s.P999
+	case 100:
+		return s.Max
+	}
+	return math.NaN()
+}
+
+func percentile(result loadgen.Result, p float64) float64 {
+	return milliseconds(time.Duration(result.Latency.ValueAtPercentile(p)) * time.Microsecond)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
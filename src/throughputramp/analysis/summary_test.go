@@ -0,0 +1,103 @@
+package analysis_test
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"throughputramp/analysis"
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Summarize", func() {
+	It("computes throughput and latency percentiles of successful requests", func() {
+		start := time.Now()
+		result := loadgen.NewResult(loadgen.Step{Concurrency: 4, RateLimit: 10, Warmup: time.Second}, start)
+		result.End = start.Add(2 * time.Second)
+		result.Record(loadgen.Sample{StatusCode: 503, ResponseTime: time.Millisecond})
+		for i := 2; i <= 100; i++ {
+			result.Record(loadgen.Sample{StatusCode: 200, ResponseTime: time.Duration(i) * time.Millisecond})
+		}
+		result.Record(loadgen.Sample{ResponseTime: time.Hour, Err: errors.New("timeout")})
+		result.Record(loadgen.Sample{Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}})
+
+		summary := analysis.Summarize(3, result)
+		Expect(summary).To(Equal(analysis.StepSummary{
+			Step:          3,
+			Start:         start,
+			End:           start.Add(2 * time.Second),
+			Concurrency:   4,
+			RateLimit:     10,
+			Warmup:        1,
+			Requests:      102,
+			Errors:        2,
+			ConnectErrors: 1,
+			NonSuccess:    3,
+			Duration:      2,
+			Throughput:    50,
+			P50:           50.015,
+			P90:           90.047,
+			P99:           99.007,
+			P999:          100.031,
+			Max:           100.031,
+		}))
+		Expect(summary.Percentile(90)).To(Equal(90.047))
+		Expect(summary.ErrorRatio()).To(BeNumerically("~", 3.0/102))
+	})
+
+	It("handles steps without successful requests", func() {
+		result := loadgen.NewResult(loadgen.Step{}, time.Now())
+		result.Record(loadgen.Sample{Err: errors.New("connection refused")})
+		summary := analysis.Summarize(1, result)
+		Expect(summary.Requests).To(Equal(1))
+		Expect(summary.Errors).To(Equal(1))
+		Expect(summary.ErrorRatio()).To(Equal(1.0))
+		Expect(summary.Throughput).To(BeZero())
+		Expect(summary.P99).To(BeZero())
+	})
+
+	It("counts the TLS handshakes and averages their duration", func() {
+		result := loadgen.NewResult(loadgen.Step{}, time.Now())
+		result.Record(loadgen.Sample{StatusCode: 200, TLSHandshake: 4 * time.Millisecond})
+		result.Record(loadgen.Sample{StatusCode: 200, TLSHandshake: 2 * time.Millisecond, TLSResumed: true})
+		result.Record(loadgen.Sample{StatusCode: 200, ConnReused: true})
+		summary := analysis.Summarize(1, result)
+		Expect(summary.TLSHandshakes).To(Equal(2))
+		Expect(summary.TLSResumed).To(Equal(1))
+		Expect(summary.TLSHandshakeMean).To(Equal(3.0))
+	})
+
+	It("counts the upgrades and drops of streams and averages the upgrade latency", func() {
+		result := loadgen.NewResult(loadgen.Step{}, time.Now())
+		result.Record(loadgen.Sample{StatusCode: 101})
+		result.Upgrades, result.UpgradeTime, result.Drops = 4, 10*time.Millisecond, 1
+		summary := analysis.Summarize(1, result)
+		Expect(summary.NonSuccess).To(BeZero())
+		Expect(summary.Upgrades).To(Equal(4))
+		Expect(summary.UpgradeMean).To(Equal(2.5))
+		Expect(summary.Drops).To(Equal(1))
+	})
+
+	It("summarizes the share of every agent", func() {
+		start := time.Now()
+		result := loadgen.NewResult(loadgen.Step{Concurrency: 4}, start)
+		result.End = start.Add(time.Second)
+		for _, name := range []string{"a", "b"} {
+			agent := loadgen.NewResult(loadgen.Step{Concurrency: 2}, start)
+			agent.End = start.Add(time.Second)
+			agent.Agent = name
+			agent.Record(loadgen.Sample{StatusCode: 200, ResponseTime: time.Millisecond})
+			result.Agents = append(result.Agents, agent)
+		}
+
+		summary := analysis.Summarize(2, result)
+		Expect(summary.Agents).To(HaveLen(2))
+		Expect(summary.Agents[1].Step).To(Equal(2))
+		Expect(summary.Agents[1].Agent).To(Equal("b"))
+		Expect(summary.Agents[1].Concurrency).To(Equal(2))
+		Expect(summary.Agents[1].Throughput).To(Equal(1.0))
+	})
+})
@@ -0,0 +1,126 @@
+// Package checkpoint persists a run while it progresses, so that a run that
+// was interrupted can be continued from the step after the last completed
+// one instead of starting over. Every completed step of a target is written
+// to its own directory, and the checkpoint file records the steps that were
+// completed by all targets.
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"throughputramp/analysis"
+	"throughputramp/data"
+)
+
+// File is the name of the checkpoint file in the checkpoint directory.
+const File = "checkpoint.json"
+
+// Files written for every step. They hold the part of the run's datasets
+// that the step added.
+const (
+	samplesFile    = "perfResults.csv"
+	throughputFile = "throughput.csv"
+	latencyLogFile = "latency.hlog"
+)
+
+// Checkpoint records a run after its first Completed steps. Finished is set
+// once the results of the run were stored, so that it is not resumed again.
+type Checkpoint struct {
+	Run       data.RunMetadata `json:"run"`
+	Completed int              `json:"completed_steps"`
+	Targets   []Target         `json:"targets"`
+	Finished  bool             `json:"finished,omitempty"`
+}
+
+// Target is the state of a router under test. Steps summarizes the steps it
+// completed, which is fewer than the run's if it stopped early.
+type Target struct {
+	Name       string                 `json:"name,omitempty"`
+	URL        string                 `json:"url"`
+	Steps      []analysis.StepSummary `json:"steps"`
+	StopReason string                 `json:"stop_reason,omitempty"`
+	Err        string                 `json:"error,omitempty"`
+}
+
+// Step is the data a step added to the samples, throughput and latency log
+// datasets of a target.
+type Step struct {
+	Samples    []byte
+	Throughput []byte
+	LatencyLog []byte
+}
+
+// Write replaces the checkpoint in dir. The previous checkpoint is kept if
+// writing fails.
+func Write(dir string, c Checkpoint) error {
+	contents, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, File)
+	if err := ioutil.WriteFile(path+".tmp", contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Read returns the checkpoint in dir.
+func Read(dir string) (Checkpoint, error) {
+	var c Checkpoint
+	contents, err := ioutil.ReadFile(filepath.Join(dir, File))
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(contents, &c); err != nil {
+		return c, fmt.Errorf("parsing %s: %s", File, err)
+	}
+	return c, nil
+}
+
+// WriteStep writes the data of step n of the named target to dir. The
+// target is empty in runs with a single target.
+func WriteStep(dir, target string, n int, s Step) error {
+	stepDir := stepDirectory(dir, target, n)
+	if err := os.MkdirAll(stepDir, 0755); err != nil {
+		return err
+	}
+	for name, contents := range map[string][]byte{
+		samplesFile:    s.Samples,
+		throughputFile: s.Throughput,
+		latencyLogFile: s.LatencyLog,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(stepDir, name), contents, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadStep returns the data of step n of the named target written to dir.
+func ReadStep(dir, target string, n int) (Step, error) {
+	stepDir := stepDirectory(dir, target, n)
+	var s Step
+	for name, contents := range map[string]*[]byte{
+		samplesFile:    &s.Samples,
+		throughputFile: &s.Throughput,
+		latencyLogFile: &s.LatencyLog,
+	} {
+		var err error
+		*contents, err = ioutil.ReadFile(filepath.Join(stepDir, name))
+		if err != nil {
+			return Step{}, err
+		}
+	}
+	return s, nil
+}
+
+func stepDirectory(dir, target string, n int) string {
+	return filepath.Join(dir, target, fmt.Sprintf("step-%d", n))
+}
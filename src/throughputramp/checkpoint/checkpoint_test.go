@@ -0,0 +1,95 @@
+package checkpoint_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"throughputramp/analysis"
+	"throughputramp/checkpoint"
+	"throughputramp/data"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checkpoint", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "checkpoint")
+		Expect(err).NotTo(HaveOccurred())
+		dir = filepath.Join(dir, "run")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(filepath.Dir(dir))).To(Succeed())
+	})
+
+	It("writes and reads the checkpoint, creating the directory", func() {
+		start := time.Date(2016, 12, 15, 23, 0, 0, 0, time.UTC)
+		c := checkpoint.Checkpoint{
+			Run: data.RunMetadata{
+				Generator: "native",
+				Steps:     []data.StepMetadata{{Requests: 10, Concurrency: 1}, {Requests: 10, Concurrency: 2}},
+				StartTime: start,
+			},
+			Completed: 1,
+			Targets: []checkpoint.Target{
+				{Name: "a", URL: "http://a", Steps: []analysis.StepSummary{{Step: 1, Start: start, Requests: 10, P99: 1.5}}},
+				{Name: "b", URL: "http://b", StopReason: "step 1 failed: refused", Err: "refused"},
+			},
+		}
+		Expect(checkpoint.Write(dir, c)).To(Succeed())
+
+		read, err := checkpoint.Read(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(read).To(Equal(c))
+		Expect(filepath.Join(dir, checkpoint.File+".tmp")).NotTo(BeAnExistingFile())
+	})
+
+	It("replaces the previous checkpoint", func() {
+		Expect(checkpoint.Write(dir, checkpoint.Checkpoint{Completed: 1})).To(Succeed())
+		Expect(checkpoint.Write(dir, checkpoint.Checkpoint{Completed: 2})).To(Succeed())
+
+		read, err := checkpoint.Read(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(read.Completed).To(Equal(2))
+	})
+
+	It("fails to read a missing or invalid checkpoint", func() {
+		_, err := checkpoint.Read(dir)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, checkpoint.File), []byte("{"), 0644)).To(Succeed())
+		_, err = checkpoint.Read(dir)
+		Expect(err).To(MatchError(HavePrefix("parsing checkpoint.json: ")))
+	})
+
+	It("writes and reads the data of every step of every target", func() {
+		step := checkpoint.Step{
+			Samples:    []byte("step,concurrency\n1,1\n"),
+			Throughput: []byte("step,start-time,throughput\n"),
+			LatencyLog: []byte("Tag=step-1,0.000,1.000,2.000,HISTFAAA\n"),
+		}
+		Expect(checkpoint.WriteStep(dir, "", 1, step)).To(Succeed())
+		Expect(checkpoint.WriteStep(dir, "b", 2, checkpoint.Step{Samples: []byte("1,2\n")})).To(Succeed())
+		Expect(filepath.Join(dir, "step-1", "latency.hlog")).To(BeAnExistingFile())
+		Expect(filepath.Join(dir, "b", "step-2", "perfResults.csv")).To(BeAnExistingFile())
+
+		read, err := checkpoint.ReadStep(dir, "", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(read).To(Equal(step))
+
+		read, err = checkpoint.ReadStep(dir, "b", 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(read.Samples)).To(Equal("1,2\n"))
+		Expect(read.Throughput).To(BeEmpty())
+
+		_, err = checkpoint.ReadStep(dir, "b", 3)
+		Expect(err).To(HaveOccurred())
+	})
+})
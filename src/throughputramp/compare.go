@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"throughputramp/analysis"
+	"throughputramp/compare"
+	"throughputramp/sink"
+	"throughputramp/uploader"
+)
+
+// runCompare implements the compare subcommand. It returns 0 if the candidate
+// did not regress, 1 if it did and 2 on errors.
+func runCompare(args []string) int {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	throughputTolerance := flags.Float64("throughput-tolerance", 0.05, "Largest relative throughput decrease of a step that is not a regression")
+	latencyTolerance := flags.Float64("latency-tolerance", 0.1, "Largest relative latency increase of a step that is not a regression")
+	errorTolerance := flags.Float64("error-tolerance", 0.01, "Largest increase of the ratio of failed and non-2xx requests of a step that is not a regression")
+	percentiles := flags.String("percentiles", "50,90,99", "Comma-separated latency percentiles to compare: 50, 90, 99, 99.9 or 100")
+	alpha := flags.Float64("alpha", 0.01, "Significance level a throughput or latency change must reach to count as a regression")
+	s3Endpoint := flags.String("s3-endpoint", "", "The endpoint for the S3 service to download s3:// results from.")
+	s3Region := flags.String("s3-region", "", "The region for the S3 service to download s3:// results from. If provided, endpoint is ignored.")
+	accessKeyID := flags.String("access-key-id", "", "AccessKeyID for the S3 service.")
+	secretAccessKey := flags.String("secret-access-key", "", "SecretAccessKey for the S3 service.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: throughputramp compare [flags] <baseline> <candidate>\n\n"+
+			"Results are read from a local directory or from s3://<bucket>/<timestamp>.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	tolerances := compare.Tolerances{
+		Throughput: *throughputTolerance,
+		Latency:    *latencyTolerance,
+		ErrorRatio: *errorTolerance,
+		Alpha:      *alpha,
+	}
+	for _, p := range strings.Split(*percentiles, ",") {
+		percentile, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(analysis.StepSummary{}.Percentile(percentile)) {
+			fmt.Fprintf(os.Stderr, "unsupported percentile %q\n", p)
+			return 2
+		}
+		tolerances.Percentiles = append(tolerances.Percentiles, percentile)
+	}
+
+	s3Config := uploader.Config{
+		Endpoint:        *s3Endpoint,
+		AwsRegion:       *s3Region,
+		AccessKeyID:     *accessKeyID,
+		SecretAccessKey: *secretAccessKey,
+	}
+	base, err := loadRun(flags.Arg(0), s3Config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loading baseline: %s\n", err)
+		return 2
+	}
+	candidate, err := loadRun(flags.Arg(1), s3Config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loading candidate: %s\n", err)
+		return 2
+	}
+
+	report := compare.Compare(base, candidate, tolerances)
+	report.WriteTo(os.Stdout)
+	if report.Regressed() {
+		return 1
+	}
+	return 0
+}
+
+func loadRun(location string, s3Config uploader.Config) (compare.Run, error) {
+	read, err := resultReader(location, s3Config)
+	if err != nil {
+		return compare.Run{}, err
+	}
+
+	summaryJSON, err := read("summary.json")
+	if err != nil {
+		return compare.Run{}, err
+	}
+	latencyLog, err := read("latency.hlog")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Comparing only the percentiles of %s: %s\n", location, err)
+		latencyLog = nil
+	}
+	return compare.LoadRun(summaryJSON, latencyLog)
+}
+
+// resultReader returns a function that reads the named result files of the
+// run stored in a local directory or at s3://<bucket>/<timestamp>.
+func resultReader(location string, s3Config uploader.Config) (func(name string) ([]byte, error), error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return func(name string) ([]byte, error) {
+			return ioutil.ReadFile(filepath.Join(location, name))
+		}, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(location, "s3://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("%s is not of the form s3://<bucket>/<timestamp>", location)
+	}
+	s3Config.BucketName = parts[0]
+	if err := s3Config.Validate(); err != nil {
+		return nil, fmt.Errorf("s3 config error: %s", err)
+	}
+	return func(name string) ([]byte, error) {
+		return uploader.Download(&s3Config, sink.Key(name, parts[1]))
+	}, nil
+}
@@ -0,0 +1,232 @@
+// Package compare compares two throughputramp runs step by step and decides
+// whether the candidate regressed against the baseline.
+package compare
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"throughputramp/analysis"
+	"throughputramp/histogram"
+)
+
+// Run is a throughputramp run as read back from its results. Latency holds
+// the latency histogram of each step by step number and is empty for runs
+// without a latency log.
+type Run struct {
+	Steps   []analysis.StepSummary
+	Latency map[int]*histogram.Histogram
+}
+
+// LoadRun parses the summary.json and latency.hlog of a run. latencyLog may
+// be nil.
+func LoadRun(summaryJSON, latencyLog []byte) (Run, error) {
+	var summary analysis.Summary
+	if err := json.Unmarshal(summaryJSON, &summary); err != nil {
+		return Run{}, fmt.Errorf("parsing summary: %s", err)
+	}
+	run := Run{Steps: summary.Steps, Latency: make(map[int]*histogram.Histogram)}
+	if latencyLog == nil {
+		return run, nil
+	}
+
+	intervals, err := histogram.ReadLog(bytes.NewReader(latencyLog))
+	if err != nil {
+		return Run{}, fmt.Errorf("parsing latency log: %s", err)
+	}
+	for _, interval := range intervals {
+		step, err := strconv.Atoi(strings.TrimPrefix(interval.Tag, "step-"))
+		if err != nil {
+			return Run{}, fmt.Errorf("parsing latency log: unexpected tag %q", interval.Tag)
+		}
+		run.Latency[step] = interval.Histogram
+	}
+	return run, nil
+}
+
+// Tolerances bound the changes the candidate may show before a step counts
+// as regressed. Throughput and Latency are relative, ErrorRatio is absolute.
+// A throughput or latency change only counts when it is also statistically
+// significant at level Alpha.
+type Tolerances struct {
+	Throughput  float64
+	Latency     float64
+	ErrorRatio  float64
+	Percentiles []float64
+	Alpha       float64
+}
+
+// Report is the step by step comparison of a candidate against a baseline.
+type Report struct {
+	Tolerances Tolerances
+	Steps      []StepComparison
+}
+
+// StepComparison compares one step. Base or Candidate is nil when the step
+// only exists in the other run, in which case nothing else is set.
+// LatencyP is NaN when either run has no latency histogram for the step.
+type StepComparison struct {
+	Step             int
+	Base             *analysis.StepSummary
+	Candidate        *analysis.StepSummary
+	SettingsDiffer   bool
+	ThroughputChange float64
+	ThroughputP      float64
+	Latency          []PercentileChange
+	LatencyD         float64
+	LatencyP         float64
+	Regressions      []string
+}
+
+type PercentileChange struct {
+	Percentile float64
+	Base       float64
+	Candidate  float64
+	Change     float64
+}
+
+// Compare aligns the runs by step number and compares every step.
+func Compare(base, candidate Run, t Tolerances) Report {
+	report := Report{Tolerances: t}
+	baseSteps := stepsByNumber(base.Steps)
+	candidateSteps := stepsByNumber(candidate.Steps)
+
+	last := 0
+	for step := range baseSteps {
+		last = max(last, step)
+	}
+	for step := range candidateSteps {
+		last = max(last, step)
+	}
+	for step := 1; step <= last; step++ {
+		b, c := baseSteps[step], candidateSteps[step]
+		if b == nil && c == nil {
+			continue
+		}
+		comparison := StepComparison{Step: step, Base: b, Candidate: c}
+		if b != nil && c != nil {
+			comparison.compare(base.Latency[step], candidate.Latency[step], t)
+		}
+		report.Steps = append(report.Steps, comparison)
+	}
+	return report
+}
+
+func (s *StepComparison) compare(baseLatency, candidateLatency *histogram.Histogram, t Tolerances) {
+	b, c := s.Base, s.Candidate
+	if b.Concurrency != c.Concurrency || b.RateLimit != c.RateLimit || b.Rate != c.Rate {
+		s.SettingsDiffer = true
+		return
+	}
+
+	s.ThroughputChange = change(b.Throughput, c.Throughput)
+	s.ThroughputP = RateDecrease(b.Throughput*b.Duration, b.Duration, c.Throughput*c.Duration, c.Duration)
+	if -s.ThroughputChange > t.Throughput && s.ThroughputP < t.Alpha {
+		s.Regressions = append(s.Regressions, fmt.Sprintf("throughput %+.1f%% exceeds tolerance of -%.1f%%", 100*s.ThroughputChange, 100*t.Throughput))
+	}
+
+	s.LatencyP = math.NaN()
+	if baseLatency != nil && candidateLatency != nil {
+		s.LatencyD, s.LatencyP = KolmogorovSmirnov(baseLatency, candidateLatency)
+	}
+	latencyDiffers := math.IsNaN(s.LatencyP) || s.LatencyP < t.Alpha
+	for _, p := range t.Percentiles {
+		pc := PercentileChange{
+			Percentile: p,
+			Base:       b.Percentile(p),
+			Candidate:  c.Percentile(p),
+		}
+		pc.Change = change(pc.Base, pc.Candidate)
+		s.Latency = append(s.Latency, pc)
+		if pc.Change > t.Latency && latencyDiffers {
+			s.Regressions = append(s.Regressions, fmt.Sprintf("p%v latency %+.1f%% exceeds tolerance of +%.1f%%", p, 100*pc.Change, 100*t.Latency))
+		}
+	}
+
+	if increase := c.ErrorRatio() - b.ErrorRatio(); increase > t.ErrorRatio {
+		s.Regressions = append(s.Regressions, fmt.Sprintf("error ratio %+.2f%% exceeds tolerance of +%.2f%%", 100*increase, 100*t.ErrorRatio))
+	}
+}
+
+// Regressed reports whether any step regressed.
+func (r Report) Regressed() bool {
+	for _, s := range r.Steps {
+		if len(s.Regressions) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Report) WriteTo(w io.Writer) (int64, error) {
+	out := new(bytes.Buffer)
+	regressed := 0
+	for _, s := range r.Steps {
+		switch {
+		case s.Base == nil:
+			fmt.Fprintf(out, "step %d: only in candidate\n", s.Step)
+			continue
+		case s.Candidate == nil:
+			fmt.Fprintf(out, "step %d: only in baseline\n", s.Step)
+			continue
+		case s.SettingsDiffer:
+			fmt.Fprintf(out, "step %d: settings differ, baseline %s, candidate %s\n", s.Step, settings(s.Base), settings(s.Candidate))
+			continue
+		}
+
+		status := "ok"
+		if len(s.Regressions) > 0 {
+			status = "REGRESSED"
+			regressed++
+		}
+		fmt.Fprintf(out, "step %d (%s): %s\n", s.Step, settings(s.Base), status)
+		fmt.Fprintf(out, "  throughput %10.1f -> %10.1f req/s %+7.1f%% (p=%.3g)\n",
+			s.Base.Throughput, s.Candidate.Throughput, 100*s.ThroughputChange, s.ThroughputP)
+		for _, pc := range s.Latency {
+			fmt.Fprintf(out, "  %-10s %10.3f -> %10.3f ms    %+7.1f%%\n",
+				fmt.Sprintf("p%v", pc.Percentile), pc.Base, pc.Candidate, 100*pc.Change)
+		}
+		if math.IsNaN(s.LatencyP) {
+			fmt.Fprintf(out, "  latency distributions not compared, latency log missing\n")
+		} else {
+			fmt.Fprintf(out, "  latency distributions D=%.3f (p=%.3g)\n", s.LatencyD, s.LatencyP)
+		}
+		for _, regression := range s.Regressions {
+			fmt.Fprintf(out, "  regression: %s\n", regression)
+		}
+	}
+	if regressed > 0 {
+		fmt.Fprintf(out, "candidate regressed in %d of %d steps\n", regressed, len(r.Steps))
+	} else {
+		fmt.Fprintf(out, "no regressions in %d steps\n", len(r.Steps))
+	}
+	return out.WriteTo(w)
+}
+
+func settings(s *analysis.StepSummary) string {
+	if s.Rate > 0 {
+		return fmt.Sprintf("rate %d, concurrency %d", s.Rate, s.Concurrency)
+	}
+	return fmt.Sprintf("concurrency %d, rate limit %d", s.Concurrency, s.RateLimit)
+}
+
+func stepsByNumber(steps []analysis.StepSummary) map[int]*analysis.StepSummary {
+	byNumber := make(map[int]*analysis.StepSummary)
+	for i := range steps {
+		byNumber[steps[i].Step] = &steps[i]
+	}
+	return byNumber
+}
+
+// change is the relative change from base to candidate, 0 if base is 0.
+func change(base, candidate float64) float64 {
+	if base == 0 {
+		return 0
+	}
+	return (candidate - base) / base
+}
@@ -0,0 +1,156 @@
+package compare_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"time"
+
+	"throughputramp/analysis"
+	"throughputramp/compare"
+	"throughputramp/histogram"
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Compare", func() {
+	var (
+		start      time.Time
+		tolerances compare.Tolerances
+	)
+
+	// newRun returns a run with one closed-loop step per element of
+	// latencies. Each step sends requests requests in 10 seconds, with
+	// response times spread evenly from the latency up to twice of it.
+	newRun := func(requests int, latencies ...time.Duration) compare.Run {
+		run := compare.Run{Latency: make(map[int]*histogram.Histogram)}
+		for i, latency := range latencies {
+			result := loadgen.NewResult(loadgen.Step{Concurrency: i + 1}, start)
+			result.End = start.Add(10 * time.Second)
+			for r := 0; r < requests; r++ {
+				result.Record(loadgen.Sample{
+					StatusCode:   200,
+					ResponseTime: latency + latency*time.Duration(r)/time.Duration(requests),
+				})
+			}
+			run.Steps = append(run.Steps, analysis.Summarize(i+1, result))
+			run.Latency[i+1] = result.Latency
+		}
+		return run
+	}
+
+	BeforeEach(func() {
+		start = time.Date(2016, 12, 15, 23, 0, 0, 0, time.UTC)
+		tolerances = compare.Tolerances{
+			Throughput:  0.05,
+			Latency:     0.1,
+			ErrorRatio:  0.01,
+			Percentiles: []float64{50, 99},
+			Alpha:       0.01,
+		}
+	})
+
+	It("finds no regressions between equal runs", func() {
+		report := compare.Compare(newRun(1000, time.Millisecond, 2*time.Millisecond), newRun(1000, time.Millisecond, 2*time.Millisecond), tolerances)
+		Expect(report.Steps).To(HaveLen(2))
+		Expect(report.Regressed()).To(BeFalse())
+		Expect(report.Steps[0].ThroughputChange).To(BeZero())
+		Expect(report.Steps[0].LatencyP).To(Equal(1.0))
+		Expect(report.Steps[1].Latency).To(HaveLen(2))
+	})
+
+	It("reports throughput and latency regressions beyond the tolerances", func() {
+		report := compare.Compare(newRun(1000, time.Millisecond, time.Millisecond), newRun(800, time.Millisecond, 2*time.Millisecond), tolerances)
+		Expect(report.Regressed()).To(BeTrue())
+		Expect(report.Steps[0].Regressions).To(ConsistOf(ContainSubstring("throughput -20.0%")))
+		Expect(report.Steps[1].Regressions).To(ConsistOf(
+			ContainSubstring("throughput -20.0%"),
+			ContainSubstring("p50 latency +99.9%"),
+			ContainSubstring("p99 latency +99.9%"),
+		))
+		Expect(report.Steps[1].LatencyP).To(BeNumerically("<", 0.01))
+
+		out := new(bytes.Buffer)
+		report.WriteTo(out)
+		Expect(out.String()).To(ContainSubstring("step 2 (concurrency 2, rate limit 0): REGRESSED\n"))
+		Expect(out.String()).To(ContainSubstring("candidate regressed in 2 of 2 steps\n"))
+	})
+
+	It("tolerates changes within the tolerances", func() {
+		report := compare.Compare(newRun(1000, 100*time.Millisecond), newRun(980, 105*time.Millisecond), tolerances)
+		Expect(report.Regressed()).To(BeFalse())
+		Expect(report.Steps[0].ThroughputChange).To(BeNumerically("~", -0.02, 0.001))
+	})
+
+	It("ignores latency increases that are not significant", func() {
+		report := compare.Compare(newRun(10, 100*time.Millisecond), newRun(10, 115*time.Millisecond), tolerances)
+		Expect(report.Steps[0].Latency[0].Change).To(BeNumerically(">", 0.1))
+		Expect(report.Steps[0].LatencyP).To(BeNumerically(">", 0.01))
+		Expect(report.Regressed()).To(BeFalse())
+	})
+
+	It("compares percentiles alone when latency histograms are missing", func() {
+		candidate := newRun(10, 115*time.Millisecond)
+		candidate.Latency = map[int]*histogram.Histogram{}
+		report := compare.Compare(newRun(10, 100*time.Millisecond), candidate, tolerances)
+		Expect(math.IsNaN(report.Steps[0].LatencyP)).To(BeTrue())
+		Expect(report.Regressed()).To(BeTrue())
+	})
+
+	It("reports error ratio increases", func() {
+		candidate := newRun(1000, time.Millisecond)
+		candidate.Steps[0].Requests = 1100
+		candidate.Steps[0].NonSuccess = 100
+		report := compare.Compare(newRun(1000, time.Millisecond), candidate, tolerances)
+		Expect(report.Steps[0].Regressions).To(ConsistOf(ContainSubstring("error ratio +9.09%")))
+	})
+
+	It("does not compare steps with different settings or missing steps", func() {
+		candidate := newRun(1000, time.Millisecond, 2*time.Millisecond, time.Millisecond)
+		candidate.Steps[0].Concurrency = 5
+		report := compare.Compare(newRun(10, time.Millisecond, 2*time.Millisecond), candidate, tolerances)
+		Expect(report.Steps).To(HaveLen(3))
+		Expect(report.Steps[0].SettingsDiffer).To(BeTrue())
+		Expect(report.Steps[2].Base).To(BeNil())
+		Expect(report.Regressed()).To(BeFalse())
+
+		out := new(bytes.Buffer)
+		report.WriteTo(out)
+		Expect(out.String()).To(ContainSubstring("step 1: settings differ"))
+		Expect(out.String()).To(ContainSubstring("step 3: only in candidate"))
+	})
+
+	Describe("LoadRun", func() {
+		It("reads the summary and latency log of a run", func() {
+			run := newRun(100, time.Millisecond, 2*time.Millisecond)
+			summaryJSON, err := json.Marshal(analysis.NewSummary(run.Steps, analysis.SLO{Percentile: 99}))
+			Expect(err).NotTo(HaveOccurred())
+			latencyLog := new(bytes.Buffer)
+			lw, err := histogram.NewLogWriter(latencyLog, start)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lw.WriteInterval("step-1", start, start.Add(10*time.Second), run.Latency[1])).To(Succeed())
+			Expect(lw.WriteInterval("step-2", start, start.Add(10*time.Second), run.Latency[2])).To(Succeed())
+
+			loaded, err := compare.LoadRun(summaryJSON, latencyLog.Bytes())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Steps).To(HaveLen(2))
+			Expect(loaded.Steps[1].P99).To(Equal(run.Steps[1].P99))
+			Expect(loaded.Latency[2].TotalCount()).To(Equal(int64(100)))
+
+			loaded, err = compare.LoadRun(summaryJSON, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Latency).To(BeEmpty())
+		})
+
+		It("rejects latency logs of other tools", func() {
+			h, _ := histogram.New(1, 1000, 3)
+			latencyLog := new(bytes.Buffer)
+			lw, _ := histogram.NewLogWriter(latencyLog, start)
+			lw.WriteInterval("other", start, start, h)
+			_, err := compare.LoadRun([]byte(`{"steps": []}`), latencyLog.Bytes())
+			Expect(err).To(MatchError(ContainSubstring(`unexpected tag "other"`)))
+		})
+	})
+})
@@ -0,0 +1,72 @@
+package compare
+
+import (
+	"math"
+
+	"throughputramp/histogram"
+)
+
+// KolmogorovSmirnov runs the two-sample Kolmogorov-Smirnov test on the values
+// recorded in a and b. It returns the largest distance between their
+// cumulative distributions and the probability of a distance at least that
+// large if both were drawn from the same distribution.
+func KolmogorovSmirnov(a, b *histogram.Histogram) (d, p float64) {
+	na, nb := float64(a.TotalCount()), float64(b.TotalCount())
+	if na == 0 || nb == 0 {
+		return 0, 1
+	}
+
+	bucketsA, bucketsB := a.Buckets(), b.Buckets()
+	var cumulativeA, cumulativeB float64
+	for i, j := 0, 0; i < len(bucketsA) || j < len(bucketsB); {
+		var value int64
+		if j == len(bucketsB) || (i < len(bucketsA) && bucketsA[i].Value < bucketsB[j].Value) {
+			value = bucketsA[i].Value
+		} else {
+			value = bucketsB[j].Value
+		}
+		for ; i < len(bucketsA) && bucketsA[i].Value <= value; i++ {
+			cumulativeA += float64(bucketsA[i].Count)
+		}
+		for ; j < len(bucketsB) && bucketsB[j].Value <= value; j++ {
+			cumulativeB += float64(bucketsB[j].Count)
+		}
+		d = math.Max(d, math.Abs(cumulativeA/na-cumulativeB/nb))
+	}
+
+	n := math.Sqrt(na * nb / (na + nb))
+	return d, kolmogorovProbability((n + 0.12 + 0.11/n) * d)
+}
+
+// kolmogorovProbability is the complementary cumulative distribution
+// function of the Kolmogorov distribution.
+func kolmogorovProbability(lambda float64) float64 {
+	if lambda < 0.001 {
+		return 1
+	}
+	var sum float64
+	sign := 1.0
+	for j := 1.0; j <= 100; j++ {
+		term := sign * 2 * math.Exp(-2*j*j*lambda*lambda)
+		sum += term
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+		sign = -sign
+	}
+	return math.Max(0, math.Min(1, sum))
+}
+
+// RateDecrease tests whether the rate of countB events in durationB is lower
+// than the rate of countA events in durationA, treating both counts as
+// Poisson distributed. It returns the one-sided probability of a decrease at
+// least this large if both rates were equal.
+func RateDecrease(countA, durationA, countB, durationB float64) float64 {
+	if durationA <= 0 || durationB <= 0 || countA+countB == 0 {
+		return 1
+	}
+	pooled := (countA + countB) / (durationA + durationB)
+	se := math.Sqrt(pooled/durationA + pooled/durationB)
+	z := (countB/durationB - countA/durationA) / se
+	return 0.5 * math.Erfc(-z/math.Sqrt2)
+}
@@ -0,0 +1,52 @@
+package compare_test
+
+import (
+	"throughputramp/compare"
+	"throughputramp/histogram"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KolmogorovSmirnov", func() {
+	newHistogram := func(from, to int64) *histogram.Histogram {
+		h, err := histogram.New(1, 1000000, 3)
+		Expect(err).NotTo(HaveOccurred())
+		for v := from; v < to; v++ {
+			h.Record(v)
+		}
+		return h
+	}
+
+	It("finds no difference between equal distributions", func() {
+		d, p := compare.KolmogorovSmirnov(newHistogram(1000, 2000), newHistogram(1000, 2000))
+		Expect(d).To(BeZero())
+		Expect(p).To(Equal(1.0))
+	})
+
+	It("finds shifted distributions to differ", func() {
+		d, p := compare.KolmogorovSmirnov(newHistogram(1000, 2000), newHistogram(1100, 2100))
+		Expect(d).To(BeNumerically("~", 0.1, 0.01))
+		Expect(p).To(BeNumerically("<", 0.001))
+	})
+
+	It("does not find small samples of close distributions to differ", func() {
+		d, p := compare.KolmogorovSmirnov(newHistogram(1000, 1020), newHistogram(1001, 1021))
+		Expect(d).To(BeNumerically("~", 0.05, 0.001))
+		Expect(p).To(BeNumerically(">", 0.5))
+	})
+})
+
+var _ = Describe("RateDecrease", func() {
+	It("is not significant for equal rates", func() {
+		Expect(compare.RateDecrease(1000, 10, 1000, 10)).To(Equal(0.5))
+	})
+
+	It("is significant for a clear decrease", func() {
+		Expect(compare.RateDecrease(10000, 10, 9000, 10)).To(BeNumerically("<", 1e-6))
+	})
+
+	It("is not significant for an increase", func() {
+		Expect(compare.RateDecrease(9000, 10, 10000, 10)).To(BeNumerically(">", 0.99))
+	})
+})
@@ -0,0 +1,133 @@
+package main_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"throughputramp/analysis"
+	"throughputramp/histogram"
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/ginkgomon"
+)
+
+var _ = Describe("Compare", func() {
+	var (
+		runner                   *ginkgomon.Runner
+		baseline, candidate, tmp string
+		baselineFiles            map[string][]byte
+	)
+
+	// writeRun stores the summary and latency log of a single step run
+	// whose requests take latency in dir.
+	writeRun := func(dir string, latency time.Duration) map[string][]byte {
+		start := time.Date(2016, 12, 15, 23, 0, 0, 0, time.UTC)
+		result := loadgen.NewResult(loadgen.Step{Concurrency: 2}, start)
+		result.End = start.Add(10 * time.Second)
+		for i := 0; i < 1000; i++ {
+			result.Record(loadgen.Sample{StatusCode: 200, ResponseTime: latency + time.Duration(i)*time.Microsecond})
+		}
+
+		summaryJSON, err := json.Marshal(analysis.NewSummary([]analysis.StepSummary{analysis.Summarize(1, result)}, analysis.SLO{Percentile: 99}))
+		Expect(err).NotTo(HaveOccurred())
+		latencyLog := gbytes.NewBuffer()
+		lw, err := histogram.NewLogWriter(latencyLog, start)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lw.WriteInterval("step-1", result.Start, result.End, result.Latency)).To(Succeed())
+		latencyBytes := latencyLog.Contents()
+
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "summary.json"), summaryJSON, 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "latency.hlog"), latencyBytes, 0644)).To(Succeed())
+		return map[string][]byte{"summary.json": summaryJSON, "latency.hlog": latencyBytes}
+	}
+
+	compareRuns := func(args ...string) {
+		runner = ginkgomon.New(ginkgomon.Config{
+			Name:    "throughputramp-compare",
+			Command: exec.Command(binPath, append([]string{"compare"}, args...)...),
+		})
+		process := ifrit.Background(runner)
+		Eventually(process.Wait(), "5s").Should(Receive())
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmp, err = ioutil.TempDir("", "compare")
+		Expect(err).NotTo(HaveOccurred())
+		baseline = filepath.Join(tmp, "baseline")
+		candidate = filepath.Join(tmp, "candidate")
+		baselineFiles = writeRun(baseline, 10*time.Millisecond)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmp)).To(Succeed())
+	})
+
+	It("exits 0 when the candidate did not regress", func() {
+		writeRun(candidate, 10*time.Millisecond)
+		compareRuns(baseline, candidate)
+		Expect(runner.ExitCode()).To(Equal(0))
+		Expect(runner).To(gbytes.Say(`step 1 \(concurrency 2, rate limit 0\): ok`))
+		Expect(runner).To(gbytes.Say("no regressions in 1 steps"))
+	})
+
+	It("exits 1 with a report when the candidate regressed", func() {
+		writeRun(candidate, 20*time.Millisecond)
+		compareRuns("-latency-tolerance", "0.5", baseline, candidate)
+		Expect(runner.ExitCode()).To(Equal(1))
+		Expect(runner).To(gbytes.Say("REGRESSED"))
+		Expect(runner).To(gbytes.Say(`regression: p50 latency \+\d+\.\d% exceeds tolerance of \+50.0%`))
+	})
+
+	It("exits 2 when the results cannot be read", func() {
+		compareRuns(baseline, candidate)
+		Expect(runner.ExitCode()).To(Equal(2))
+		Expect(runner.Err()).To(gbytes.Say("loading candidate"))
+	})
+
+	It("exits 2 with usage when a run is missing", func() {
+		compareRuns(baseline)
+		Expect(runner.ExitCode()).To(Equal(2))
+		Expect(runner.Err()).To(gbytes.Say("Usage: throughputramp compare"))
+	})
+
+	Context("when a run is stored in S3", func() {
+		var testS3Server *ghttp.Server
+
+		BeforeEach(func() {
+			testS3Server = ghttp.NewServer()
+			testS3Server.RouteToHandler("GET", "/blah-bucket/summary-2016-12-15T23:00:00Z.json",
+				ghttp.RespondWith(http.StatusOK, baselineFiles["summary.json"]))
+			testS3Server.RouteToHandler("GET", "/blah-bucket/latency-2016-12-15T23:00:00Z.hlog",
+				ghttp.RespondWith(http.StatusOK, baselineFiles["latency.hlog"]))
+			writeRun(candidate, 10*time.Millisecond)
+		})
+
+		AfterEach(func() {
+			testS3Server.Close()
+		})
+
+		It("downloads its results", func() {
+			compareRuns(
+				"-s3-endpoint", testS3Server.URL(),
+				"-access-key-id", "ABCD",
+				"-secret-access-key", "ABCD",
+				"s3://blah-bucket/2016-12-15T23:00:00Z", candidate,
+			)
+			Expect(runner.ExitCode()).To(Equal(0))
+			Expect(runner).To(gbytes.Say("no regressions in 1 steps"))
+			Expect(testS3Server.ReceivedRequests()).To(HaveLen(2))
+		})
+	})
+})
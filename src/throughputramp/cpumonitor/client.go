@@ -0,0 +1,142 @@
+// Package cpumonitor is a client of the cpumonitor job, which samples the
+// CPU usage of the router's VM from a start request to a stop request.
+package cpumonitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Defaults of clients created with NewClient.
+const (
+	DefaultTimeout = 10 * time.Second
+	DefaultRetries = 3
+	DefaultBackoff = time.Second
+)
+
+// Sample is the CPU usage in percent at a point in time, of every CPU or of
+// all of them depending on the cpumonitor's configuration.
+type Sample struct {
+	Timestamp  time.Time `json:"Timestamp"`
+	Percentage []float64 `json:"Percentage"`
+}
+
+// Client calls the cpumonitor at URL. Every request is given Timeout to
+// complete, unless it is 0. Requests that fail or receive a server error are
+// retried up to Retries times, waiting Backoff before the first retry and
+// twice as long before each further one.
+type Client struct {
+	URL     string
+	Timeout time.Duration
+	Retries int
+	Backoff time.Duration
+	Client  *http.Client
+}
+
+// NewClient returns a client of the cpumonitor at rawURL with the default
+// timeout and retries. URLs without a scheme use http.
+func NewClient(rawURL string) (*Client, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cpumonitor URL: %s", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("cpumonitor URL %q must use http or https", rawURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("cpumonitor URL %q has no host", rawURL)
+	}
+	return &Client{
+		URL:     strings.TrimSuffix(u.String(), "/"),
+		Timeout: DefaultTimeout,
+		Retries: DefaultRetries,
+		Backoff: DefaultBackoff,
+	}, nil
+}
+
+// Start makes the cpumonitor start sampling.
+func (c *Client) Start(ctx context.Context) error {
+	_, err := c.call(ctx, "start")
+	return err
+}
+
+// Stop makes the cpumonitor stop sampling and returns the samples taken
+// since it started. A stop whose response was lost is not retried
+// successfully, because the cpumonitor already stopped.
+func (c *Client) Stop(ctx context.Context) ([]Sample, error) {
+	body, err := c.call(ctx, "stop")
+	if err != nil {
+		return nil, err
+	}
+	var samples []Sample
+	if err := json.Unmarshal(body, &samples); err != nil {
+		return nil, fmt.Errorf("parsing cpumonitor samples: %s", err)
+	}
+	return samples, nil
+}
+
+func (c *Client) call(ctx context.Context, path string) ([]byte, error) {
+	backoff := c.Backoff
+	for attempt := 1; ; attempt++ {
+		body, retry, err := c.do(ctx, path)
+		if err == nil || !retry || ctx.Err() != nil {
+			return body, err
+		}
+		if attempt > c.Retries {
+			if attempt > 1 {
+				err = fmt.Errorf("%s, giving up after %d attempts", err, attempt)
+			}
+			return nil, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// do sends a single request and reports whether it is worth retrying if it
+// failed.
+func (c *Client) do(ctx context.Context, path string) ([]byte, bool, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+"/"+path, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("cpumonitor %s: %s", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("cpumonitor %s: reading response: %s", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("cpumonitor %s: %s", path, resp.Status)
+		if message := strings.TrimSpace(string(body)); message != "" {
+			err = fmt.Errorf("cpumonitor %s: %s: %s", path, resp.Status, message)
+		}
+		return nil, resp.StatusCode >= 500, err
+	}
+	return body, false, nil
+}
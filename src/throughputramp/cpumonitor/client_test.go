@@ -0,0 +1,140 @@
+package cpumonitor_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"throughputramp/cpumonitor"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+const samplesJSON = `[
+{"Timestamp":"2016-12-15T15:00:47.575579693-08:00","Percentage":[12.5,13.5]},
+{"Timestamp":"2016-12-15T15:00:48.575579693-08:00","Percentage":[20.5,21.5]}
+]`
+
+var _ = Describe("Client", func() {
+	var (
+		server *ghttp.Server
+		client *cpumonitor.Client
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		var err error
+		client, err = cpumonitor.NewClient(server.URL() + "/")
+		Expect(err).NotTo(HaveOccurred())
+		client.Backoff = 10 * time.Millisecond
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("starts the cpumonitor", func() {
+		server.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest("GET", "/start"),
+			ghttp.RespondWith(http.StatusOK, "Collecting CPU stats\n"),
+		))
+		Expect(client.Start(context.Background())).To(Succeed())
+		Expect(server.ReceivedRequests()).To(HaveLen(1))
+	})
+
+	It("stops the cpumonitor and returns its samples", func() {
+		server.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest("GET", "/stop"),
+			ghttp.RespondWith(http.StatusOK, samplesJSON),
+		))
+		samples, err := client.Stop(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(samples).To(HaveLen(2))
+		Expect(samples[0].Timestamp.Equal(time.Date(2016, 12, 15, 23, 0, 47, 575579693, time.UTC))).To(BeTrue())
+		Expect(samples[1].Percentage).To(Equal([]float64{20.5, 21.5}))
+	})
+
+	It("retries server errors with backoff", func() {
+		server.AppendHandlers(
+			ghttp.RespondWith(http.StatusBadGateway, nil),
+			ghttp.RespondWith(http.StatusServiceUnavailable, nil),
+			ghttp.RespondWith(http.StatusOK, samplesJSON),
+		)
+		start := time.Now()
+		samples, err := client.Stop(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(samples).To(HaveLen(2))
+		Expect(time.Since(start)).To(BeNumerically(">=", 30*time.Millisecond))
+		Expect(server.ReceivedRequests()).To(HaveLen(3))
+	})
+
+	It("gives up after the retries", func() {
+		client.Retries = 1
+		server.AppendHandlers(
+			ghttp.RespondWith(http.StatusInternalServerError, "disk full\n"),
+			ghttp.RespondWith(http.StatusInternalServerError, "disk full\n"),
+		)
+		_, err := client.Stop(context.Background())
+		Expect(err).To(MatchError("cpumonitor stop: 500 Internal Server Error: disk full, giving up after 2 attempts"))
+		Expect(server.ReceivedRequests()).To(HaveLen(2))
+	})
+
+	It("does not retry client errors", func() {
+		server.AppendHandlers(ghttp.RespondWith(http.StatusBadRequest, "collector not running\n"))
+		_, err := client.Stop(context.Background())
+		Expect(err).To(MatchError("cpumonitor stop: 400 Bad Request: collector not running"))
+		Expect(server.ReceivedRequests()).To(HaveLen(1))
+	})
+
+	It("times out every request", func() {
+		client.Timeout = 50 * time.Millisecond
+		client.Retries = 0
+		server.AppendHandlers(func(rw http.ResponseWriter, req *http.Request) {
+			<-req.Context().Done()
+		})
+		start := time.Now()
+		err := client.Start(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("cpumonitor start: ")))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	It("stops retrying when the context is done", func() {
+		client.Backoff = time.Minute
+		server.AppendHandlers(ghttp.RespondWith(http.StatusInternalServerError, nil))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		Expect(client.Start(ctx)).To(MatchError("cpumonitor start: 500 Internal Server Error"))
+	})
+
+	It("fails on malformed samples", func() {
+		server.AppendHandlers(ghttp.RespondWith(http.StatusOK, "{"))
+		_, err := client.Stop(context.Background())
+		Expect(err).To(MatchError(HavePrefix("parsing cpumonitor samples: ")))
+	})
+
+	It("calls cpumonitors over https", func() {
+		tlsServer := ghttp.NewTLSServer()
+		defer tlsServer.Close()
+		tlsServer.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest("GET", "/start"),
+			ghttp.RespondWith(http.StatusOK, nil),
+		))
+		client, err := cpumonitor.NewClient(tlsServer.URL())
+		Expect(err).NotTo(HaveOccurred())
+		client.Client = tlsServer.HTTPTestServer.Client()
+		Expect(client.Start(context.Background())).To(Succeed())
+	})
+
+	It("uses http for URLs without a scheme and rejects other schemes", func() {
+		client, err := cpumonitor.NewClient("10.0.16.4:8080")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.URL).To(Equal("http://10.0.16.4:8080"))
+		Expect(client.Timeout).To(Equal(cpumonitor.DefaultTimeout))
+		Expect(client.Retries).To(Equal(cpumonitor.DefaultRetries))
+
+		_, err = cpumonitor.NewClient("ftp://10.0.16.4")
+		Expect(err).To(MatchError(`cpumonitor URL "ftp://10.0.16.4" must use http or https`))
+	})
+})
@@ -0,0 +1,13 @@
+package cpumonitor_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCPUMonitor(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CPUMonitor Suite")
+}
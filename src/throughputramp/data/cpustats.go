@@ -8,42 +8,38 @@ import (
 	"strconv"
 	"strings"
 	"time"
-)
-
-type cpuStat struct {
-	TimeStamp  time.Time `json:"Timestamp"`
-	Percentage []float64 `json:"Percentage"`
-}
-
-func (i *cpuStat) percentageString() string {
-	var results []string
-	for _, d := range i.Percentage {
-		results = append(results, strconv.FormatFloat(d, 'f', 6, 64))
-	}
-	return strings.Join(results, ",")
-}
 
-func (i *cpuStat) string() string {
-	timeStamp := i.TimeStamp.UTC().Format(time.RFC3339Nano)
-	return fmt.Sprintf("%s,%v", timeStamp, i.percentageString())
-}
+	"throughputramp/cpumonitor"
+)
 
 func GenerateCpuCSV(body []byte) ([]byte, error) {
 	if body == nil || len(body) == 0 {
 		return nil, errors.New("empty/nil body")
 	}
 
-	var results []cpuStat
+	var results []cpumonitor.Sample
 	err := json.Unmarshal(body, &results)
 	if err != nil {
 		return nil, fmt.Errorf("marshaling data: %s", err)
 	}
-	buf := bytes.NewBuffer(nil)
+	return CPUStatsCSV(results), nil
+}
 
-	buf.WriteString("timestamp" + strings.Repeat(",percentage", len(results[0].Percentage)))
-	for _, p := range results {
+// CPUStatsCSV returns the samples of a cpumonitor as CSV, with a percentage
+// column for every CPU it reported. It returns nil without samples.
+func CPUStatsCSV(samples []cpumonitor.Sample) []byte {
+	if len(samples) == 0 {
+		return nil
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("timestamp" + strings.Repeat(",percentage", len(samples[0].Percentage)))
+	for _, s := range samples {
 		buf.WriteByte('\n')
-		buf.WriteString(p.string())
+		buf.WriteString(s.Timestamp.UTC().Format(time.RFC3339Nano))
+		for _, p := range s.Percentage {
+			buf.WriteByte(',')
+			buf.WriteString(strconv.FormatFloat(p, 'f', 6, 64))
+		}
 	}
-	return buf.Bytes(), nil
+	return buf.Bytes()
 }
@@ -1,6 +1,9 @@
 package data_test
 
 import (
+	"time"
+
+	"throughputramp/cpumonitor"
 	"throughputramp/data"
 
 	. "github.com/onsi/ginkgo"
@@ -62,3 +65,19 @@ var _ = Describe("GenerateCpuCSV", func() {
 		})
 	})
 })
+
+var _ = Describe("CPUStatsCSV", func() {
+	It("writes a row for every sample", func() {
+		samples := []cpumonitor.Sample{
+			{Timestamp: time.Date(2016, 12, 15, 23, 0, 47, 0, time.UTC), Percentage: []float64{12.5, 13.5}},
+			{Timestamp: time.Date(2016, 12, 15, 23, 0, 48, 0, time.UTC), Percentage: []float64{20.5, 21.5}},
+		}
+		Expect(string(data.CPUStatsCSV(samples))).To(Equal("timestamp,percentage,percentage\n" +
+			"2016-12-15T23:00:47Z,12.500000,13.500000\n" +
+			"2016-12-15T23:00:48Z,20.500000,21.500000"))
+	})
+
+	It("returns nil without samples", func() {
+		Expect(data.CPUStatsCSV(nil)).To(BeNil())
+	})
+})
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"time"
+
+	"throughputramp/loadgen"
+)
+
+// RunMetadata describes how a dataset was produced, so that it can be
+// reproduced and compared with other runs. In runs against several routers
+// each target has its own dataset: Router and Target describe the router of
+// the dataset and Targets all routers of the run. HeyVersion is the version
+// of hey in runs with the hey generator. Agents lists the load agents of
+// distributed runs. Incomplete is set when the run was interrupted
+// before all steps ran, and ResumedAt lists the times an interrupted run was
+// continued from a checkpoint.
+type RunMetadata struct {
+	ThroughputrampVersion string            `json:"throughputramp_version"`
+	GoVersion             string            `json:"go_version"`
+	HeyVersion            string            `json:"hey_version,omitempty"`
+	Generator             string            `json:"generator"`
+	Router                string            `json:"router"`
+	Host                  string            `json:"host"`
+	Target                string            `json:"target,omitempty"`
+	Targets               []TargetMetadata  `json:"targets,omitempty"`
+	TargetOrder           string            `json:"target_order,omitempty"`
+	Agents                []string          `json:"agents,omitempty"`
+	RoutingReleaseVersion string            `json:"routing_release_version,omitempty"`
+	RouteTableSize        int               `json:"route_table_size,omitempty"`
+	CPUMonitor            *CPUMonitorConfig `json:"cpumonitor,omitempty"`
+	Flags                 map[string]string `json:"flags"`
+	Steps                 []StepMetadata    `json:"steps"`
+	StartTime             time.Time         `json:"start_time"`
+	EndTime               time.Time         `json:"end_time"`
+	Incomplete            bool              `json:"incomplete,omitempty"`
+	ResumedAt             []time.Time       `json:"resumed_at,omitempty"`
+}
+
+type TargetMetadata struct {
+	Name   string `json:"name"`
+	Router string `json:"router"`
+}
+
+type CPUMonitorConfig struct {
+	URL               string `json:"url"`
+	RunIntervalMillis int    `json:"run_interval_ms,omitempty"`
+	PerCPU            bool   `json:"per_cpu"`
+}
+
+type StepMetadata struct {
+	Requests    int     `json:"requests"`
+	Concurrency int     `json:"concurrency"`
+	RateLimit   int     `json:"rate_limit"`
+	Rate        int     `json:"rate"`
+	Duration    float64 `json:"duration_seconds"`
+	Warmup      float64 `json:"warmup_seconds"`
+}
+
+func NewStepMetadata(steps []loadgen.Step) []StepMetadata {
+	metadata := make([]StepMetadata, 0, len(steps))
+	for _, s := range steps {
+		metadata = append(metadata, StepMetadata{
+			Requests:    s.NumRequests,
+			Concurrency: s.Concurrency,
+			RateLimit:   s.RateLimit,
+			Rate:        s.Rate,
+			Duration:    s.Duration.Seconds(),
+			Warmup:      s.Warmup.Seconds(),
+		})
+	}
+	return metadata
+}
@@ -0,0 +1,32 @@
+package data_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"throughputramp/data"
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RunMetadata", func() {
+	It("records the settings of every step", func() {
+		steps := data.NewStepMetadata([]loadgen.Step{
+			{NumRequests: 1000, Concurrency: 2, RateLimit: 100},
+			{Concurrency: 50, Rate: 500, Duration: 30 * time.Second, Warmup: 5 * time.Second},
+		})
+		Expect(steps).To(Equal([]data.StepMetadata{
+			{Requests: 1000, Concurrency: 2, RateLimit: 100},
+			{Concurrency: 50, Rate: 500, Duration: 30, Warmup: 5},
+		}))
+	})
+
+	It("leaves out the cpumonitor when it is not used", func() {
+		metadata, err := json.Marshal(data.RunMetadata{Router: "http://10.0.0.1:80"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(metadata)).To(ContainSubstring(`"router":"http://10.0.0.1:80"`))
+		Expect(string(metadata)).NotTo(ContainSubstring("cpumonitor"))
+	})
+})
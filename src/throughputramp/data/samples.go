@@ -0,0 +1,85 @@
+package data
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"time"
+
+	"throughputramp/loadgen"
+)
+
+const sampleCSVHeader = "step,concurrency,rate-limit,rate," +
+	"start-time,response-time,status-code,error,connection-reused," +
+	"dns,connect,request-write,response-delay,response-read,schedule-delay,agent,protocol,tls-handshake,tls-resumed,host\n"
+
+// SampleWriter writes the samples of all steps of a run as a single CSV
+// document, one row per request, tagged with the step that sent it. All
+// durations are in seconds. Failed requests have an error class, see
+// loadgen.ErrorClass, and a status code of 0. The agent column names the load
+// agent that sent the request in distributed runs, the protocol column the
+// protocol of the response, such as HTTP/1.1 or HTTP/2.0. The TLS handshake
+// is 0 for requests that did not open a TLS connection. The host column is the
+// Host header of the request.
+type SampleWriter struct {
+	w             io.Writer
+	headerWritten bool
+}
+
+func NewSampleWriter(w io.Writer) *SampleWriter {
+	return &SampleWriter{w: w}
+}
+
+// Resume continues a document whose header was already written, such as one
+// restored from a checkpoint.
+func (sw *SampleWriter) Resume() {
+	sw.headerWritten = true
+}
+
+func (sw *SampleWriter) Write(step int, result loadgen.Result) error {
+	buf := new(bytes.Buffer)
+	if !sw.headerWritten {
+		buf.WriteString(sampleCSVHeader)
+	}
+
+	stepColumns := strconv.Itoa(step) + "," +
+		strconv.Itoa(result.Step.Concurrency) + "," +
+		strconv.Itoa(result.Step.RateLimit) + "," +
+		strconv.Itoa(result.Step.Rate) + ","
+	for _, s := range result.Samples {
+		buf.WriteString(stepColumns)
+		buf.WriteString(s.Start.UTC().Format(time.RFC3339Nano))
+		for _, field := range []string{
+			seconds(s.ResponseTime),
+			strconv.Itoa(s.StatusCode),
+			loadgen.ErrorClass(s.Err),
+			strconv.FormatBool(s.ConnReused),
+			seconds(s.DNS),
+			seconds(s.Connect),
+			seconds(s.RequestWrite),
+			seconds(s.ResponseDelay),
+			seconds(s.ResponseRead),
+			seconds(s.ScheduleDelay),
+			s.Agent,
+			s.Protocol,
+			seconds(s.TLSHandshake),
+			strconv.FormatBool(s.TLSResumed),
+			s.Host,
+		} {
+			buf.WriteByte(',')
+			buf.WriteString(field)
+		}
+		buf.WriteByte('\n')
+	}
+
+	_, err := buf.WriteTo(sw.w)
+	if err != nil {
+		return err
+	}
+	sw.headerWritten = true
+	return nil
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 6, 64)
+}
@@ -0,0 +1,78 @@
+package data_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"time"
+
+	"throughputramp/data"
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const sampleHeader = "step,concurrency,rate-limit,rate,start-time,response-time,status-code,error,connection-reused,dns,connect,request-write,response-delay,response-read,schedule-delay,agent,protocol,tls-handshake,tls-resumed,host\n"
+
+var _ = Describe("SampleWriter", func() {
+	var (
+		buf    *bytes.Buffer
+		writer *data.SampleWriter
+		start  time.Time
+	)
+
+	BeforeEach(func() {
+		buf = new(bytes.Buffer)
+		writer = data.NewSampleWriter(buf)
+		start = time.Date(2016, 12, 15, 23, 0, 47, 575579693, time.UTC)
+	})
+
+	It("writes the header once, even for steps without samples", func() {
+		Expect(writer.Write(1, loadgen.Result{})).To(Succeed())
+		Expect(writer.Write(2, loadgen.Result{})).To(Succeed())
+		Expect(buf.String()).To(Equal(sampleHeader))
+	})
+
+	It("does not write the header when resuming a document", func() {
+		writer.Resume()
+		Expect(writer.Write(3, loadgen.Result{})).To(Succeed())
+		Expect(buf.String()).To(BeEmpty())
+	})
+
+	It("tags every sample with its step and writes its status, protocol, error class, connection reuse, phases, TLS handshake and host", func() {
+		Expect(writer.Write(1, loadgen.Result{
+			Step: loadgen.Step{Concurrency: 2, RateLimit: 100},
+			Samples: []loadgen.Sample{{
+				Start:         start,
+				ResponseTime:  1500 * time.Microsecond,
+				StatusCode:    200,
+				Host:          "sample-7.apps.com",
+				Protocol:      "HTTP/2.0",
+				ConnReused:    true,
+				RequestWrite:  100 * time.Microsecond,
+				ResponseDelay: time.Millisecond,
+				ResponseRead:  400 * time.Microsecond,
+			}},
+		})).To(Succeed())
+		Expect(writer.Write(2, loadgen.Result{
+			Step: loadgen.Step{Concurrency: 50, Rate: 1000},
+			Samples: []loadgen.Sample{{
+				Start:         start,
+				ResponseTime:  time.Second,
+				DNS:           2 * time.Millisecond,
+				Connect:       time.Second,
+				TLSHandshake:  500 * time.Millisecond,
+				TLSResumed:    true,
+				ScheduleDelay: 3 * time.Millisecond,
+				Agent:         "10.0.0.7:8090",
+				Err:           &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			}},
+		})).To(Succeed())
+
+		Expect(buf.String()).To(Equal(sampleHeader +
+			"1,2,100,0,2016-12-15T23:00:47.575579693Z,0.001500,200,,true,0.000000,0.000000,0.000100,0.001000,0.000400,0.000000,,HTTP/2.0,0.000000,false,sample-7.apps.com\n" +
+			"2,50,0,1000,2016-12-15T23:00:47.575579693Z,1.000000,0,connect,false,0.002000,1.000000,0.000000,0.000000,0.000000,0.003000,10.0.0.7:8090,,0.500000,true,\n",
+		))
+	})
+})
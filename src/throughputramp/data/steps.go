@@ -0,0 +1,68 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"throughputramp/analysis"
+)
+
+const stepCSVColumns = "start-time,end-time,concurrency,rate-limit,rate,warmup," +
+	"requests,errors,connect-errors,non-2xx,throughput,p50,p90,p99,p99.9,max," +
+	"connections-opened,connections-closed,upgrades,upgrade-mean,drops,incomplete\n"
+
+// GenerateStepCSV writes one row per step with its settings, the boundaries
+// of its measured window, its throughput and latency percentiles, the
+// connections opened and closed during it, for streams, the upgrades, their
+// mean latency and the drops, and whether it was interrupted. Latencies are
+// in seconds.
+func GenerateStepCSV(summaries []analysis.StepSummary) []byte {
+	buf := bytes.NewBufferString("step," + stepCSVColumns)
+	for _, s := range summaries {
+		fmt.Fprintf(buf, "%d,", s.Step)
+		writeStepColumns(buf, s)
+	}
+	return buf.Bytes()
+}
+
+// GenerateAgentCSV writes one row per step and load agent of a distributed
+// run with the share of the step the agent ran, in the columns of
+// GenerateStepCSV.
+func GenerateAgentCSV(summaries []analysis.StepSummary) []byte {
+	buf := bytes.NewBufferString("step,agent," + stepCSVColumns)
+	for _, s := range summaries {
+		for _, a := range s.Agents {
+			fmt.Fprintf(buf, "%d,%s,", s.Step, a.Agent)
+			writeStepColumns(buf, a)
+		}
+	}
+	return buf.Bytes()
+}
+
+func writeStepColumns(buf *bytes.Buffer, s analysis.StepSummary) {
+	fmt.Fprintf(buf, "%s,%s,%d,%d,%d,%f,%d,%d,%d,%d,%f,%f,%f,%f,%f,%f,%d,%d,%d,%f,%d,%t\n",
+		s.Start.UTC().Format(time.RFC3339Nano),
+		s.End.UTC().Format(time.RFC3339Nano),
+		s.Concurrency,
+		s.RateLimit,
+		s.Rate,
+		s.Warmup,
+		s.Requests,
+		s.Errors,
+		s.ConnectErrors,
+		s.NonSuccess,
+		s.Throughput,
+		s.P50/1000,
+		s.P90/1000,
+		s.P99/1000,
+		s.P999/1000,
+		s.Max/1000,
+		s.ConnectionsOpened,
+		s.ConnectionsClosed,
+		s.Upgrades,
+		s.UpgradeMean/1000,
+		s.Drops,
+		s.Incomplete,
+	)
+}
@@ -0,0 +1,69 @@
+package data_test
+
+import (
+	"time"
+
+	"throughputramp/analysis"
+	"throughputramp/data"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GenerateStepCSV", func() {
+	It("records the boundaries, settings and summary of each step", func() {
+		start := time.Date(2016, 12, 15, 23, 0, 0, 0, time.UTC)
+		summaries := []analysis.StepSummary{
+			{
+				Step:        1,
+				Start:       start,
+				End:         start.Add(30 * time.Second),
+				Concurrency: 2,
+				RateLimit:   100,
+				Warmup:      5,
+				Requests:    3000,
+				Errors:      2,
+				NonSuccess:  3,
+				Throughput:  99.9,
+				P50:         1.5,
+				P90:         2,
+				P99:         10,
+				P999:        20,
+				Max:         25,
+
+				ConnectionsOpened: 2,
+				ConnectionsClosed: 1,
+			},
+			{
+				Step:          2,
+				Start:         start.Add(time.Minute),
+				End:           start.Add(90 * time.Second),
+				Concurrency:   50,
+				Rate:          1000,
+				ConnectErrors: 1,
+				Upgrades:      50,
+				UpgradeMean:   12.5,
+				Drops:         3,
+				Incomplete:    true,
+			},
+		}
+		Expect(string(data.GenerateStepCSV(summaries))).To(Equal(`step,start-time,end-time,concurrency,rate-limit,rate,warmup,requests,errors,connect-errors,non-2xx,throughput,p50,p90,p99,p99.9,max,connections-opened,connections-closed,upgrades,upgrade-mean,drops,incomplete
+1,2016-12-15T23:00:00Z,2016-12-15T23:00:30Z,2,100,0,5.000000,3000,2,0,3,99.900000,0.001500,0.002000,0.010000,0.020000,0.025000,2,1,0,0.000000,0,false
+2,2016-12-15T23:01:00Z,2016-12-15T23:01:30Z,50,0,1000,0.000000,0,0,1,0,0.000000,0.000000,0.000000,0.000000,0.000000,0.000000,0,0,50,0.012500,3,true
+`))
+	})
+
+	It("writes the share of every agent", func() {
+		start := time.Date(2016, 12, 15, 23, 0, 0, 0, time.UTC)
+		summaries := []analysis.StepSummary{
+			{Step: 1, Concurrency: 3, Agents: []analysis.StepSummary{
+				{Step: 1, Agent: "10.0.0.7:8090", Start: start, End: start.Add(time.Second), Concurrency: 2, Requests: 10, Throughput: 10, P50: 1},
+				{Step: 1, Agent: "10.0.0.8:8090", Start: start, End: start.Add(time.Second), Concurrency: 1, Requests: 5, Throughput: 5, P50: 2},
+			}},
+		}
+		Expect(string(data.GenerateAgentCSV(summaries))).To(Equal(`step,agent,start-time,end-time,concurrency,rate-limit,rate,warmup,requests,errors,connect-errors,non-2xx,throughput,p50,p90,p99,p99.9,max,connections-opened,connections-closed,upgrades,upgrade-mean,drops,incomplete
+1,10.0.0.7:8090,2016-12-15T23:00:00Z,2016-12-15T23:00:01Z,2,0,0,0.000000,10,0,0,0,10.000000,0.001000,0.000000,0.000000,0.000000,0.000000,0,0,0,0.000000,0,false
+1,10.0.0.8:8090,2016-12-15T23:00:00Z,2016-12-15T23:00:01Z,1,0,0,0.000000,5,0,0,0,5.000000,0.002000,0.000000,0.000000,0.000000,0.000000,0,0,0,0.000000,0,false
+`))
+	})
+})
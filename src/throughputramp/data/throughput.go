@@ -0,0 +1,68 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"throughputramp/loadgen"
+)
+
+const throughputCSVHeader = "step,start-time,throughput\n"
+
+// ThroughputWriter writes the throughput of all steps of a run over time as a
+// single CSV document. Each row holds the requests per second that received
+// a response in one interval of a step's measured window. The last interval
+// of a step is averaged over its actual length.
+type ThroughputWriter struct {
+	w             io.Writer
+	interval      time.Duration
+	headerWritten bool
+}
+
+func NewThroughputWriter(w io.Writer, interval time.Duration) *ThroughputWriter {
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return &ThroughputWriter{w: w, interval: interval}
+}
+
+// Resume continues a document whose header was already written, such as one
+// restored from a checkpoint.
+func (tw *ThroughputWriter) Resume() {
+	tw.headerWritten = true
+}
+
+func (tw *ThroughputWriter) Write(step int, result loadgen.Result) error {
+	buf := new(bytes.Buffer)
+	if !tw.headerWritten {
+		buf.WriteString(throughputCSVHeader)
+	}
+
+	perInterval := int(tw.interval / time.Second)
+	window := result.End.Sub(result.Start)
+	for i := 0; i < len(result.Completed); i += perInterval {
+		count := 0
+		for j := i; j < i+perInterval && j < len(result.Completed); j++ {
+			count += result.Completed[j]
+		}
+		offset := time.Duration(i) * time.Second
+		length := tw.interval
+		if window > offset && window-offset < length {
+			length = window - offset
+		}
+		fmt.Fprintf(buf, "%d,%s,%f\n",
+			step,
+			result.Start.Add(offset).UTC().Format(time.RFC3339Nano),
+			float64(count)/length.Seconds(),
+		)
+	}
+
+	_, err := buf.WriteTo(tw.w)
+	if err != nil {
+		return err
+	}
+	tw.headerWritten = true
+	return nil
+}
@@ -0,0 +1,57 @@
+package data_test
+
+import (
+	"bytes"
+	"time"
+
+	"throughputramp/data"
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ThroughputWriter", func() {
+	var (
+		buf   *bytes.Buffer
+		start time.Time
+	)
+
+	BeforeEach(func() {
+		buf = new(bytes.Buffer)
+		start = time.Date(2016, 12, 15, 23, 0, 0, 0, time.UTC)
+	})
+
+	It("writes the header once, even for steps without responses", func() {
+		writer := data.NewThroughputWriter(buf, time.Second)
+		Expect(writer.Write(1, loadgen.Result{})).To(Succeed())
+		Expect(writer.Write(2, loadgen.Result{})).To(Succeed())
+		Expect(buf.String()).To(Equal("step,start-time,throughput\n"))
+	})
+
+	It("does not write the header when resuming a document", func() {
+		writer := data.NewThroughputWriter(buf, time.Second)
+		writer.Resume()
+		Expect(writer.Write(3, loadgen.Result{})).To(Succeed())
+		Expect(buf.String()).To(BeEmpty())
+	})
+
+	It("averages the completed requests over each interval", func() {
+		writer := data.NewThroughputWriter(buf, 2*time.Second)
+		Expect(writer.Write(1, loadgen.Result{
+			Start:     start,
+			End:       start.Add(5 * time.Second),
+			Completed: []int{10, 20, 30, 50, 40},
+		})).To(Succeed())
+		Expect(writer.Write(2, loadgen.Result{
+			Start:     start.Add(10 * time.Second),
+			End:       start.Add(11500 * time.Millisecond),
+			Completed: []int{100, 50},
+		})).To(Succeed())
+		Expect(buf.String()).To(Equal("step,start-time,throughput\n" +
+			"1,2016-12-15T23:00:00Z,15.000000\n" +
+			"1,2016-12-15T23:00:02Z,40.000000\n" +
+			"1,2016-12-15T23:00:04Z,40.000000\n" +
+			"2,2016-12-15T23:00:10Z,100.000000\n"))
+	})
+})
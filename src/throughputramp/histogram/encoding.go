@@ -0,0 +1,186 @@
+package histogram
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+const (
+	encodingCookie           = 0x1c849303 | 0x10
+	compressedEncodingCookie = 0x1c849304 | 0x10
+	encodingHeaderSize       = 40
+)
+
+// Encode returns the histogram in the base64 encoded, compressed V2 format
+// used by HdrHistogram logs.
+func (h *Histogram) Encode() ([]byte, error) {
+	payload := new(bytes.Buffer)
+	limit := 0
+	if h.totalCount > 0 {
+		limit = h.countsIndex(h.max) + 1
+	}
+	for i := 0; i < limit; {
+		if h.counts[i] != 0 {
+			putZigZag(payload, h.counts[i])
+			i++
+			continue
+		}
+		zeros := 0
+		for i < limit && h.counts[i] == 0 {
+			zeros++
+			i++
+		}
+		if zeros > 1 {
+			putZigZag(payload, -int64(zeros))
+		} else {
+			putZigZag(payload, 0)
+		}
+	}
+
+	uncompressed := new(bytes.Buffer)
+	header := []interface{}{
+		int32(encodingCookie),
+		int32(payload.Len()),
+		int32(0), // normalizing index offset
+		int32(h.significantDigits),
+		h.lowest,
+		h.highest,
+		float64(1), // integer to double conversion ratio
+	}
+	for _, field := range header {
+		if err := binary.Write(uncompressed, binary.BigEndian, field); err != nil {
+			return nil, err
+		}
+	}
+	uncompressed.Write(payload.Bytes())
+
+	compressed := new(bytes.Buffer)
+	w, err := zlib.NewWriterLevel(compressed, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(uncompressed.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	encoded := new(bytes.Buffer)
+	binary.Write(encoded, binary.BigEndian, int32(compressedEncodingCookie))
+	binary.Write(encoded, binary.BigEndian, int32(compressed.Len()))
+	encoded.Write(compressed.Bytes())
+	return []byte(base64.StdEncoding.EncodeToString(encoded.Bytes())), nil
+}
+
+// Decode parses a histogram encoded in the compressed V2 format.
+func Decode(encoded []byte) (*Histogram, error) {
+	decoded, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) < 8 {
+		return nil, errors.New("encoded histogram is too short")
+	}
+	if cookie := binary.BigEndian.Uint32(decoded); cookie&^0xf0 != compressedEncodingCookie&^0xf0 {
+		return nil, fmt.Errorf("unsupported histogram encoding %#x", cookie)
+	}
+	length := int(binary.BigEndian.Uint32(decoded[4:]))
+	if length > len(decoded)-8 {
+		return nil, errors.New("encoded histogram is truncated")
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(decoded[8 : 8+length]))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	uncompressed, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(uncompressed) < encodingHeaderSize {
+		return nil, errors.New("encoded histogram header is truncated")
+	}
+	if cookie := binary.BigEndian.Uint32(uncompressed); cookie&^0xf0 != encodingCookie&^0xf0 {
+		return nil, fmt.Errorf("unsupported histogram encoding %#x", cookie)
+	}
+	payloadLength := int(binary.BigEndian.Uint32(uncompressed[4:]))
+	significantDigits := int(binary.BigEndian.Uint32(uncompressed[12:]))
+	lowest := int64(binary.BigEndian.Uint64(uncompressed[16:]))
+	highest := int64(binary.BigEndian.Uint64(uncompressed[24:]))
+	ratio := math.Float64frombits(binary.BigEndian.Uint64(uncompressed[32:]))
+	if ratio != 1 {
+		return nil, errors.New("histograms of floating point values are not supported")
+	}
+	payload := uncompressed[encodingHeaderSize:]
+	if payloadLength != len(payload) {
+		return nil, errors.New("encoded histogram payload is truncated")
+	}
+
+	h, err := New(lowest, highest, significantDigits)
+	if err != nil {
+		return nil, err
+	}
+	index := 0
+	for len(payload) > 0 {
+		count, n := zigZag(payload)
+		if n == 0 {
+			return nil, errors.New("encoded histogram payload is malformed")
+		}
+		payload = payload[n:]
+		if count < 0 {
+			index += int(-count)
+			continue
+		}
+		if index >= len(h.counts) {
+			return nil, errors.New("encoded histogram has more counts than its range")
+		}
+		if count > 0 {
+			h.RecordN(h.valueFromIndex(index), count)
+		}
+		index++
+	}
+	return h, nil
+}
+
+// putZigZag writes v as a ZigZag encoded LEB128 number of at most 9 bytes,
+// the last of which holds 8 bits.
+func putZigZag(buf *bytes.Buffer, v int64) {
+	u := uint64(v<<1) ^ uint64(v>>63)
+	for i := 0; i < 8; i++ {
+		if u>>7 == 0 {
+			buf.WriteByte(byte(u))
+			return
+		}
+		buf.WriteByte(byte(u&0x7f | 0x80))
+		u >>= 7
+	}
+	buf.WriteByte(byte(u))
+}
+
+// zigZag reads a number written by putZigZag and returns it together with the
+// number of bytes read, which is 0 if b is too short.
+func zigZag(b []byte) (int64, int) {
+	var u uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			u |= uint64(b[i]) << 56
+			return int64(u>>1) ^ -int64(u&1), 9
+		}
+		u |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i]&0x80 == 0 {
+			return int64(u>>1) ^ -int64(u&1), i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,217 @@
+// Package histogram implements HDR histograms that record values with a fixed
+// number of significant digits across a wide range, and their encoding in the
+// HdrHistogram log format.
+package histogram
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Histogram counts values between Lowest and Highest. Every value is
+// recorded with SignificantDigits significant decimal digits of precision.
+type Histogram struct {
+	lowest            int64
+	highest           int64
+	significantDigits int
+
+	unitMagnitude               uint
+	subBucketHalfCountMagnitude uint
+	subBucketCount              int
+	subBucketHalfCount          int
+	subBucketMask               int64
+
+	totalCount int64
+	min, max   int64
+	counts     []int64
+}
+
+// New returns an empty histogram for values from lowest (at least 1) to
+// highest (at least twice lowest) with 1 to 5 significant digits.
+func New(lowest, highest int64, significantDigits int) (*Histogram, error) {
+	if lowest < 1 {
+		return nil, fmt.Errorf("lowest value %d must be at least 1", lowest)
+	}
+	if highest < 2*lowest {
+		return nil, fmt.Errorf("highest value %d must be at least twice the lowest value %d", highest, lowest)
+	}
+	if significantDigits < 1 || significantDigits > 5 {
+		return nil, fmt.Errorf("significant digits %d must be between 1 and 5", significantDigits)
+	}
+
+	largestValueWithSingleUnitResolution := 2 * math.Pow10(significantDigits)
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(largestValueWithSingleUnitResolution)))
+	h := &Histogram{
+		lowest:                      lowest,
+		highest:                     highest,
+		significantDigits:           significantDigits,
+		unitMagnitude:               uint(math.Floor(math.Log2(float64(lowest)))),
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		subBucketCount:              1 << subBucketCountMagnitude,
+		min:                         math.MaxInt64,
+	}
+	h.subBucketHalfCount = h.subBucketCount / 2
+	h.subBucketMask = int64(h.subBucketCount-1) << h.unitMagnitude
+
+	bucketCount := 1
+	smallestUntrackableValue := int64(h.subBucketCount) << h.unitMagnitude
+	for smallestUntrackableValue <= highest {
+		if smallestUntrackableValue > math.MaxInt64/2 {
+			bucketCount++
+			break
+		}
+		smallestUntrackableValue <<= 1
+		bucketCount++
+	}
+	h.counts = make([]int64, (bucketCount+1)*h.subBucketHalfCount)
+	return h, nil
+}
+
+// Record counts value once.
+func (h *Histogram) Record(value int64) error {
+	return h.RecordN(value, 1)
+}
+
+// RecordN counts value n times.
+func (h *Histogram) RecordN(value, n int64) error {
+	if value < 0 || value > h.highest {
+		return fmt.Errorf("value %d is outside of the histogram range up to %d", value, h.highest)
+	}
+	h.counts[h.countsIndex(value)] += n
+	h.totalCount += n
+	if value < h.min {
+		h.min = value
+	}
+	if value > h.max {
+		h.max = value
+	}
+	return nil
+}
+
+// Merge adds all values recorded in other to h.
+func (h *Histogram) Merge(other *Histogram) error {
+	for i, count := range other.counts {
+		if count == 0 {
+			continue
+		}
+		if err := h.RecordN(other.valueFromIndex(i), count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset removes all recorded values.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.totalCount = 0
+	h.min, h.max = math.MaxInt64, 0
+}
+
+func (h *Histogram) Lowest() int64          { return h.lowest }
+func (h *Histogram) Highest() int64         { return h.highest }
+func (h *Histogram) SignificantDigits() int { return h.significantDigits }
+func (h *Histogram) TotalCount() int64      { return h.totalCount }
+
+// Max returns the largest value that is equivalent to the largest recorded
+// value, or 0 if the histogram is empty.
+func (h *Histogram) Max() int64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return h.highestEquivalentValue(h.max)
+}
+
+// Min returns the smallest value that is equivalent to the smallest recorded
+// value, or 0 if the histogram is empty.
+func (h *Histogram) Min() int64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return h.lowestEquivalentValue(h.min)
+}
+
+// ValueAtPercentile returns the largest value that the given percentile
+// (0-100) of the recorded values are equivalent to or below.
+func (h *Histogram) ValueAtPercentile(p float64) int64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	if p > 100 {
+		p = 100
+	}
+	countAtPercentile := int64(p/100*float64(h.totalCount) + 0.5)
+	if countAtPercentile < 1 {
+		countAtPercentile = 1
+	}
+	var total int64
+	for i, count := range h.counts {
+		total += count
+		if total >= countAtPercentile {
+			return h.highestEquivalentValue(h.valueFromIndex(i))
+		}
+	}
+	return 0
+}
+
+// Bucket counts the recorded values equivalent to Value, the largest of them.
+type Bucket struct {
+	Value int64
+	Count int64
+}
+
+// Buckets returns the non-empty buckets of the histogram in ascending order.
+func (h *Histogram) Buckets() []Bucket {
+	var buckets []Bucket
+	for i, count := range h.counts {
+		if count > 0 {
+			buckets = append(buckets, Bucket{
+				Value: h.highestEquivalentValue(h.valueFromIndex(i)),
+				Count: count,
+			})
+		}
+	}
+	return buckets
+}
+
+func (h *Histogram) bucketIndex(value int64) int {
+	pow2Ceiling := 64 - bits.LeadingZeros64(uint64(value|h.subBucketMask))
+	return pow2Ceiling - int(h.unitMagnitude) - int(h.subBucketHalfCountMagnitude+1)
+}
+
+func (h *Histogram) subBucketIndex(value int64, bucketIndex int) int {
+	return int(value >> (uint(bucketIndex) + h.unitMagnitude))
+}
+
+func (h *Histogram) countsIndex(value int64) int {
+	bucketIndex := h.bucketIndex(value)
+	subBucketIndex := h.subBucketIndex(value, bucketIndex)
+	return (bucketIndex+1)<<h.subBucketHalfCountMagnitude + subBucketIndex - h.subBucketHalfCount
+}
+
+func (h *Histogram) valueFromIndex(index int) int64 {
+	bucketIndex := index>>h.subBucketHalfCountMagnitude - 1
+	subBucketIndex := index&(h.subBucketHalfCount-1) + h.subBucketHalfCount
+	if bucketIndex < 0 {
+		subBucketIndex -= h.subBucketHalfCount
+		bucketIndex = 0
+	}
+	return int64(subBucketIndex) << (uint(bucketIndex) + h.unitMagnitude)
+}
+
+func (h *Histogram) lowestEquivalentValue(value int64) int64 {
+	bucketIndex := h.bucketIndex(value)
+	subBucketIndex := h.subBucketIndex(value, bucketIndex)
+	return int64(subBucketIndex) << (uint(bucketIndex) + h.unitMagnitude)
+}
+
+func (h *Histogram) highestEquivalentValue(value int64) int64 {
+	bucketIndex := h.bucketIndex(value)
+	if h.subBucketIndex(value, bucketIndex) >= h.subBucketCount {
+		bucketIndex++
+	}
+	return h.lowestEquivalentValue(value) + int64(1)<<(uint(bucketIndex)+h.unitMagnitude) - 1
+}
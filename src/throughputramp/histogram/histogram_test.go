@@ -0,0 +1,172 @@
+package histogram_test
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"throughputramp/histogram"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Histogram", func() {
+	var h *histogram.Histogram
+
+	BeforeEach(func() {
+		var err error
+		h, err = histogram.New(1, 3600*1000*1000, 3)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects invalid ranges", func() {
+		_, err := histogram.New(0, 1000, 3)
+		Expect(err).To(HaveOccurred())
+		_, err = histogram.New(10, 15, 3)
+		Expect(err).To(HaveOccurred())
+		_, err = histogram.New(1, 1000, 6)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("computes percentiles within the configured precision", func() {
+		for i := int64(1); i <= 100000; i++ {
+			Expect(h.Record(i)).To(Succeed())
+		}
+		Expect(h.TotalCount()).To(Equal(int64(100000)))
+		Expect(h.ValueAtPercentile(50)).To(BeNumerically("~", 50000, 50))
+		Expect(h.ValueAtPercentile(99)).To(BeNumerically("~", 99000, 99))
+		Expect(h.ValueAtPercentile(99.9)).To(BeNumerically("~", 99900, 100))
+		Expect(h.Max()).To(BeNumerically("~", 100000, 100))
+		Expect(h.Min()).To(Equal(int64(1)))
+	})
+
+	It("is exact for small values", func() {
+		h.RecordN(7, 3)
+		h.Record(9)
+		Expect(h.ValueAtPercentile(50)).To(Equal(int64(7)))
+		Expect(h.ValueAtPercentile(100)).To(Equal(int64(9)))
+	})
+
+	It("rejects values outside of its range", func() {
+		Expect(h.Record(-1)).NotTo(Succeed())
+		Expect(h.Record(3600*1000*1000 + 1)).NotTo(Succeed())
+		Expect(h.TotalCount()).To(BeZero())
+	})
+
+	It("merges other histograms", func() {
+		other, err := histogram.New(1, 3600*1000*1000, 3)
+		Expect(err).NotTo(HaveOccurred())
+		h.Record(1000)
+		other.RecordN(2000, 3)
+		Expect(h.Merge(other)).To(Succeed())
+		Expect(h.TotalCount()).To(Equal(int64(4)))
+		Expect(h.ValueAtPercentile(50)).To(Equal(int64(2000)))
+	})
+
+	It("lists the non-empty buckets in ascending order", func() {
+		h.RecordN(5000, 2)
+		h.Record(3)
+		Expect(h.Buckets()).To(Equal([]histogram.Bucket{
+			{Value: 3, Count: 1},
+			{Value: 5003, Count: 2},
+		}))
+	})
+
+	It("forgets all values when reset", func() {
+		h.RecordN(5000, 2)
+		h.Reset()
+		Expect(h.TotalCount()).To(BeZero())
+		Expect(h.Buckets()).To(BeEmpty())
+		h.Record(3)
+		Expect(h.Min()).To(Equal(int64(3)))
+		Expect(h.Max()).To(Equal(int64(3)))
+	})
+
+	It("reports zeros when empty", func() {
+		Expect(h.Max()).To(BeZero())
+		Expect(h.ValueAtPercentile(99)).To(BeZero())
+	})
+
+	Describe("Encode", func() {
+		It("round-trips through Decode", func() {
+			for i := int64(0); i < 10000; i++ {
+				h.Record(i * i)
+			}
+			encoded, err := h.Encode()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(encoded)).To(HavePrefix("HISTFAAA"))
+
+			decoded, err := histogram.Decode(encoded)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded.TotalCount()).To(Equal(h.TotalCount()))
+			Expect(decoded.Max()).To(Equal(h.Max()))
+			for _, p := range []float64{1, 50, 90, 99, 99.9} {
+				Expect(decoded.ValueAtPercentile(p)).To(Equal(h.ValueAtPercentile(p)))
+			}
+		})
+
+		It("decodes histograms written by other HdrHistogram implementations", func() {
+			// Values 1 to 100 recorded with 3 significant digits by the
+			// HdrHistogram Go library.
+			encoded := []byte("HISTFAAAACp42pJpmSzMwMCQysDAwMjAwMDMAAEgNsO1yUsY7D9ARZjoAAADAHcPBbU=")
+			decoded, err := histogram.Decode(encoded)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded.TotalCount()).To(Equal(int64(100)))
+			Expect(decoded.ValueAtPercentile(50)).To(Equal(int64(50)))
+			Expect(decoded.Max()).To(Equal(int64(100)))
+		})
+
+		It("rejects other encodings", func() {
+			_, err := histogram.Decode([]byte("bm90IGEgaGlzdG9ncmFt"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("LogWriter", func() {
+		It("writes a header and one tagged line per interval", func() {
+			start := time.Date(2016, 12, 15, 23, 0, 0, 0, time.UTC)
+			h.Record(25000)
+
+			out := new(bytes.Buffer)
+			lw, err := histogram.NewLogWriter(out, start)
+			Expect(err).NotTo(HaveOccurred())
+			lw.MaxValueUnitRatio = 1000
+			Expect(lw.WriteInterval("step-1", start.Add(5*time.Second), start.Add(35*time.Second), h)).To(Succeed())
+			Expect(lw.WriteInterval("bad tag", start, start, h)).NotTo(Succeed())
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			Expect(lines).To(HaveLen(5))
+			Expect(lines[0]).To(Equal("#[Histogram log format version 1.3]"))
+			Expect(lines[1]).To(Equal("#[StartTime: 1481842800.000 (seconds since epoch), 2016-12-15T23:00:00Z]"))
+			Expect(lines[2]).To(Equal("#[BaseTime: 1481842800.000 (seconds since epoch)]"))
+			Expect(lines[3]).To(HavePrefix(`"StartTimestamp"`))
+			Expect(lines[4]).To(MatchRegexp(`^Tag=step-1,5\.000,30\.000,25\.0\d\d,HISTFAAA`))
+		})
+
+		It("is read back by ReadLog", func() {
+			start := time.Date(2016, 12, 15, 23, 0, 0, 0, time.UTC)
+			h.RecordN(25000, 10)
+
+			out := new(bytes.Buffer)
+			lw, err := histogram.NewLogWriter(out, start)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lw.WriteInterval("step-1", start, start.Add(30*time.Second), h)).To(Succeed())
+			Expect(lw.WriteInterval("", start.Add(time.Minute), start.Add(90*time.Second), h)).To(Succeed())
+
+			intervals, err := histogram.ReadLog(out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(intervals).To(HaveLen(2))
+			Expect(intervals[0].Tag).To(Equal("step-1"))
+			Expect(intervals[0].Length).To(Equal(30 * time.Second))
+			Expect(intervals[0].Histogram.TotalCount()).To(Equal(int64(10)))
+			Expect(intervals[1].Tag).To(BeEmpty())
+			Expect(intervals[1].Start).To(Equal(time.Minute))
+		})
+
+		It("fails on malformed intervals", func() {
+			_, err := histogram.ReadLog(strings.NewReader("Tag=step-1,1.000,2.000\n"))
+			Expect(err).To(MatchError(ContainSubstring("line 1")))
+		})
+	})
+})
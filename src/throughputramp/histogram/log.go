@@ -0,0 +1,111 @@
+package histogram
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogWriter writes histograms as intervals of an HdrHistogram log (format
+// version 1.3), which can be read by the HdrHistogram tools such as
+// HistogramLogProcessor. Interval timestamps are relative to the base time.
+type LogWriter struct {
+	w        io.Writer
+	baseTime time.Time
+	// MaxValueUnitRatio scales the interval max column, e.g. 1000 to report
+	// microsecond values in milliseconds.
+	MaxValueUnitRatio float64
+}
+
+// NewLogWriter writes the log header with start as both start and base time.
+func NewLogWriter(w io.Writer, start time.Time) (*LogWriter, error) {
+	lw := &LogWriter{w: w, baseTime: start, MaxValueUnitRatio: 1}
+	_, err := fmt.Fprintf(w,
+		"#[Histogram log format version 1.3]\n"+
+			"#[StartTime: %.3f (seconds since epoch), %s]\n"+
+			"#[BaseTime: %.3f (seconds since epoch)]\n"+
+			"\"StartTimestamp\",\"Interval_Length\",\"Interval_Max\",\"Interval_Compressed_Histogram\"\n",
+		seconds(start), start.UTC().Format(time.RFC3339), seconds(start))
+	return lw, err
+}
+
+// WriteInterval writes h as the interval from start to end. The tag may be
+// empty and must not contain commas, spaces or line breaks.
+func (lw *LogWriter) WriteInterval(tag string, start, end time.Time, h *Histogram) error {
+	if strings.ContainsAny(tag, ", \r\n") {
+		return fmt.Errorf("tag %q contains commas, spaces or line breaks", tag)
+	}
+	encoded, err := h.Encode()
+	if err != nil {
+		return err
+	}
+	if tag != "" {
+		tag = "Tag=" + tag + ","
+	}
+	_, err = fmt.Fprintf(lw.w, "%s%.3f,%.3f,%.3f,%s\n",
+		tag,
+		start.Sub(lw.baseTime).Seconds(),
+		end.Sub(start).Seconds(),
+		float64(h.Max())/lw.MaxValueUnitRatio,
+		encoded)
+	return err
+}
+
+func seconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// Interval is one histogram of an HdrHistogram log. Start is relative to the
+// base time of the log.
+type Interval struct {
+	Tag       string
+	Start     time.Duration
+	Length    time.Duration
+	Histogram *Histogram
+}
+
+// ReadLog parses the intervals of an HdrHistogram log. Comments and the
+// legend are skipped.
+func ReadLog(r io.Reader) ([]Interval, error) {
+	var intervals []Interval
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, `"StartTimestamp"`) {
+			continue
+		}
+		var interval Interval
+		if strings.HasPrefix(text, "Tag=") {
+			i := strings.Index(text, ",")
+			if i < 0 {
+				return nil, fmt.Errorf("line %d: missing interval fields", line)
+			}
+			interval.Tag = text[len("Tag="):i]
+			text = text[i+1:]
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 interval fields, got %d", line, len(fields))
+		}
+		start, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		length, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		interval.Start = time.Duration(start * float64(time.Second))
+		interval.Length = time.Duration(length * float64(time.Second))
+		interval.Histogram, err = Decode([]byte(fields[3]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		intervals = append(intervals, interval)
+	}
+	return intervals, scanner.Err()
+}
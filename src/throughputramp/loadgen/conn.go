@@ -0,0 +1,103 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connTracker dials the connections of a step. It counts the connections
+// that are opened and closed, limits how quickly new ones are opened and
+// counts the requests sent over each of them.
+type connTracker struct {
+	dialer *net.Dialer
+	rate   int
+
+	opened int64
+	closed int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newConnTracker(rate int) *connTracker {
+	return &connTracker{
+		dialer: &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		rate:   rate,
+	}
+}
+
+// dial opens a connection once the connection rate allows it.
+func (t *connTracker) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if err := t.wait(ctx); err != nil {
+		return nil, err
+	}
+	conn, err := t.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&t.opened, 1)
+	return &trackedConn{Conn: conn, tracker: t}, nil
+}
+
+// wait reserves the next slot of the connection rate and waits for it.
+func (t *connTracker) wait(ctx context.Context) error {
+	if t.rate <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	slot := t.next
+	t.next = t.next.Add(time.Second / time.Duration(t.rate))
+	t.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(slot)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// counts returns the number of connections opened and closed so far.
+func (t *connTracker) counts() (int, int) {
+	return int(atomic.LoadInt64(&t.opened)), int(atomic.LoadInt64(&t.closed))
+}
+
+// limitRequests returns a trace that counts the requests sent over every
+// connection and sets *last to the connection of the request when it is the
+// max-th one sent over it, so that it can be closed once the response has
+// been read. Setting Request.Close from the trace would not work for requests
+// with a body, which the transport sends as a copy.
+func limitRequests(max int, last **trackedConn) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn := info.Conn
+			if tc, ok := conn.(*tls.Conn); ok {
+				conn = tc.NetConn()
+			}
+			if c, ok := conn.(*trackedConn); ok && atomic.AddInt64(&c.requests, 1) >= int64(max) {
+				*last = c
+			}
+		},
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker  *connTracker
+	requests int64
+	once     sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { atomic.AddInt64(&c.tracker.closed, 1) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,73 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+const (
+	ErrorClassConnect  = "connect"
+	ErrorClassTLS      = "tls"
+	ErrorClassTimeout  = "timeout"
+	ErrorClassReset    = "reset"
+	ErrorClassEOF      = "eof"
+	ErrorClassCanceled = "canceled"
+	ErrorClassOther    = "other"
+)
+
+// RemoteError is a request error that happened in another process, such as
+// a load agent, and is known only by its class and message.
+type RemoteError struct {
+	Class   string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+// ErrorClass groups request errors by where they happened, so that failures
+// of the router can be told apart from failures to reach it. It returns an
+// empty string for a nil error.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var remoteErr *RemoteError
+	var opErr *net.OpError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certErr x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &remoteErr):
+		return remoteErr.Class
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return ErrorClassConnect
+	case errors.As(err, &recordErr), errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &hostnameErr), errors.As(err, &certErr):
+		return ErrorClassTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrorClassReset
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorClassEOF
+	}
+	return ErrorClassOther
+}
+
+// IsConnectError reports whether err happened while establishing the
+// connection, before any part of the request was sent.
+func IsConnectError(err error) bool {
+	return ErrorClass(err) == ErrorClassConnect
+}
@@ -0,0 +1,58 @@
+package loadgen_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ = Describe("ErrorClass", func() {
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://example.com", Err: err}
+	}
+
+	It("classifies request errors", func() {
+		for err, class := range map[error]string{
+			wrap(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}): loadgen.ErrorClassConnect,
+			wrap(x509.UnknownAuthorityError{}):                        loadgen.ErrorClassTLS,
+			wrap(timeoutError{}):                                      loadgen.ErrorClassTimeout,
+			wrap(&net.OpError{Op: "read", Err: syscall.ECONNRESET}):   loadgen.ErrorClassReset,
+			wrap(io.EOF):                           loadgen.ErrorClassEOF,
+			wrap(context.Canceled):                 loadgen.ErrorClassCanceled,
+			wrap(errors.New("malformed response")): loadgen.ErrorClassOther,
+		} {
+			Expect(loadgen.ErrorClass(err)).To(Equal(class), err.Error())
+		}
+	})
+
+	It("returns no class without an error", func() {
+		Expect(loadgen.ErrorClass(nil)).To(BeEmpty())
+	})
+
+	It("detects connect errors", func() {
+		Expect(loadgen.IsConnectError(fmt.Errorf("step: %w", wrap(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED})))).To(BeTrue())
+		Expect(loadgen.IsConnectError(wrap(io.EOF))).To(BeFalse())
+	})
+
+	It("keeps the class of errors reported by load agents", func() {
+		err := &loadgen.RemoteError{Class: loadgen.ErrorClassConnect, Message: "dial tcp: connection refused"}
+		Expect(loadgen.IsConnectError(err)).To(BeTrue())
+		Expect(err.Error()).To(Equal("dial tcp: connection refused"))
+	})
+})
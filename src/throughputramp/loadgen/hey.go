@@ -0,0 +1,210 @@
+package loadgen
+
+import (
+	"context"
+	"debug/buildinfo"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// heyWaitDelay is the time hey is given to print the requests it sent after
+// it was interrupted, before it is killed.
+const heyWaitDelay = 10 * time.Second
+
+// HeyGenerator runs each step by shelling out to the hey binary found on
+// PATH. It is kept to compare results against the native generator. The
+// warm-up runs as a separate hey invocation, so its connections are not
+// reused by the measured step. hey does not report failed requests, so all
+// samples are successful.
+//
+// When the context is cancelled hey is interrupted, and the requests it
+// reports are returned along with the context's error.
+type HeyGenerator struct {
+	config Config
+}
+
+func NewHeyGenerator(config Config) *HeyGenerator {
+	return &HeyGenerator{config: config}
+}
+
+// HeyVersion returns the module version of the hey binary found on PATH, as
+// recorded by go install, or "" if it has none.
+func HeyVersion() string {
+	path, err := exec.LookPath("hey")
+	if err != nil {
+		return ""
+	}
+	info, err := buildinfo.ReadFile(path)
+	if err != nil || info.Main.Version == "(devel)" {
+		return ""
+	}
+	return info.Main.Version
+}
+
+func (g *HeyGenerator) Run(ctx context.Context, step Step) (Result, error) {
+	if step.Rate > 0 {
+		return Result{}, errors.New("hey does not support open-loop rate steps")
+	}
+	if !g.config.TLS.empty() {
+		return Result{}, errors.New("hey does not support TLS options")
+	}
+	if g.config.Routes.enabled() {
+		return Result{}, errors.New("hey does not support routes")
+	}
+	if g.config.MaxRequestsPerConnection > 0 || g.config.MaxIdleConnections > 0 || g.config.ConnectionRate > 0 {
+		return Result{}, errors.New("hey does not support connection limits")
+	}
+	if !g.config.Request.empty() {
+		return Result{}, errors.New("hey does not support request templates")
+	}
+	if g.config.Stream.enabled() {
+		return Result{}, errors.New("hey does not support streams")
+	}
+
+	if step.Warmup > 0 {
+		warmup := step
+		warmup.NumRequests = 0
+		warmup.Duration = step.Warmup
+		if _, err := g.hey(ctx, warmup); err != nil {
+			return Result{}, err
+		}
+	}
+
+	result := NewResult(step, time.Now())
+	heyData, err := g.hey(ctx, step)
+	if err != nil && ctx.Err() == nil {
+		return Result{}, err
+	}
+	result.End = time.Now()
+	samples, err := parseHeyCSV(result.Start, heyData)
+	if err != nil {
+		// hey may have been killed while printing its report.
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		return Result{}, err
+	}
+	for _, s := range samples {
+		result.Record(s)
+	}
+	if g.config.KeepSamples {
+		result.Samples = samples
+	}
+	return result, ctx.Err()
+}
+
+func (g *HeyGenerator) hey(ctx context.Context, step Step) (string, error) {
+	args := []string{"-host", g.config.Host}
+	if step.Duration > 0 {
+		args = append(args, "-z", step.Duration.String())
+	} else {
+		args = append(args, "-n", strconv.Itoa(step.NumRequests))
+	}
+	args = append(args,
+		"-c", strconv.Itoa(step.Concurrency),
+		"-q", strconv.Itoa(step.RateLimit),
+		"-o", "csv",
+	)
+	if g.config.DisableKeepAlives {
+		args = append(args, "-disable-keepalive")
+	}
+	if g.config.Timeout > 0 {
+		args = append(args, "-t", strconv.Itoa(int(g.config.Timeout.Seconds())))
+	}
+	args = append(args, g.config.URL)
+
+	cmd := exec.CommandContext(ctx, "hey", args...)
+	// hey prints the requests it sent so far when it is interrupted.
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = heyWaitDelay
+	heyData, err := cmd.Output()
+	if ctx.Err() != nil {
+		return string(heyData), ctx.Err()
+	}
+	if err != nil {
+		return "", fmt.Errorf("hey error: %s\nData:\n%s", err, string(heyData))
+	}
+	return string(heyData), nil
+}
+
+func parseHeyCSV(start time.Time, heyData string) ([]Sample, error) {
+	records, err := csv.NewReader(strings.NewReader(heyData)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading hey csv records: %s", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	responseTimeCol, ok := columns["response-time"]
+	if !ok {
+		return nil, fmt.Errorf("hey csv is missing column response-time")
+	}
+	offsetCol, ok := columns["offset"]
+	if !ok {
+		return nil, fmt.Errorf("hey csv is missing column offset")
+	}
+	statusCodeCol, hasStatusCode := columns["status-code"]
+
+	samples := make([]Sample, 0, len(records)-1)
+	for _, record := range records[1:] {
+		responseTime, err := parseSeconds(record[responseTimeCol])
+		if err != nil {
+			return nil, err
+		}
+		offset, err := parseSeconds(record[offsetCol])
+		if err != nil {
+			return nil, err
+		}
+		sample := Sample{
+			Start:        start.Add(offset),
+			ResponseTime: responseTime,
+		}
+		if hasStatusCode {
+			sample.StatusCode, err = strconv.Atoi(record[statusCodeCol])
+			if err != nil {
+				return nil, fmt.Errorf("parsing status code %q: %s", record[statusCodeCol], err)
+			}
+		}
+		phases := map[string]*time.Duration{
+			"DNS+dialup":     &sample.Connect,
+			"DNS":            &sample.DNS,
+			"Request-write":  &sample.RequestWrite,
+			"Response-delay": &sample.ResponseDelay,
+			"Response-read":  &sample.ResponseRead,
+		}
+		for column, phase := range phases {
+			col, ok := columns[column]
+			if !ok {
+				continue
+			}
+			if *phase, err = parseSeconds(record[col]); err != nil {
+				return nil, err
+			}
+		}
+		// hey only times the dial of new connections.
+		sample.ConnReused = sample.Connect == 0
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+func parseSeconds(s string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing duration %q: %s", s, err)
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
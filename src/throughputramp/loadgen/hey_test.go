@@ -0,0 +1,142 @@
+package loadgen_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const fakeHey = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+cat <<CSV
+response-time,DNS+dialup,DNS,Request-write,Response-delay,Response-read,status-code,offset
+0.0025,0.0010,0.0000,0.0000,0.0015,0.0000,200,0.0100
+0.5000,0.0000,0.0000,0.0000,0.4990,0.0010,502,1.2500
+CSV
+`
+
+var _ = Describe("HeyGenerator", func() {
+	var (
+		binDir string
+		path   string
+	)
+
+	BeforeEach(func() {
+		var err error
+		binDir, err = ioutil.TempDir("", "hey")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(binDir, "hey"), []byte(fakeHey), 0755)).To(Succeed())
+
+		path = os.Getenv("PATH")
+		os.Setenv("PATH", binDir+":"+path)
+	})
+
+	AfterEach(func() {
+		os.Setenv("PATH", path)
+		Expect(os.RemoveAll(binDir)).To(Succeed())
+	})
+
+	It("passes the step to hey and parses its csv output", func() {
+		generator := loadgen.NewHeyGenerator(loadgen.Config{
+			URL:               "http://10.0.1.5",
+			Host:              "example.com",
+			DisableKeepAlives: true,
+			KeepSamples:       true,
+		})
+
+		before := time.Now()
+		result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 2, Concurrency: 1, RateLimit: 100})
+		Expect(err).ToNot(HaveOccurred())
+		samples := result.Samples
+
+		args, err := ioutil.ReadFile(filepath.Join(binDir, "args"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(args)).To(Equal("-host example.com -n 2 -c 1 -q 100 -o csv -disable-keepalive http://10.0.1.5\n"))
+
+		Expect(samples).To(HaveLen(2))
+		Expect(samples[0].ResponseTime).To(Equal(2500 * time.Microsecond))
+		Expect(samples[0].StatusCode).To(Equal(200))
+		Expect(samples[0].Connect).To(Equal(time.Millisecond))
+		Expect(samples[0].ResponseDelay).To(Equal(1500 * time.Microsecond))
+		Expect(samples[0].ConnReused).To(BeFalse())
+		Expect(result.Start).To(BeTemporally(">=", before))
+		Expect(samples[0].Start).To(Equal(result.Start.Add(10 * time.Millisecond)))
+		Expect(samples[1].StatusCode).To(Equal(502))
+		Expect(samples[1].ResponseRead).To(Equal(time.Millisecond))
+		Expect(samples[1].ConnReused).To(BeTrue())
+		Expect(samples[1].Start.Sub(samples[0].Start)).To(Equal(1240 * time.Millisecond))
+		Expect(result.Requests).To(Equal(2))
+		Expect(result.NonSuccess).To(Equal(1))
+		Expect(result.Latency.TotalCount()).To(Equal(int64(2)))
+	})
+	It("runs steps with a duration and warm-up", func() {
+		generator := loadgen.NewHeyGenerator(loadgen.Config{URL: "http://10.0.1.5"})
+		_, err := generator.Run(context.Background(), loadgen.Step{Concurrency: 1, Duration: time.Minute, Warmup: 10 * time.Second})
+		Expect(err).ToNot(HaveOccurred())
+
+		args, err := ioutil.ReadFile(filepath.Join(binDir, "args"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(args)).To(Equal("-host  -z 1m0s -c 1 -q 0 -o csv http://10.0.1.5\n"))
+	})
+
+	It("keeps the requests hey reports when it is interrupted", func() {
+		interruptedHey := `#!/bin/sh
+trap 'cat <<CSV
+response-time,DNS+dialup,DNS,Request-write,Response-delay,Response-read,status-code,offset
+0.0025,0.0010,0.0000,0.0000,0.0015,0.0000,200,0.0100
+CSV
+exit 0' INT
+while true; do sleep 0.1; done
+`
+		Expect(ioutil.WriteFile(filepath.Join(binDir, "hey"), []byte(interruptedHey), 0755)).To(Succeed())
+		generator := loadgen.NewHeyGenerator(loadgen.Config{URL: "http://10.0.1.5"})
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		result, err := generator.Run(ctx, loadgen.Step{Concurrency: 1, Duration: time.Minute})
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(result.Requests).To(Equal(1))
+		Expect(result.End.Sub(result.Start)).To(BeNumerically("<", 5*time.Second))
+	})
+
+	It("has no version for hey binaries without build info", func() {
+		Expect(loadgen.HeyVersion()).To(BeEmpty())
+	})
+
+	It("does not support open-loop steps", func() {
+		generator := loadgen.NewHeyGenerator(loadgen.Config{URL: "http://10.0.1.5"})
+		_, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 2, Concurrency: 1, Rate: 10})
+		Expect(err).To(MatchError("hey does not support open-loop rate steps"))
+	})
+
+	It("does not support TLS options", func() {
+		generator := loadgen.NewHeyGenerator(loadgen.Config{URL: "https://10.0.1.5", TLS: loadgen.TLSConfig{ServerName: "router"}})
+		_, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 2, Concurrency: 1})
+		Expect(err).To(MatchError("hey does not support TLS options"))
+	})
+
+	It("does not support connection limits", func() {
+		generator := loadgen.NewHeyGenerator(loadgen.Config{URL: "http://10.0.1.5", MaxRequestsPerConnection: 100})
+		_, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 2, Concurrency: 1})
+		Expect(err).To(MatchError("hey does not support connection limits"))
+	})
+
+	It("does not support request templates", func() {
+		generator := loadgen.NewHeyGenerator(loadgen.Config{URL: "http://10.0.1.5", Request: loadgen.RequestTemplate{Method: "POST"}})
+		_, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 2, Concurrency: 1})
+		Expect(err).To(MatchError("hey does not support request templates"))
+	})
+
+	It("does not support streams", func() {
+		generator := loadgen.NewHeyGenerator(loadgen.Config{URL: "http://10.0.1.5", Stream: loadgen.StreamConfig{Kind: loadgen.StreamWebSocket}})
+		_, err := generator.Run(context.Background(), loadgen.Step{Duration: time.Second, Concurrency: 1})
+		Expect(err).To(MatchError("hey does not support streams"))
+	})
+})
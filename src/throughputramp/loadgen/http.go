@@ -0,0 +1,409 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Protocols the native generator speaks. HTTP/2 over TLS is negotiated with
+// ALPN, h2c is HTTP/2 over cleartext with prior knowledge.
+const (
+	ProtocolHTTP1 = "http1"
+	ProtocolHTTP2 = "h2"
+	ProtocolH2C   = "h2c"
+)
+
+type Config struct {
+	URL               string
+	Host              string
+	DisableKeepAlives bool
+	Timeout           time.Duration
+	// KeepSamples keeps every request in Result.Samples in addition to the
+	// aggregated counts and latency histogram.
+	KeepSamples bool
+	// Protocol is one of the Protocol constants. Empty means HTTP/1.1.
+	Protocol string
+	// StreamsPerConnection is the number of workers that share an HTTP/2
+	// connection. Zero lets all workers share connections, opening a new one
+	// only when the router's limit of concurrent streams is reached.
+	StreamsPerConnection int
+	TLS                  TLSConfig
+	// Routes spreads the requests across many routes instead of sending
+	// all of them with Host.
+	Routes Routes
+	// MaxRequestsPerConnection closes every connection after this many
+	// requests. Zero keeps connections open.
+	MaxRequestsPerConnection int
+	// MaxIdleConnections is the number of idle connections kept for reuse.
+	// Zero keeps one per worker.
+	MaxIdleConnections int
+	// ConnectionRate limits how many new connections are opened per second.
+	// Zero means no limit.
+	ConnectionRate int
+	// Request describes the requests. The zero value sends GET requests
+	// without a body.
+	Request RequestTemplate
+	// Stream holds long-lived connections instead of sending requests.
+	Stream StreamConfig
+}
+
+// Validate checks that the protocol is known, matches the scheme of the URL
+// and supports the connection limits.
+func (c Config) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+	switch c.Protocol {
+	case "", ProtocolHTTP1:
+		if c.StreamsPerConnection > 1 {
+			return errors.New("more than one stream per connection requires HTTP/2")
+		}
+	case ProtocolHTTP2:
+		if u.Scheme != "https" {
+			return fmt.Errorf("protocol %s requires an https URL", c.Protocol)
+		}
+	case ProtocolH2C:
+		if u.Scheme != "http" {
+			return fmt.Errorf("protocol %s requires an http URL", c.Protocol)
+		}
+	default:
+		return fmt.Errorf("unknown protocol %q", c.Protocol)
+	}
+	// Closing a multiplexed connection would fail the other streams on it.
+	if c.MaxRequestsPerConnection > 0 && (c.Protocol == ProtocolHTTP2 || c.Protocol == ProtocolH2C) {
+		return fmt.Errorf("a maximum of requests per connection is not supported with protocol %s", c.Protocol)
+	}
+	if c.StreamsPerConnection < 0 {
+		return errors.New("streams per connection must not be negative")
+	}
+	if c.MaxRequestsPerConnection < 0 || c.MaxIdleConnections < 0 || c.ConnectionRate < 0 {
+		return errors.New("connection limits must not be negative")
+	}
+	if c.Routes.enabled() {
+		if c.Host != "" {
+			return errors.New("a host cannot be combined with routes")
+		}
+		if err := c.Routes.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.Request.Validate(); err != nil {
+		return err
+	}
+	if c.Stream.enabled() {
+		if err := c.Stream.Validate(); err != nil {
+			return err
+		}
+		if c.Protocol != "" && c.Protocol != ProtocolHTTP1 {
+			return fmt.Errorf("streams require protocol %s", ProtocolHTTP1)
+		}
+		if !c.Request.empty() {
+			return errors.New("request templates cannot be combined with streams")
+		}
+	}
+	_, err = c.TLS.ClientConfig()
+	return err
+}
+
+type HTTPGenerator struct {
+	config Config
+	// Observe, when set, is called with every sample of the measured window
+	// as soon as it is recorded, to follow a step while it runs.
+	Observe func(Sample)
+}
+
+func NewHTTPGenerator(config Config) *HTTPGenerator {
+	return &HTTPGenerator{config: config}
+}
+
+func (g *HTTPGenerator) Run(ctx context.Context, step Step) (Result, error) {
+	if step.Concurrency < 1 {
+		return Result{}, errors.New("concurrency must be at least 1")
+	}
+	if step.NumRequests == 0 && step.Duration == 0 {
+		return Result{}, errors.New("either number of requests or duration must be set")
+	}
+	if step.Rate == 0 && step.Duration == 0 && step.NumRequests < step.Concurrency {
+		return Result{}, errors.New("number of requests must not be smaller than concurrency")
+	}
+
+	if err := g.config.Validate(); err != nil {
+		return Result{}, err
+	}
+	tlsConfig, err := g.config.TLS.ClientConfig()
+	if err != nil {
+		return Result{}, err
+	}
+	if g.config.Stream.enabled() {
+		return g.runStreams(ctx, step, tlsConfig)
+	}
+
+	requests, err := g.config.Request.builder(g.config.URL, time.Now().UnixNano())
+	if err != nil {
+		return Result{}, err
+	}
+
+	conns := newConnTracker(g.config.ConnectionRate)
+	s := &session{
+		clients:  g.clients(step, tlsConfig, conns),
+		streams:  g.config.StreamsPerConnection,
+		requests: requests,
+	}
+	defer func() {
+		for _, c := range s.clients {
+			c.Transport.(*http.Transport).CloseIdleConnections()
+		}
+	}()
+	if g.config.Routes.enabled() {
+		if s.host, err = g.config.Routes.picker(time.Now().UnixNano()); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if step.Warmup > 0 {
+		warmup := step
+		warmup.NumRequests = 0
+		warmup.Duration = step.Warmup
+		g.run(ctx, s, warmup, func(Sample) {})
+		requests.restart()
+	}
+
+	result := NewResult(step, time.Now())
+	openedBefore, closedBefore := conns.counts()
+	g.run(ctx, s, step, func(sample Sample) {
+		result.Record(sample)
+		if g.Observe != nil {
+			g.Observe(sample)
+		}
+		if g.config.KeepSamples {
+			result.Samples = append(result.Samples, sample)
+		}
+	})
+	result.End = time.Now()
+	opened, closed := conns.counts()
+	result.ConnectionsOpened = opened - openedBefore
+	result.ConnectionsClosed = closed - closedBefore
+	return result, ctx.Err()
+}
+
+// clients returns the clients the workers of step send their requests with.
+// Each client has its own connections, so with HTTP/2 the workers sharing a
+// client multiplex their requests over the same connection.
+func (g *HTTPGenerator) clients(step Step, tlsConfig *tls.Config, conns *connTracker) []*http.Client {
+	n, maxConns := 1, 0
+	if streams := g.config.StreamsPerConnection; streams > 0 && g.config.Protocol != "" && g.config.Protocol != ProtocolHTTP1 {
+		n = (step.Concurrency + streams - 1) / streams
+		// For HTTP/2 this limits the connections being dialed, which keeps
+		// the first requests of the workers from opening one each.
+		maxConns = 1
+	}
+
+	protocols := new(http.Protocols)
+	switch g.config.Protocol {
+	case ProtocolHTTP2:
+		protocols.SetHTTP2(true)
+	case ProtocolH2C:
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		protocols.SetHTTP1(true)
+	}
+
+	maxIdle := g.config.MaxIdleConnections
+	if maxIdle == 0 {
+		maxIdle = step.Concurrency
+	}
+
+	clients := make([]*http.Client, n)
+	for i := range clients {
+		transport := &http.Transport{
+			DialContext:         conns.dial,
+			TLSClientConfig:     tlsConfig.Clone(),
+			MaxIdleConnsPerHost: maxIdle,
+			MaxConnsPerHost:     maxConns,
+			DisableKeepAlives:   g.config.DisableKeepAlives,
+			Protocols:           protocols,
+		}
+		clients[i] = &http.Client{Transport: transport, Timeout: g.config.Timeout}
+	}
+	return clients
+}
+
+// session is shared by the workers of a step. host returns the Host header
+// of the next request when the requests are spread across routes.
+type session struct {
+	clients  []*http.Client
+	streams  int
+	requests *requestBuilder
+	host     func() string
+}
+
+// client returns the client of worker w.
+func (s *session) client(w int) *http.Client {
+	if len(s.clients) == 1 {
+		return s.clients[0]
+	}
+	return s.clients[w/s.streams]
+}
+
+// run sends the requests of step and passes each sample to record, which is
+// called from a single goroutine.
+func (g *HTTPGenerator) run(ctx context.Context, s *session, step Step, record func(Sample)) {
+	results := make(chan Sample, step.Concurrency)
+	collected := make(chan struct{})
+	go func() {
+		for s := range results {
+			record(s)
+		}
+		close(collected)
+	}()
+
+	var deadline time.Time
+	if step.Duration > 0 {
+		deadline = time.Now().Add(step.Duration)
+	}
+	if step.Rate > 0 {
+		g.runOpenLoop(ctx, s, step, deadline, results)
+	} else {
+		g.runClosedLoop(ctx, s, step, deadline, results)
+	}
+	close(results)
+	<-collected
+}
+
+func (g *HTTPGenerator) runClosedLoop(ctx context.Context, s *session, step Step, deadline time.Time, results chan<- Sample) {
+	var wg sync.WaitGroup
+	for w := 0; w < step.Concurrency; w++ {
+		n := step.NumRequests / step.Concurrency
+		if w < step.NumRequests%step.Concurrency {
+			n++
+		}
+		if step.NumRequests > 0 && n == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(client *http.Client, n int) {
+			defer wg.Done()
+			g.worker(ctx, s, client, n, step.RateLimit, deadline, results)
+		}(s.client(w), n)
+	}
+	wg.Wait()
+}
+
+// runOpenLoop schedules requests on a fixed timeline and measures each one
+// from its intended send time, so a stalled backend shows up as latency
+// instead of as a lower request rate.
+func (g *HTTPGenerator) runOpenLoop(ctx context.Context, s *session, step Step, deadline time.Time, results chan<- Sample) {
+	// The schedule is buffered for the whole step so that falling behind
+	// never delays the timeline itself.
+	schedule := make(chan time.Time, step.expectedRequests())
+	var wg sync.WaitGroup
+	for w := 0; w < step.Concurrency; w++ {
+		wg.Add(1)
+		go func(client *http.Client) {
+			defer wg.Done()
+			for intended := range schedule {
+				if ctx.Err() != nil {
+					continue
+				}
+				sample := g.do(ctx, s, client)
+				sample.ScheduleDelay = sample.Start.Sub(intended)
+				sample.ResponseTime += sample.ScheduleDelay
+				sample.Start = intended
+				results <- sample
+			}
+		}(s.client(w))
+	}
+
+	start := time.Now()
+	for i := 0; step.NumRequests == 0 || i < step.NumRequests; i++ {
+		intended := start.Add(time.Duration(i) * time.Second / time.Duration(step.Rate))
+		if !deadline.IsZero() && !intended.Before(deadline) {
+			break
+		}
+		if wait := time.Until(intended); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		schedule <- intended
+	}
+	close(schedule)
+	wg.Wait()
+}
+
+func (g *HTTPGenerator) worker(ctx context.Context, s *session, client *http.Client, n, rateLimit int, deadline time.Time, results chan<- Sample) {
+	var throttle <-chan time.Time
+	if rateLimit > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(rateLimit))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	for i := 0; n == 0 || i < n; i++ {
+		if throttle != nil {
+			select {
+			case <-throttle:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() != nil || (!deadline.IsZero() && !time.Now().Before(deadline)) {
+			return
+		}
+		results <- g.do(ctx, s, client)
+	}
+}
+
+func (g *HTTPGenerator) do(ctx context.Context, s *session, client *http.Client) Sample {
+	start := time.Now()
+	req, err := s.requests.new(ctx)
+	if err != nil {
+		return Sample{Start: start, Err: err}
+	}
+	var trace phaseTrace
+	traceCtx := httptrace.WithClientTrace(ctx, trace.clientTrace())
+	var last *trackedConn
+	if g.config.MaxRequestsPerConnection > 0 {
+		traceCtx = httptrace.WithClientTrace(traceCtx, limitRequests(g.config.MaxRequestsPerConnection, &last))
+	}
+	req = req.WithContext(traceCtx)
+	if s.host != nil {
+		req.Host = s.host()
+	} else if g.config.Host != "" {
+		req.Host = g.config.Host
+	}
+
+	sample := Sample{Start: start, Host: req.Host}
+	resp, err := client.Do(req)
+	if err == nil {
+		sample.StatusCode = resp.StatusCode
+		sample.Protocol = resp.Proto
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	end := time.Now()
+	if last != nil {
+		// The connection reached its limit and is closed now that the
+		// response has been read.
+		last.Close()
+	}
+
+	sample.ResponseTime = end.Sub(start)
+	sample.Err = err
+	trace.apply(&sample, end)
+	return sample
+}
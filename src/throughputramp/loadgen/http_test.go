@@ -0,0 +1,452 @@
+package loadgen_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("HTTPGenerator", func() {
+	var (
+		server    *ghttp.Server
+		generator *loadgen.HTTPGenerator
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		server.AllowUnhandledRequests = true
+		server.UnhandledRequestStatusCode = http.StatusOK
+		server.RouteToHandler("GET", "/", func(rw http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			Expect(req.Host).To(Equal("example.com"))
+		})
+
+		generator = loadgen.NewHTTPGenerator(loadgen.Config{
+			URL:         server.URL(),
+			Host:        "example.com",
+			KeepSamples: true,
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("sends the requested number of requests and times each of them", func() {
+		before := time.Now()
+		result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 10, Concurrency: 3})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Start).To(BeTemporally(">=", before))
+		Expect(result.End).To(BeTemporally(">", result.Start))
+		samples := result.Samples
+		Expect(samples).To(HaveLen(10))
+		Expect(server.ReceivedRequests()).To(HaveLen(10))
+		for _, s := range samples {
+			Expect(s.Err).ToNot(HaveOccurred())
+			Expect(s.StatusCode).To(Equal(http.StatusOK))
+			Expect(s.Start).To(BeTemporally(">=", before))
+			Expect(s.ResponseTime).To(BeNumerically(">", 0))
+			Expect(s.Connect + s.RequestWrite + s.ResponseDelay + s.ResponseRead).To(BeNumerically("<=", s.ResponseTime))
+			Expect(s.ResponseDelay).To(BeNumerically(">", 0))
+		}
+	})
+
+	It("aggregates the requests without keeping them unless asked to", func() {
+		generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: server.URL(), Host: "example.com"})
+		result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 10, Concurrency: 3})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Samples).To(BeEmpty())
+		Expect(result.Requests).To(Equal(10))
+		Expect(result.Errors).To(BeZero())
+		Expect(result.NonSuccess).To(BeZero())
+		Expect(result.Latency.TotalCount()).To(Equal(int64(10)))
+		Expect(result.Latency.Max()).To(BeNumerically(">", 0))
+		Expect(result.Completed).To(Equal([]int{10}))
+	})
+
+	It("reports whether connections were reused", func() {
+		result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 3, Concurrency: 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Samples[0].ConnReused).To(BeFalse())
+		Expect(result.Samples[0].Connect).To(BeNumerically(">", 0))
+		Expect(result.Samples[2].ConnReused).To(BeTrue())
+	})
+
+	Context("when connections are limited", func() {
+		It("counts the connections opened and closed during the step", func() {
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: server.URL(), Host: "example.com", DisableKeepAlives: true})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 4, Concurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.ConnectionsOpened).To(Equal(4))
+			Expect(result.ConnectionsClosed).To(Equal(4))
+		})
+
+		It("keeps connections open by default", func() {
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 4, Concurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.ConnectionsOpened).To(Equal(1))
+			Expect(result.ConnectionsClosed).To(BeZero())
+		})
+
+		It("closes every connection after the maximum number of requests", func() {
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: server.URL(), Host: "example.com", MaxRequestsPerConnection: 3, KeepSamples: true})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 7, Concurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Errors).To(BeZero())
+			Expect(result.ConnectionsOpened).To(Equal(3))
+			Expect(result.ConnectionsClosed).To(Equal(2))
+			var reused []bool
+			for _, s := range result.Samples {
+				reused = append(reused, s.ConnReused)
+			}
+			Expect(reused).To(Equal([]bool{false, true, true, false, true, true, false}))
+		})
+
+		It("closes every connection after the maximum number of requests with a body", func() {
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{
+				URL:                      server.URL(),
+				Host:                     "example.com",
+				MaxRequestsPerConnection: 1,
+				Request:                  loadgen.RequestTemplate{Method: "POST", Body: []byte("payload")},
+			})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 20, Concurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Errors).To(BeZero())
+			Expect(result.ConnectionsOpened).To(Equal(20))
+			Expect(result.ConnectionsClosed).To(Equal(20))
+		})
+
+		It("limits the rate of new connections", func() {
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: server.URL(), Host: "example.com", DisableKeepAlives: true, ConnectionRate: 20})
+			start := time.Now()
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 5, Concurrency: 5})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.ConnectionsOpened).To(Equal(5))
+			Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		})
+	})
+
+	It("limits the rate of each worker", func() {
+		start := time.Now()
+		_, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 4, Concurrency: 2, RateLimit: 10})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+	})
+
+	It("records failed requests as errored samples", func() {
+		server.Close()
+		result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 2, Concurrency: 1})
+		Expect(err).ToNot(HaveOccurred())
+		samples := result.Samples
+		Expect(samples).To(HaveLen(2))
+		Expect(samples[0].Err).To(HaveOccurred())
+		Expect(result.Errors).To(Equal(2))
+		Expect(result.ConnectErrors).To(Equal(2))
+		Expect(result.Latency.TotalCount()).To(BeZero())
+	})
+
+	It("stops sending requests when the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := generator.Run(ctx, loadgen.Step{NumRequests: 10, Concurrency: 1, RateLimit: 1})
+		Expect(err).To(Equal(context.Canceled))
+		Expect(server.ReceivedRequests()).To(BeEmpty())
+	})
+
+	Context("when the step has a target rate", func() {
+		It("schedules the requests at that rate", func() {
+			start := time.Now()
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 10, Concurrency: 2, Rate: 50})
+			Expect(err).ToNot(HaveOccurred())
+			samples := result.Samples
+			Expect(samples).To(HaveLen(10))
+			Expect(time.Since(start)).To(BeNumerically(">=", 180*time.Millisecond))
+		})
+
+		It("measures latency from the intended send time", func() {
+			server.RouteToHandler("GET", "/", func(rw http.ResponseWriter, req *http.Request) {
+				time.Sleep(50 * time.Millisecond)
+			})
+
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 5, Concurrency: 1, Rate: 100})
+			Expect(err).ToNot(HaveOccurred())
+			samples := result.Samples
+			Expect(samples).To(HaveLen(5))
+
+			last := samples[len(samples)-1]
+			for _, s := range samples {
+				if s.Start.After(last.Start) {
+					last = s
+				}
+			}
+			Expect(last.ScheduleDelay).To(BeNumerically(">=", 150*time.Millisecond))
+			Expect(last.ResponseTime).To(BeNumerically(">=", last.ScheduleDelay+50*time.Millisecond))
+		})
+
+		It("does not require more requests than workers", func() {
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 1, Concurrency: 5, Rate: 10})
+			Expect(err).ToNot(HaveOccurred())
+			samples := result.Samples
+			Expect(samples).To(HaveLen(1))
+		})
+	})
+
+	Context("when the step has a duration", func() {
+		It("keeps sending requests until the duration elapses", func() {
+			start := time.Now()
+			result, err := generator.Run(context.Background(), loadgen.Step{Concurrency: 2, RateLimit: 20, Duration: 300 * time.Millisecond})
+			Expect(err).ToNot(HaveOccurred())
+			samples := result.Samples
+			Expect(time.Since(start)).To(BeNumerically(">=", 300*time.Millisecond))
+			Expect(len(samples)).To(BeNumerically("~", 12, 4))
+		})
+
+		It("stops open-loop steps when the duration elapses", func() {
+			result, err := generator.Run(context.Background(), loadgen.Step{Concurrency: 2, Rate: 40, Duration: 250 * time.Millisecond})
+			Expect(err).ToNot(HaveOccurred())
+			samples := result.Samples
+			Expect(samples).To(HaveLen(10))
+		})
+
+		It("stops at the number of requests if it is reached first", func() {
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 3, Concurrency: 1, Duration: time.Minute})
+			Expect(err).ToNot(HaveOccurred())
+			samples := result.Samples
+			Expect(samples).To(HaveLen(3))
+		})
+	})
+
+	It("passes every measured sample to the observer while the step runs", func() {
+		var observed []loadgen.Sample
+		generator.Observe = func(s loadgen.Sample) {
+			observed = append(observed, s)
+		}
+		result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 4, Concurrency: 2, Warmup: 50 * time.Millisecond})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(observed).To(HaveLen(4))
+		Expect(observed).To(ConsistOf(result.Samples))
+	})
+
+	Context("when the step has a warm-up", func() {
+		It("discards the samples sent during the warm-up", func() {
+			before := time.Now()
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 3, Concurrency: 1, RateLimit: 20, Warmup: 200 * time.Millisecond})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Samples).To(HaveLen(3))
+			Expect(len(server.ReceivedRequests())).To(BeNumerically(">", 3))
+			Expect(result.Start).To(BeTemporally(">=", before.Add(200*time.Millisecond)))
+			for _, s := range result.Samples {
+				Expect(s.Start).To(BeTemporally(">=", result.Start))
+			}
+		})
+
+		It("numbers the requests of the step from 1", func() {
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{
+				URL:     server.URL(),
+				Host:    "example.com",
+				Request: loadgen.RequestTemplate{Header: http.Header{"X-Seq": {"{{seq}}"}}},
+			})
+			_, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 3, Concurrency: 1, RateLimit: 20, Warmup: 200 * time.Millisecond})
+			Expect(err).ToNot(HaveOccurred())
+			received := server.ReceivedRequests()
+			Expect(len(received)).To(BeNumerically(">", 3))
+			var seqs []string
+			for _, req := range received[len(received)-3:] {
+				seqs = append(seqs, req.Header.Get("X-Seq"))
+			}
+			Expect(seqs).To(Equal([]string{"1", "2", "3"}))
+		})
+	})
+
+	It("rejects steps without a number of requests or duration", func() {
+		_, err := generator.Run(context.Background(), loadgen.Step{Concurrency: 2})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects fewer requests than workers", func() {
+		_, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 1, Concurrency: 2})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("when the protocol is HTTP/2", func() {
+		var (
+			h2Server    *httptest.Server
+			connections int32
+		)
+
+		BeforeEach(func() {
+			connections = 0
+			h2Server = httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				time.Sleep(10 * time.Millisecond)
+			}))
+			h2Server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&connections, 1)
+				}
+			}
+		})
+
+		AfterEach(func() {
+			h2Server.Close()
+		})
+
+		It("negotiates HTTP/2 over TLS and records the protocol of every response", func() {
+			h2Server.EnableHTTP2 = true
+			h2Server.StartTLS()
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: h2Server.URL, Protocol: loadgen.ProtocolHTTP2, KeepSamples: true})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 10, Concurrency: 2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Errors).To(BeZero())
+			Expect(result.Protocols).To(Equal(map[string]int{"HTTP/2.0": 10}))
+			for _, s := range result.Samples {
+				Expect(s.Protocol).To(Equal("HTTP/2.0"))
+			}
+		})
+
+		It("speaks HTTP/1.1 to an HTTP/2 capable router unless asked otherwise", func() {
+			h2Server.EnableHTTP2 = true
+			h2Server.StartTLS()
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: h2Server.URL})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 4, Concurrency: 2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Protocols).To(Equal(map[string]int{"HTTP/1.1": 4}))
+		})
+
+		It("speaks h2c with prior knowledge", func() {
+			protocols := new(http.Protocols)
+			protocols.SetHTTP1(true)
+			protocols.SetUnencryptedHTTP2(true)
+			h2Server.Config.Protocols = protocols
+			h2Server.Start()
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: h2Server.URL, Protocol: loadgen.ProtocolH2C})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 4, Concurrency: 2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Errors).To(BeZero())
+			Expect(result.Protocols).To(Equal(map[string]int{"HTTP/2.0": 4}))
+		})
+
+		It("multiplexes the given number of workers over each connection", func() {
+			h2Server.EnableHTTP2 = true
+			h2Server.StartTLS()
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: h2Server.URL, Protocol: loadgen.ProtocolHTTP2, StreamsPerConnection: 2})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 30, Concurrency: 6})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Protocols).To(Equal(map[string]int{"HTTP/2.0": 30}))
+			Expect(atomic.LoadInt32(&connections)).To(Equal(int32(3)))
+		})
+	})
+
+	Context("when the router terminates TLS", func() {
+		var tlsServer *httptest.Server
+
+		BeforeEach(func() {
+			tlsServer = httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		})
+
+		AfterEach(func() {
+			tlsServer.Close()
+		})
+
+		It("records the handshake of every new connection", func() {
+			tlsServer.StartTLS()
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: tlsServer.URL, KeepSamples: true})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 3, Concurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Samples[0].TLSHandshake).To(BeNumerically(">", 0))
+			Expect(result.Samples[0].TLSHandshake).To(BeNumerically("<=", result.Samples[0].Connect))
+			Expect(result.Samples[2].TLSHandshake).To(BeZero())
+			Expect(result.TLSHandshakes).To(Equal(1))
+			Expect(result.TLSResumed).To(BeZero())
+			Expect(result.TLSHandshakeTime).To(Equal(result.Samples[0].TLSHandshake))
+		})
+
+		It("resumes sessions when asked to", func() {
+			tlsServer.StartTLS()
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{
+				URL:               tlsServer.URL,
+				DisableKeepAlives: true,
+				TLS:               loadgen.TLSConfig{SessionResumption: true},
+			})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 3, Concurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.TLSHandshakes).To(Equal(3))
+			Expect(result.TLSResumed).To(Equal(2))
+		})
+
+		It("verifies the router with the CA bundle", func() {
+			tlsServer.StartTLS()
+			ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{
+				URL: tlsServer.URL,
+				TLS: loadgen.TLSConfig{CA: ca, ServerName: "example.com"},
+			})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 1, Concurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Errors).To(BeZero())
+
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{
+				URL: tlsServer.URL,
+				TLS: loadgen.TLSConfig{CA: ca, ServerName: "other.example.org"},
+			})
+			result, err = generator.Run(context.Background(), loadgen.Step{NumRequests: 1, Concurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Errors).To(Equal(1))
+		})
+
+		It("presents the client certificate for mutual TLS", func() {
+			cert, key := selfSignedCert()
+			clientCAs := x509.NewCertPool()
+			Expect(clientCAs.AppendCertsFromPEM(cert)).To(BeTrue())
+			tlsServer.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+			tlsServer.StartTLS()
+
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: tlsServer.URL})
+			result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 1, Concurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Errors).To(Equal(1))
+
+			generator = loadgen.NewHTTPGenerator(loadgen.Config{URL: tlsServer.URL, TLS: loadgen.TLSConfig{Cert: cert, Key: key}})
+			result, err = generator.Run(context.Background(), loadgen.Step{NumRequests: 1, Concurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Errors).To(BeZero())
+		})
+	})
+
+	Describe("Config", func() {
+		It("accepts matching protocols and schemes", func() {
+			Expect(loadgen.Config{URL: "http://router"}.Validate()).To(Succeed())
+			Expect(loadgen.Config{URL: "https://router", Protocol: loadgen.ProtocolHTTP2, StreamsPerConnection: 10}.Validate()).To(Succeed())
+			Expect(loadgen.Config{URL: "http://router", Protocol: loadgen.ProtocolH2C}.Validate()).To(Succeed())
+		})
+
+		It("rejects unknown protocols", func() {
+			Expect(loadgen.Config{URL: "http://router", Protocol: "spdy"}.Validate()).To(MatchError(`unknown protocol "spdy"`))
+		})
+
+		It("rejects protocols that do not match the scheme", func() {
+			Expect(loadgen.Config{URL: "http://router", Protocol: loadgen.ProtocolHTTP2}.Validate()).To(MatchError("protocol h2 requires an https URL"))
+			Expect(loadgen.Config{URL: "https://router", Protocol: loadgen.ProtocolH2C}.Validate()).To(MatchError("protocol h2c requires an http URL"))
+		})
+
+		It("rejects a maximum of requests per connection over HTTP/2", func() {
+			Expect(loadgen.Config{URL: "https://router", Protocol: loadgen.ProtocolHTTP2, MaxRequestsPerConnection: 1}.Validate()).To(MatchError("a maximum of requests per connection is not supported with protocol h2"))
+			Expect(loadgen.Config{URL: "http://router", Protocol: loadgen.ProtocolH2C, MaxRequestsPerConnection: 1}.Validate()).To(MatchError("a maximum of requests per connection is not supported with protocol h2c"))
+		})
+
+		It("rejects multiplexing over HTTP/1.1", func() {
+			Expect(loadgen.Config{URL: "http://router", StreamsPerConnection: 2}.Validate()).To(HaveOccurred())
+		})
+	})
+})
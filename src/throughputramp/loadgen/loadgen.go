@@ -0,0 +1,192 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"throughputramp/histogram"
+)
+
+// MaxLatency is the highest response time recorded in the latency
+// histograms. Longer response times are recorded as MaxLatency.
+const MaxLatency = time.Hour
+
+// Sample is the outcome of a single request. For open-loop steps Start is
+// the time the request was scheduled to be sent, so ResponseTime includes
+// any time spent waiting for a free worker.
+//
+// The phases split up the response time: Connect is the time taken to obtain
+// a connection, including DNS lookup, dial and TLS handshake when a new
+// connection is opened, RequestWrite the time to send the request,
+// ResponseDelay the time until the first response byte and ResponseRead the
+// time to read the rest of the response.
+//
+// TLSHandshake is the duration of the TLS handshake of a new connection, part
+// of Connect, and TLSResumed whether it resumed an earlier session. Both are
+// zero when the request reused a connection.
+//
+// Host is the Host header of the request. Protocol is the protocol of the
+// response as in http.Response.Proto, for example HTTP/1.1 or HTTP/2.0. Agent
+// names the load agent that sent the request in distributed runs.
+type Sample struct {
+	Start         time.Time
+	ResponseTime  time.Duration
+	ScheduleDelay time.Duration
+	StatusCode    int
+	Host          string
+	Protocol      string
+	Err           error
+
+	ConnReused    bool
+	DNS           time.Duration
+	Connect       time.Duration
+	RequestWrite  time.Duration
+	ResponseDelay time.Duration
+	ResponseRead  time.Duration
+	TLSHandshake  time.Duration
+	TLSResumed    bool
+
+	Agent string
+}
+
+type Step struct {
+	NumRequests int
+	Concurrency int
+	// RateLimit is the maximum number of requests per second sent by each
+	// worker. Zero means no limit.
+	RateLimit int
+	// Rate switches the step to open-loop mode: requests are scheduled at a
+	// constant Rate per second across all workers, independently of how
+	// quickly earlier requests complete. Concurrency caps the requests in
+	// flight and RateLimit is ignored.
+	Rate int
+	// Duration bounds the step by wall-clock time instead of, or in addition
+	// to, NumRequests. Requests in flight when it elapses are completed.
+	Duration time.Duration
+	// Warmup is run before the step with the same settings. Its samples are
+	// discarded.
+	Warmup time.Duration
+}
+
+// Result holds the outcome of a step together with the boundaries of its
+// measured window, which excludes the warm-up. Latency records the response
+// times of all requests that received a response in microseconds. NonSuccess
+// counts the requests that did not receive a 2xx response, or a 101 for
+// WebSocket messages, including the ones that failed. Completed counts the
+// requests that received a response in each second of the measured window and
+// Protocols the responses received with each protocol. TLSHandshakes counts
+// the connections that completed a TLS handshake, TLSResumed the ones that
+// resumed a session, and TLSHandshakeTime is the time spent in all of the
+// handshakes. ConnectionsOpened and ConnectionsClosed count the connections
+// opened and closed during the measured window. For streams, Upgrades counts
+// the connections that were upgraded or received an event stream, UpgradeTime
+// is the time spent in all of the upgrades and Drops counts the connections
+// that failed before the end of the step. Samples is only filled when
+// Config.KeepSamples is set.
+//
+// In distributed runs Agents holds the results of the individual load agents
+// the step was merged from, each with Agent set.
+type Result struct {
+	Step              Step
+	Start             time.Time
+	End               time.Time
+	Requests          int
+	Errors            int
+	ConnectErrors     int
+	NonSuccess        int
+	Latency           *histogram.Histogram
+	Completed         []int
+	Protocols         map[string]int
+	TLSHandshakes     int
+	TLSResumed        int
+	TLSHandshakeTime  time.Duration
+	ConnectionsOpened int
+	ConnectionsClosed int
+	Upgrades          int
+	UpgradeTime       time.Duration
+	Drops             int
+	Samples           []Sample
+	Agent             string
+	Agents            []Result
+}
+
+func NewResult(step Step, start time.Time) Result {
+	latency, err := histogram.New(1, int64(MaxLatency/time.Microsecond), 3)
+	if err != nil {
+		panic(err)
+	}
+	return Result{Step: step, Start: start, Latency: latency}
+}
+
+// Record counts s and adds its response time to the latency histogram.
+func (r *Result) Record(s Sample) {
+	r.Requests++
+	if s.TLSHandshake > 0 {
+		r.TLSHandshakes++
+		r.TLSHandshakeTime += s.TLSHandshake
+		if s.TLSResumed {
+			r.TLSResumed++
+		}
+	}
+	if (s.StatusCode < 200 || s.StatusCode > 299) && s.StatusCode != http.StatusSwitchingProtocols {
+		r.NonSuccess++
+	}
+	if s.Err != nil {
+		r.Errors++
+		if IsConnectError(s.Err) {
+			r.ConnectErrors++
+		}
+		return
+	}
+	latency := s.ResponseTime
+	if latency > MaxLatency {
+		latency = MaxLatency
+	}
+	r.Latency.Record(int64(latency / time.Microsecond))
+
+	second := int(s.Start.Add(s.ResponseTime).Sub(r.Start) / time.Second)
+	if second < 0 {
+		second = 0
+	}
+	for len(r.Completed) <= second {
+		r.Completed = append(r.Completed, 0)
+	}
+	r.Completed[second]++
+
+	if s.Protocol != "" {
+		if r.Protocols == nil {
+			r.Protocols = make(map[string]int)
+		}
+		r.Protocols[s.Protocol]++
+	}
+}
+
+func (s Step) expectedRequests() int {
+	n := s.NumRequests
+	if s.Duration > 0 && s.Rate > 0 {
+		byDuration := int(s.Duration.Seconds()*float64(s.Rate)) + 1
+		if n == 0 || byDuration < n {
+			n = byDuration
+		}
+	}
+	return n
+}
+
+func (s Step) String() string {
+	amount := fmt.Sprintf("%d requests", s.NumRequests)
+	if s.NumRequests == 0 {
+		amount = fmt.Sprintf("%s of requests", s.Duration)
+	} else if s.Duration > 0 {
+		amount = fmt.Sprintf("%d requests within %s", s.NumRequests, s.Duration)
+	}
+	if s.Rate > 0 {
+		return fmt.Sprintf("%s at %d requests per second with %d workers", amount, s.Rate, s.Concurrency)
+	}
+	return fmt.Sprintf("%s, %d concurrency, and %d rate limit", amount, s.Concurrency, s.RateLimit)
+}
+
+type Generator interface {
+	Run(ctx context.Context, step Step) (Result, error)
+}
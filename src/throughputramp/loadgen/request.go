@@ -0,0 +1,239 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Placeholders replaced in the templated parts of every request.
+const (
+	PlaceholderSeq    = "{{seq}}"
+	PlaceholderRandom = "{{random}}"
+)
+
+// RequestTemplate describes the requests sent to the router. The values of
+// Header and Query and a fixed Body may contain placeholders that are replaced
+// for every request: {{seq}} with the sequence number of the request within
+// the step, starting at 1 after the warm-up, and {{random}} with a random
+// token of 16 hex digits. Any other text is sent as is. Instead of a fixed
+// Body, BodyMaxSize sends a random body of BodyMinSize to BodyMaxSize bytes
+// with every request. An empty Method means GET.
+type RequestTemplate struct {
+	Method      string
+	Header      http.Header
+	Query       url.Values
+	Body        []byte
+	BodyMinSize int
+	BodyMaxSize int
+}
+
+// Validate checks the method, the headers and the body sizes.
+func (t RequestTemplate) Validate() error {
+	_, err := t.builder("http://router", 0)
+	return err
+}
+
+func (t RequestTemplate) empty() bool {
+	return (t.Method == "" || t.Method == http.MethodGet) && len(t.Header) == 0 && len(t.Query) == 0 &&
+		len(t.Body) == 0 && t.BodyMaxSize == 0
+}
+
+// requestBuilder creates the requests of a step from a template. It is safe
+// for concurrent use.
+type requestBuilder struct {
+	method  string
+	url     string
+	query   []queryParam
+	header  []headerField
+	body    text
+	hasBody bool
+
+	bodyMin, bodyMax int
+	random           []byte
+
+	seq int64
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+type queryParam struct {
+	name  string
+	value text
+}
+
+type headerField struct {
+	name  string
+	value text
+}
+
+func (t RequestTemplate) builder(rawURL string, seed int64) (*requestBuilder, error) {
+	b := &requestBuilder{
+		method: t.Method,
+		url:    rawURL,
+		rnd:    rand.New(rand.NewSource(seed)),
+	}
+	if b.method == "" {
+		b.method = http.MethodGet
+	}
+	if strings.IndexFunc(b.method, func(r rune) bool { return r <= ' ' || r >= 0x7f }) >= 0 {
+		return nil, fmt.Errorf("invalid method %q", b.method)
+	}
+
+	for _, name := range sortedKeys(t.Query) {
+		for _, v := range t.Query[name] {
+			b.query = append(b.query, queryParam{name: name, value: parseText(v)})
+		}
+	}
+	for _, name := range sortedKeys(t.Header) {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			return nil, errors.New("the Host header is set with the host or the routes")
+		}
+		for _, v := range t.Header[name] {
+			b.header = append(b.header, headerField{name: name, value: parseText(v)})
+		}
+	}
+
+	switch {
+	case t.BodyMaxSize > 0:
+		if len(t.Body) > 0 {
+			return nil, errors.New("a fixed body cannot be combined with a random body size")
+		}
+		if t.BodyMinSize < 0 || t.BodyMinSize > t.BodyMaxSize {
+			return nil, errors.New("minimum body size must be between 0 and the maximum body size")
+		}
+		b.bodyMin, b.bodyMax = t.BodyMinSize, t.BodyMaxSize
+	case t.BodyMinSize != 0 || t.BodyMaxSize < 0:
+		return nil, errors.New("a random body needs a positive maximum size")
+	case len(t.Body) > 0:
+		b.body = parseText(string(t.Body))
+		b.hasBody = true
+	}
+	return b, nil
+}
+
+// restart numbers the following requests from 1 again.
+func (b *requestBuilder) restart() {
+	atomic.StoreInt64(&b.seq, 0)
+}
+
+// new returns the next request.
+func (b *requestBuilder) new(ctx context.Context) (*http.Request, error) {
+	seq := atomic.AddInt64(&b.seq, 1)
+
+	rawURL := b.url
+	if len(b.query) > 0 {
+		var query strings.Builder
+		for i, p := range b.query {
+			if i > 0 {
+				query.WriteByte('&')
+			}
+			query.WriteString(url.QueryEscape(p.name))
+			query.WriteByte('=')
+			query.WriteString(url.QueryEscape(p.value.render(b, seq)))
+		}
+		sep := "?"
+		if strings.Contains(rawURL, "?") {
+			sep = "&"
+		}
+		rawURL += sep + query.String()
+	}
+
+	var body io.Reader
+	if b.bodyMax > 0 {
+		body = bytes.NewReader(b.randomBody())
+	} else if b.hasBody {
+		body = strings.NewReader(b.body.render(b, seq))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, b.method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range b.header {
+		req.Header.Add(h.name, h.value.render(b, seq))
+	}
+	return req, nil
+}
+
+// randomBody returns random bytes of a random length between the minimum and
+// maximum body size. The bytes are generated once and shared by all bodies.
+func (b *requestBuilder) randomBody() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.random == nil {
+		b.random = make([]byte, b.bodyMax)
+		b.rnd.Read(b.random)
+	}
+	return b.random[:b.bodyMin+b.rnd.Intn(b.bodyMax-b.bodyMin+1)]
+}
+
+func (b *requestBuilder) token() string {
+	var buf [8]byte
+	b.mu.Lock()
+	b.rnd.Read(buf[:])
+	b.mu.Unlock()
+	return hex.EncodeToString(buf[:])
+}
+
+// text is a string split into literal parts and placeholders.
+type text []string
+
+func parseText(s string) text {
+	var t text
+	for s != "" {
+		i, placeholder := strings.Index(s, PlaceholderSeq), PlaceholderSeq
+		if j := strings.Index(s, PlaceholderRandom); j >= 0 && (i < 0 || j < i) {
+			i, placeholder = j, PlaceholderRandom
+		}
+		if i < 0 {
+			t = append(t, s)
+			break
+		}
+		if i > 0 {
+			t = append(t, s[:i])
+		}
+		t = append(t, placeholder)
+		s = s[i+len(placeholder):]
+	}
+	return t
+}
+
+// render replaces the placeholders with the values of request seq of b.
+func (t text) render(b *requestBuilder, seq int64) string {
+	if len(t) == 1 && t[0] != PlaceholderSeq && t[0] != PlaceholderRandom {
+		return t[0]
+	}
+	var s strings.Builder
+	for _, part := range t {
+		switch part {
+		case PlaceholderSeq:
+			s.WriteString(strconv.FormatInt(seq, 10))
+		case PlaceholderRandom:
+			s.WriteString(b.token())
+		default:
+			s.WriteString(part)
+		}
+	}
+	return s.String()
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,131 @@
+package loadgen_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequestTemplate", func() {
+	var (
+		server   *httptest.Server
+		mu       sync.Mutex
+		requests []*http.Request
+		bodies   []string
+	)
+
+	BeforeEach(func() {
+		requests, bodies = nil, nil
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(req.Body)
+			Expect(err).NotTo(HaveOccurred())
+			mu.Lock()
+			requests = append(requests, req)
+			bodies = append(bodies, string(body))
+			mu.Unlock()
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	run := func(template loadgen.RequestTemplate, n int) {
+		generator := loadgen.NewHTTPGenerator(loadgen.Config{URL: server.URL + "/", Request: template})
+		result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: n, Concurrency: 1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Errors).To(BeZero())
+		Expect(requests).To(HaveLen(n))
+	}
+
+	It("sends GET requests without a body by default", func() {
+		run(loadgen.RequestTemplate{}, 2)
+		Expect(requests[0].Method).To(Equal("GET"))
+		Expect(requests[0].URL.RawQuery).To(BeEmpty())
+		Expect(bodies[0]).To(BeEmpty())
+	})
+
+	It("sends the method, headers, query and body", func() {
+		run(loadgen.RequestTemplate{
+			Method: "POST",
+			Header: http.Header{"Content-Type": {"application/json"}, "X-Tag": {"a", "b"}},
+			Query:  map[string][]string{"size": {"large"}, "q": {"a b"}},
+			Body:   []byte(`{"name":"test"}`),
+		}, 2)
+		for i, req := range requests {
+			Expect(req.Method).To(Equal("POST"))
+			Expect(req.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(req.Header["X-Tag"]).To(Equal([]string{"a", "b"}))
+			Expect(req.URL.RawQuery).To(Equal("q=a+b&size=large"))
+			Expect(req.ContentLength).To(BeEquivalentTo(15))
+			Expect(bodies[i]).To(Equal(`{"name":"test"}`))
+		}
+	})
+
+	It("replaces the placeholders for every request", func() {
+		run(loadgen.RequestTemplate{
+			Method: "PUT",
+			Header: http.Header{"X-Request-Id": {"req-{{seq}}"}},
+			Query:  map[string][]string{"token": {"{{random}}"}},
+			Body:   []byte(`{"id":{{seq}},"token":"{{random}}","raw":"{{other}}"}`),
+		}, 3)
+		for i, req := range requests {
+			Expect(req.Header.Get("X-Request-Id")).To(Equal([]string{"req-1", "req-2", "req-3"}[i]))
+			Expect(req.URL.Query().Get("token")).To(MatchRegexp(`^[0-9a-f]{16}$`))
+			Expect(bodies[i]).To(MatchRegexp(`^\{"id":%d,"token":"[0-9a-f]{16}","raw":"\{\{other\}\}"\}$`, i+1))
+		}
+		Expect(requests[0].URL.Query().Get("token")).NotTo(Equal(requests[1].URL.Query().Get("token")))
+	})
+
+	It("keeps the query of the URL", func() {
+		generator := loadgen.NewHTTPGenerator(loadgen.Config{
+			URL:     server.URL + "/?a=1",
+			Request: loadgen.RequestTemplate{Query: map[string][]string{"b": {"2"}}},
+		})
+		_, err := generator.Run(context.Background(), loadgen.Step{NumRequests: 1, Concurrency: 1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests[0].URL.RawQuery).To(Equal("a=1&b=2"))
+	})
+
+	It("sends random bodies within the size range", func() {
+		run(loadgen.RequestTemplate{Method: "POST", BodyMinSize: 100, BodyMaxSize: 200}, 50)
+		sizes := make(map[int]bool)
+		for i, req := range requests {
+			Expect(req.ContentLength).To(BeNumerically(">=", 100))
+			Expect(req.ContentLength).To(BeNumerically("<=", 200))
+			Expect(bodies[i]).To(HaveLen(int(req.ContentLength)))
+			sizes[len(bodies[i])] = true
+		}
+		Expect(len(sizes)).To(BeNumerically(">", 1))
+	})
+
+	It("sends random bodies of a fixed size", func() {
+		run(loadgen.RequestTemplate{Method: "POST", BodyMinSize: 1 << 20, BodyMaxSize: 1 << 20}, 2)
+		Expect(bodies[0]).To(HaveLen(1 << 20))
+		Expect(bodies[1]).To(HaveLen(1 << 20))
+	})
+
+	It("rejects invalid templates", func() {
+		for _, c := range []struct {
+			template loadgen.RequestTemplate
+			err      string
+		}{
+			{loadgen.RequestTemplate{Method: "GE T"}, `invalid method "GE T"`},
+			{loadgen.RequestTemplate{Header: http.Header{"Host": {"example.com"}}}, "the Host header is set with the host or the routes"},
+			{loadgen.RequestTemplate{Body: []byte("body"), BodyMaxSize: 10}, "a fixed body cannot be combined with a random body size"},
+			{loadgen.RequestTemplate{BodyMinSize: 20, BodyMaxSize: 10}, "minimum body size must be between 0 and the maximum body size"},
+			{loadgen.RequestTemplate{BodyMinSize: 10}, "a random body needs a positive maximum size"},
+		} {
+			Expect(c.template.Validate()).To(MatchError(c.err))
+		}
+		config := loadgen.Config{URL: "http://router", Request: loadgen.RequestTemplate{BodyMinSize: 10}}
+		Expect(config.Validate()).To(MatchError("a random body needs a positive maximum size"))
+	})
+})
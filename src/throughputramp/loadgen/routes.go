@@ -0,0 +1,100 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// Distributions of the requests across routes.
+const (
+	DistributionRoundRobin = "round-robin"
+	DistributionUniform    = "uniform"
+	DistributionZipf       = "zipf"
+	DistributionHotSet     = "hot-set"
+)
+
+// Routes are the routes registered by http_route_populator,
+// <AppName>-<i>.<AppDomain> for i from 0 to Count-1, that the requests are
+// spread across by setting their Host header.
+//
+// Round-robin cycles through the routes in order and uniform picks each of
+// them with the same probability. Zipf picks route i with a probability
+// proportional to 1/(i+1)^ZipfExponent, so the first routes get most of the
+// traffic. Hot-set sends the fraction HotTraffic of the requests to the first
+// HotRoutes routes and the rest to the others, both uniformly.
+type Routes struct {
+	AppName      string
+	AppDomain    string
+	Count        int
+	Distribution string
+	ZipfExponent float64
+	HotRoutes    int
+	HotTraffic   float64
+}
+
+func (r Routes) enabled() bool {
+	return r.Count > 0 || r.AppName != "" || r.AppDomain != ""
+}
+
+// Validate checks that the routes and the parameters of their distribution
+// are complete.
+func (r Routes) Validate() error {
+	_, err := r.picker(0)
+	return err
+}
+
+// picker returns a function that returns the host of the next request. It is
+// safe for concurrent use.
+func (r Routes) picker(seed int64) (func() string, error) {
+	if r.AppName == "" || r.AppDomain == "" {
+		return nil, errors.New("routes need an app name and an app domain")
+	}
+	if r.Count < 1 {
+		return nil, errors.New("number of routes must be at least 1")
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	var pick func() int
+	switch r.Distribution {
+	case "", DistributionRoundRobin:
+		next := 0
+		pick = func() int {
+			i := next
+			next = (next + 1) % r.Count
+			return i
+		}
+	case DistributionUniform:
+		pick = func() int { return rnd.Intn(r.Count) }
+	case DistributionZipf:
+		if r.ZipfExponent <= 1 {
+			return nil, errors.New("zipf exponent must be greater than 1")
+		}
+		zipf := rand.NewZipf(rnd, r.ZipfExponent, 1, uint64(r.Count-1))
+		pick = func() int { return int(zipf.Uint64()) }
+	case DistributionHotSet:
+		if r.HotRoutes < 1 || r.HotRoutes >= r.Count {
+			return nil, errors.New("number of hot routes must be at least 1 and below the number of routes")
+		}
+		if r.HotTraffic < 0 || r.HotTraffic > 1 {
+			return nil, errors.New("hot traffic must be between 0 and 1")
+		}
+		pick = func() int {
+			if rnd.Float64() < r.HotTraffic {
+				return rnd.Intn(r.HotRoutes)
+			}
+			return r.HotRoutes + rnd.Intn(r.Count-r.HotRoutes)
+		}
+	default:
+		return nil, fmt.Errorf("unknown route distribution %q", r.Distribution)
+	}
+
+	var mu sync.Mutex
+	return func() string {
+		mu.Lock()
+		i := pick()
+		mu.Unlock()
+		return fmt.Sprintf("%s-%d.%s", r.AppName, i, r.AppDomain)
+	}, nil
+}
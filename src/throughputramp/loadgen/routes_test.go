@@ -0,0 +1,94 @@
+package loadgen_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Routes", func() {
+	var (
+		server *ghttp.Server
+		mu     sync.Mutex
+		hosts  map[string]int
+	)
+
+	BeforeEach(func() {
+		hosts = make(map[string]int)
+		server = ghttp.NewServer()
+		server.RouteToHandler("GET", "/", func(rw http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			hosts[req.Host]++
+			mu.Unlock()
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	run := func(routes loadgen.Routes, n int) loadgen.Result {
+		generator := loadgen.NewHTTPGenerator(loadgen.Config{URL: server.URL(), Routes: routes, KeepSamples: true})
+		result, err := generator.Run(context.Background(), loadgen.Step{NumRequests: n, Concurrency: 4})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Errors).To(BeZero())
+		return result
+	}
+
+	It("cycles through the routes of http_route_populator", func() {
+		result := run(loadgen.Routes{AppName: "sample", AppDomain: "apps.com", Count: 3}, 30)
+		Expect(hosts).To(Equal(map[string]int{
+			"sample-0.apps.com": 10,
+			"sample-1.apps.com": 10,
+			"sample-2.apps.com": 10,
+		}))
+		Expect(result.Samples[0].Host).To(MatchRegexp(`^sample-\d\.apps\.com$`))
+	})
+
+	It("picks the routes uniformly", func() {
+		run(loadgen.Routes{AppName: "sample", AppDomain: "apps.com", Count: 4, Distribution: loadgen.DistributionUniform}, 400)
+		Expect(hosts).To(HaveLen(4))
+		for _, count := range hosts {
+			Expect(count).To(BeNumerically("~", 100, 50))
+		}
+	})
+
+	It("concentrates the requests on the first routes with zipf", func() {
+		run(loadgen.Routes{AppName: "sample", AppDomain: "apps.com", Count: 1000, Distribution: loadgen.DistributionZipf, ZipfExponent: 2}, 400)
+		Expect(hosts["sample-0.apps.com"]).To(BeNumerically(">", 160))
+		Expect(hosts["sample-0.apps.com"]).To(BeNumerically(">", hosts["sample-1.apps.com"]))
+	})
+
+	It("sends the hot traffic to the hot set", func() {
+		run(loadgen.Routes{AppName: "sample", AppDomain: "apps.com", Count: 100, Distribution: loadgen.DistributionHotSet, HotRoutes: 2, HotTraffic: 0.9}, 400)
+		hot := hosts["sample-0.apps.com"] + hosts["sample-1.apps.com"]
+		Expect(hot).To(BeNumerically("~", 360, 40))
+	})
+
+	It("rejects incomplete routes and distributions", func() {
+		for _, c := range []struct {
+			routes loadgen.Routes
+			err    string
+		}{
+			{loadgen.Routes{AppName: "sample", Count: 10}, "routes need an app name and an app domain"},
+			{loadgen.Routes{AppName: "sample", AppDomain: "apps.com"}, "number of routes must be at least 1"},
+			{loadgen.Routes{AppName: "sample", AppDomain: "apps.com", Count: 10, Distribution: "pareto"}, `unknown route distribution "pareto"`},
+			{loadgen.Routes{AppName: "sample", AppDomain: "apps.com", Count: 10, Distribution: loadgen.DistributionZipf, ZipfExponent: 1}, "zipf exponent must be greater than 1"},
+			{loadgen.Routes{AppName: "sample", AppDomain: "apps.com", Count: 10, Distribution: loadgen.DistributionHotSet, HotRoutes: 10}, "number of hot routes must be at least 1 and below the number of routes"},
+			{loadgen.Routes{AppName: "sample", AppDomain: "apps.com", Count: 10, Distribution: loadgen.DistributionHotSet, HotRoutes: 1, HotTraffic: 2}, "hot traffic must be between 0 and 1"},
+		} {
+			Expect(c.routes.Validate()).To(MatchError(c.err))
+		}
+	})
+
+	It("cannot be combined with a host", func() {
+		config := loadgen.Config{URL: "http://router", Host: "example.com", Routes: loadgen.Routes{AppName: "sample", AppDomain: "apps.com", Count: 10}}
+		Expect(config.Validate()).To(MatchError("a host cannot be combined with routes"))
+	})
+})
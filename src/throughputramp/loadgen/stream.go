@@ -0,0 +1,358 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of streams.
+const (
+	StreamWebSocket = "websocket"
+	StreamSSE       = "sse"
+)
+
+// StreamConfig switches the native generator from sending requests to
+// holding long-lived connections through the router. Every worker of a step
+// opens one connection and keeps it until the step's duration elapses. A
+// connection that fails before is dropped and not reopened.
+//
+// With WebSocket the connection is upgraded and the worker sends messages of
+// MessageSize bytes that the backend must echo, at most MessageRate per
+// second, waiting for the echo of each before sending the next one. Every
+// message is a sample timed by its round trip.
+//
+// With SSE the worker requests an event stream and reads the events the
+// backend sends. Every event is a sample timed by the gap since the previous
+// one, or since the response headers for the first one, which shows the
+// router buffering the stream. MessageRate and MessageSize do not apply.
+type StreamConfig struct {
+	Kind        string
+	MessageRate int
+	MessageSize int
+}
+
+func (c StreamConfig) enabled() bool {
+	return c.Kind != ""
+}
+
+// Validate checks the kind of stream and its message rate and size.
+func (c StreamConfig) Validate() error {
+	if c.Kind != StreamWebSocket && c.Kind != StreamSSE {
+		return fmt.Errorf("unknown stream %q, use %s or %s", c.Kind, StreamWebSocket, StreamSSE)
+	}
+	if c.MessageRate < 0 || c.MessageSize < 0 {
+		return errors.New("message rate and size must not be negative")
+	}
+	return nil
+}
+
+// streamSession is shared by the workers of a stream step.
+type streamSession struct {
+	url       *url.URL
+	conns     *connTracker
+	tlsConfig *tls.Config
+	client    *http.Client
+	host      func() string
+
+	mu          sync.Mutex
+	upgrades    int
+	upgradeTime time.Duration
+	drops       int
+}
+
+func (s *streamSession) upgraded(d time.Duration) {
+	s.mu.Lock()
+	s.upgrades++
+	s.upgradeTime += d
+	s.mu.Unlock()
+}
+
+func (s *streamSession) dropped() {
+	s.mu.Lock()
+	s.drops++
+	s.mu.Unlock()
+}
+
+// runStreams runs a step of long-lived connections as described by
+// StreamConfig.
+func (g *HTTPGenerator) runStreams(ctx context.Context, step Step, tlsConfig *tls.Config) (Result, error) {
+	if step.Duration == 0 {
+		return Result{}, errors.New("streams need a step duration")
+	}
+	if step.Rate > 0 {
+		return Result{}, errors.New("streams do not support open-loop rate steps")
+	}
+	u, err := url.Parse(g.config.URL)
+	if err != nil {
+		return Result{}, err
+	}
+
+	conns := newConnTracker(g.config.ConnectionRate)
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	transport := &http.Transport{
+		DialContext:           conns.dial,
+		TLSClientConfig:       tlsConfig,
+		ResponseHeaderTimeout: g.config.Timeout,
+		Protocols:             protocols,
+	}
+	defer transport.CloseIdleConnections()
+	s := &streamSession{
+		url:       u,
+		conns:     conns,
+		tlsConfig: tlsConfig,
+		client:    &http.Client{Transport: transport},
+		host:      func() string { return g.config.Host },
+	}
+	if g.config.Routes.enabled() {
+		if s.host, err = g.config.Routes.picker(time.Now().UnixNano()); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if step.Warmup > 0 {
+		warmup := step
+		warmup.Duration = step.Warmup
+		g.stream(ctx, s, warmup, func(Sample) {})
+	}
+
+	result := NewResult(step, time.Now())
+	openedBefore, closedBefore := conns.counts()
+	s.upgrades, s.upgradeTime, s.drops = 0, 0, 0
+	g.stream(ctx, s, step, func(sample Sample) {
+		result.Record(sample)
+		if g.Observe != nil {
+			g.Observe(sample)
+		}
+		if g.config.KeepSamples {
+			result.Samples = append(result.Samples, sample)
+		}
+	})
+	result.End = time.Now()
+	opened, closed := conns.counts()
+	result.ConnectionsOpened = opened - openedBefore
+	result.ConnectionsClosed = closed - closedBefore
+	result.Upgrades, result.UpgradeTime, result.Drops = s.upgrades, s.upgradeTime, s.drops
+	return result, ctx.Err()
+}
+
+// stream holds a connection per worker of step until its duration elapses
+// and passes each sample to record, which is called from a single
+// goroutine.
+func (g *HTTPGenerator) stream(ctx context.Context, s *streamSession, step Step, record func(Sample)) {
+	results := make(chan Sample, step.Concurrency)
+	collected := make(chan struct{})
+	go func() {
+		for sample := range results {
+			record(sample)
+		}
+		close(collected)
+	}()
+
+	deadline := time.Now().Add(step.Duration)
+	var wg sync.WaitGroup
+	for w := 0; w < step.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if g.config.Stream.Kind == StreamSSE {
+				g.eventStream(ctx, s, deadline, results)
+			} else {
+				g.webSocket(ctx, s, deadline, results)
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+	<-collected
+}
+
+// webSocket upgrades a connection and exchanges messages over it until the
+// deadline.
+func (g *HTTPGenerator) webSocket(ctx context.Context, s *streamSession, deadline time.Time, results chan<- Sample) {
+	start := time.Now()
+	ws, resp, host, err := s.dialWebSocket(ctx, g.config.Timeout)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		sample := Sample{Start: start, ResponseTime: time.Since(start), Host: host, Err: err}
+		if resp != nil {
+			sample.StatusCode = resp.StatusCode
+		}
+		results <- sample
+		return
+	}
+	s.upgraded(time.Since(start))
+	stop := context.AfterFunc(ctx, func() { ws.conn.Close() })
+	defer stop()
+	defer ws.close()
+
+	var throttle <-chan time.Time
+	if rate := g.config.Stream.MessageRate; rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+	end := time.NewTimer(time.Until(deadline))
+	defer end.Stop()
+
+	for seq := 1; ; seq++ {
+		if throttle != nil {
+			select {
+			case <-throttle:
+			case <-end.C:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() != nil || !time.Now().Before(deadline) {
+			return
+		}
+		sample := Sample{Start: time.Now(), Host: host, StatusCode: resp.StatusCode, Protocol: resp.Proto}
+		err := ws.roundTrip(streamMessage(seq, g.config.Stream.MessageSize), g.config.Timeout)
+		sample.ResponseTime = time.Since(sample.Start)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			sample.Err = err
+			results <- sample
+			s.dropped()
+			return
+		}
+		results <- sample
+	}
+}
+
+// dialWebSocket opens a connection to the router and upgrades it. It returns
+// the Host header the upgrade was sent with.
+func (s *streamSession) dialWebSocket(ctx context.Context, timeout time.Duration) (*wsConn, *http.Response, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url.String(), nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if host := s.host(); host != "" {
+		req.Host = host
+	}
+
+	addr := s.url.Host
+	if s.url.Port() == "" {
+		port := "80"
+		if s.url.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(s.url.Hostname(), port)
+	}
+	conn, err := s.conns.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, req.Host, err
+	}
+	if s.url.Scheme == "https" {
+		config := s.tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = s.url.Hostname()
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, nil, req.Host, err
+		}
+		conn = tlsConn
+	}
+
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	ws, resp, err := upgradeWebSocket(conn, req)
+	if err != nil {
+		conn.Close()
+		return nil, resp, req.Host, err
+	}
+	return ws, resp, req.Host, nil
+}
+
+// eventStream requests an event stream and reads its events until the
+// deadline.
+func (g *HTTPGenerator) eventStream(ctx context.Context, s *streamSession, deadline time.Time, results chan<- Sample) {
+	streamCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, s.url.String(), nil)
+	if err != nil {
+		results <- Sample{Start: start, Err: err}
+		return
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if host := s.host(); host != "" {
+		req.Host = host
+	}
+
+	sample := Sample{Start: start, Host: req.Host}
+	resp, err := s.client.Do(req)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		sample.StatusCode = resp.StatusCode
+		resp.Body.Close()
+		err = fmt.Errorf("event stream failed with status %d", resp.StatusCode)
+	}
+	if err != nil {
+		if streamCtx.Err() != nil {
+			return
+		}
+		sample.ResponseTime = time.Since(start)
+		sample.Err = err
+		results <- sample
+		return
+	}
+	defer resp.Body.Close()
+	s.upgraded(time.Since(start))
+
+	// An event is dispatched at the blank line that ends it, provided it
+	// had a data field. Comments and other fields are skipped.
+	events := bufio.NewReader(resp.Body)
+	last, data := time.Now(), false
+	for {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			if streamCtx.Err() != nil {
+				return
+			}
+			results <- Sample{Start: last, ResponseTime: time.Since(last), Host: req.Host, StatusCode: resp.StatusCode, Protocol: resp.Proto, Err: err}
+			s.dropped()
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			data = data || line == "data" || strings.HasPrefix(line, "data:")
+			continue
+		}
+		if !data {
+			continue
+		}
+		now := time.Now()
+		results <- Sample{Start: last, ResponseTime: now.Sub(last), Host: req.Host, StatusCode: resp.StatusCode, Protocol: resp.Proto}
+		last, data = now, false
+	}
+}
+
+// streamMessage returns message seq padded to size bytes.
+func streamMessage(seq, size int) []byte {
+	message := []byte(strconv.Itoa(seq))
+	for len(message) < size {
+		message = append(message, 'x')
+	}
+	return message
+}
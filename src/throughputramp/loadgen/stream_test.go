@@ -0,0 +1,279 @@
+package loadgen_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Streams", func() {
+	var (
+		server  *httptest.Server
+		handler http.HandlerFunc
+	)
+
+	BeforeEach(func() {
+		handler = nil
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			handler(rw, req)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	run := func(stream loadgen.StreamConfig, step loadgen.Step) loadgen.Result {
+		generator := loadgen.NewHTTPGenerator(loadgen.Config{
+			URL:         server.URL,
+			Host:        "app.example.com",
+			Timeout:     time.Second,
+			KeepSamples: true,
+			Stream:      stream,
+		})
+		result, err := generator.Run(context.Background(), step)
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+
+	Context("with WebSocket", func() {
+		var (
+			mu    sync.Mutex
+			sizes []int
+		)
+
+		BeforeEach(func() {
+			sizes = nil
+			handler = func(rw http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				Expect(req.Host).To(Equal("app.example.com"))
+				echoWebSocket(rw, req, 0, func(payload []byte) {
+					mu.Lock()
+					sizes = append(sizes, len(payload))
+					mu.Unlock()
+				})
+			}
+		})
+
+		It("exchanges messages at the message rate and times their round trips", func() {
+			result := run(
+				loadgen.StreamConfig{Kind: loadgen.StreamWebSocket, MessageRate: 20, MessageSize: 64},
+				loadgen.Step{Concurrency: 2, Duration: 500 * time.Millisecond},
+			)
+			Expect(result.Upgrades).To(Equal(2))
+			Expect(result.UpgradeTime).To(BeNumerically(">", 0))
+			Expect(result.Drops).To(BeZero())
+			Expect(result.Errors).To(BeZero())
+			Expect(result.NonSuccess).To(BeZero())
+			Expect(result.Requests).To(BeNumerically("~", 20, 4))
+			Expect(result.Latency.TotalCount()).To(BeEquivalentTo(result.Requests))
+			Expect(result.ConnectionsOpened).To(Equal(2))
+			Expect(result.ConnectionsClosed).To(Equal(2))
+			Expect(result.Samples[0].StatusCode).To(Equal(101))
+			Expect(result.Samples[0].Host).To(Equal("app.example.com"))
+			Expect(result.End.Sub(result.Start)).To(BeNumerically("<", 700*time.Millisecond))
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, size := range sizes {
+				Expect(size).To(Equal(64))
+			}
+		})
+
+		It("sends messages back to back without a message rate", func() {
+			result := run(
+				loadgen.StreamConfig{Kind: loadgen.StreamWebSocket},
+				loadgen.Step{Concurrency: 1, Duration: 200 * time.Millisecond},
+			)
+			Expect(result.Requests).To(BeNumerically(">", 20))
+		})
+
+		It("counts the connections the router drops", func() {
+			handler = func(rw http.ResponseWriter, req *http.Request) {
+				echoWebSocket(rw, req, 3, func([]byte) {})
+			}
+			result := run(
+				loadgen.StreamConfig{Kind: loadgen.StreamWebSocket, MessageRate: 50},
+				loadgen.Step{Concurrency: 2, Duration: 500 * time.Millisecond},
+			)
+			Expect(result.Upgrades).To(Equal(2))
+			Expect(result.Drops).To(Equal(2))
+			Expect(result.Requests).To(Equal(8))
+			Expect(result.Errors).To(Equal(2))
+		})
+
+		It("records failed upgrades as errors", func() {
+			handler = func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(http.StatusNotFound)
+			}
+			result := run(
+				loadgen.StreamConfig{Kind: loadgen.StreamWebSocket},
+				loadgen.Step{Concurrency: 2, Duration: 100 * time.Millisecond},
+			)
+			Expect(result.Upgrades).To(BeZero())
+			Expect(result.Requests).To(Equal(2))
+			Expect(result.Errors).To(Equal(2))
+			Expect(result.NonSuccess).To(Equal(2))
+			Expect(result.Samples[0].StatusCode).To(Equal(http.StatusNotFound))
+			Expect(result.Samples[0].Err).To(MatchError("websocket upgrade failed with status 404"))
+		})
+	})
+
+	Context("with SSE", func() {
+		sendEvents := func(n int) http.HandlerFunc {
+			return func(rw http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				Expect(req.Header.Get("Accept")).To(Equal("text/event-stream"))
+				rw.Header().Set("Content-Type", "text/event-stream")
+				for i := 0; n == 0 || i < n; i++ {
+					if i%2 == 0 {
+						fmt.Fprint(rw, ": keep-alive\n\n")
+					}
+					if _, err := fmt.Fprintf(rw, "id: %d\ndata: event %d\n\n", i, i); err != nil {
+						return
+					}
+					rw.(http.Flusher).Flush()
+					select {
+					case <-time.After(50 * time.Millisecond):
+					case <-req.Context().Done():
+						return
+					}
+				}
+			}
+		}
+
+		It("times the gaps between the events of every stream", func() {
+			handler = sendEvents(0)
+			result := run(
+				loadgen.StreamConfig{Kind: loadgen.StreamSSE},
+				loadgen.Step{Concurrency: 2, Duration: 500 * time.Millisecond},
+			)
+			Expect(result.Upgrades).To(Equal(2))
+			Expect(result.Drops).To(BeZero())
+			Expect(result.Errors).To(BeZero())
+			Expect(result.Requests).To(BeNumerically("~", 20, 4))
+			Expect(result.Latency.ValueAtPercentile(50)).To(BeNumerically("~", 50000, 30000))
+			Expect(result.Samples[0].StatusCode).To(Equal(http.StatusOK))
+			Expect(result.Samples[0].Host).To(Equal("app.example.com"))
+		})
+
+		It("counts the streams that end before the step", func() {
+			handler = sendEvents(2)
+			result := run(
+				loadgen.StreamConfig{Kind: loadgen.StreamSSE},
+				loadgen.Step{Concurrency: 1, Duration: 500 * time.Millisecond},
+			)
+			Expect(result.Upgrades).To(Equal(1))
+			Expect(result.Drops).To(Equal(1))
+			Expect(result.Requests).To(Equal(3))
+			Expect(result.Errors).To(Equal(1))
+			Expect(loadgen.ErrorClass(result.Samples[2].Err)).To(Equal(loadgen.ErrorClassEOF))
+		})
+	})
+
+	It("needs a step duration", func() {
+		generator := loadgen.NewHTTPGenerator(loadgen.Config{URL: server.URL, Stream: loadgen.StreamConfig{Kind: loadgen.StreamSSE}})
+		_, err := generator.Run(context.Background(), loadgen.Step{Concurrency: 1, NumRequests: 10})
+		Expect(err).To(MatchError("streams need a step duration"))
+	})
+
+	It("rejects invalid stream configurations", func() {
+		for _, c := range []struct {
+			config loadgen.Config
+			err    string
+		}{
+			{loadgen.Config{URL: "http://router", Stream: loadgen.StreamConfig{Kind: "grpc"}}, `unknown stream "grpc", use websocket or sse`},
+			{loadgen.Config{URL: "http://router", Stream: loadgen.StreamConfig{Kind: loadgen.StreamWebSocket, MessageRate: -1}}, "message rate and size must not be negative"},
+			{loadgen.Config{URL: "http://router", Protocol: loadgen.ProtocolH2C, Stream: loadgen.StreamConfig{Kind: loadgen.StreamSSE}}, "streams require protocol http1"},
+			{loadgen.Config{URL: "http://router", Request: loadgen.RequestTemplate{Method: "POST"}, Stream: loadgen.StreamConfig{Kind: loadgen.StreamSSE}}, "request templates cannot be combined with streams"},
+		} {
+			Expect(c.config.Validate()).To(MatchError(c.err))
+		}
+	})
+})
+
+// echoWebSocket upgrades the request and echoes up to max messages, or all
+// of them when max is zero, passing each to received. It pings the client
+// before the first echo.
+func echoWebSocket(rw http.ResponseWriter, req *http.Request, max int, received func([]byte)) {
+	conn, brw, err := rw.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	sum := sha1.Sum([]byte(req.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	brw.Write([]byte{0x89, 0x00})
+	brw.Flush()
+
+	for echoed := 0; max == 0 || echoed < max; {
+		opcode, payload, err := readClientFrame(brw.Reader)
+		if err != nil || opcode == 0x8 {
+			return
+		}
+		if opcode == 0xa {
+			continue
+		}
+		received(payload)
+		frame := []byte{0x80 | opcode}
+		switch n := len(payload); {
+		case n < 126:
+			frame = append(frame, byte(n))
+		case n <= 0xffff:
+			frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(n))
+		default:
+			frame = binary.BigEndian.AppendUint64(append(frame, 127), uint64(n))
+		}
+		brw.Write(append(frame, payload...))
+		brw.Flush()
+		echoed++
+	}
+}
+
+func readClientFrame(r *bufio.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := uint64(header[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return header[0] & 0x0f, payload, nil
+}
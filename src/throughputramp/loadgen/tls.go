@@ -0,0 +1,108 @@
+package loadgen
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig configures the client side of TLS connections to the router. The
+// certificates are PEM encoded. Without a CA bundle the router's certificate
+// is not verified. Versions are given as 1.0 to 1.3 and cipher suites by
+// their Go names, see tls.CipherSuiteName. Cipher suites only apply up to TLS
+// 1.2, the suites of TLS 1.3 cannot be configured.
+type TLSConfig struct {
+	CA                []byte
+	Cert              []byte
+	Key               []byte
+	ServerName        string
+	SessionResumption bool
+	MinVersion        string
+	MaxVersion        string
+	CipherSuites      []string
+}
+
+// ClientConfig returns the configuration for the TLS connections of a step.
+// With SessionResumption the connections share a session cache, so that only
+// the first one to the router does a full handshake.
+func (c TLSConfig) ClientConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         c.ServerName,
+	}
+	if len(c.CA) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(c.CA) {
+			return nil, errors.New("CA bundle contains no certificates")
+		}
+		config.RootCAs = pool
+		config.InsecureSkipVerify = false
+	}
+	if len(c.Cert) > 0 || len(c.Key) > 0 {
+		if len(c.Cert) == 0 || len(c.Key) == 0 {
+			return nil, errors.New("client certificate and key must be set together")
+		}
+		cert, err := tls.X509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if c.SessionResumption {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	var err error
+	if config.MinVersion, err = tlsVersion(c.MinVersion); err != nil {
+		return nil, err
+	}
+	if config.MaxVersion, err = tlsVersion(c.MaxVersion); err != nil {
+		return nil, err
+	}
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return nil, errors.New("minimum TLS version is above the maximum")
+	}
+	for _, name := range c.CipherSuites {
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+	return config, nil
+}
+
+func (c TLSConfig) empty() bool {
+	return len(c.CA) == 0 && len(c.Cert) == 0 && len(c.Key) == 0 && c.ServerName == "" &&
+		!c.SessionResumption && c.MinVersion == "" && c.MaxVersion == "" && len(c.CipherSuites) == 0
+}
+
+func tlsVersion(name string) (uint16, error) {
+	if name == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, use 1.0, 1.1, 1.2 or 1.3", name)
+	}
+	return v, nil
+}
+
+func cipherSuite(name string) (uint16, bool) {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, s := range suites {
+			if s.Name == name {
+				return s.ID, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,96 @@
+package loadgen_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"throughputramp/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TLSConfig", func() {
+	It("does not verify the router without a CA bundle", func() {
+		config, err := loadgen.TLSConfig{}.ClientConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.InsecureSkipVerify).To(BeTrue())
+		Expect(config.ClientSessionCache).To(BeNil())
+	})
+
+	It("verifies the router with the CA bundle under the given server name", func() {
+		cert, _ := selfSignedCert()
+		config, err := loadgen.TLSConfig{CA: cert, ServerName: "router.example.com"}.ClientConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.InsecureSkipVerify).To(BeFalse())
+		Expect(config.RootCAs).NotTo(BeNil())
+		Expect(config.ServerName).To(Equal("router.example.com"))
+	})
+
+	It("presents the client certificate", func() {
+		cert, key := selfSignedCert()
+		config, err := loadgen.TLSConfig{Cert: cert, Key: key}.ClientConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Certificates).To(HaveLen(1))
+	})
+
+	It("pins versions and cipher suites and shares a session cache when resuming", func() {
+		config, err := loadgen.TLSConfig{
+			MinVersion:        "1.2",
+			MaxVersion:        "1.2",
+			CipherSuites:      []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			SessionResumption: true,
+		}.ClientConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+		Expect(config.MaxVersion).To(Equal(uint16(tls.VersionTLS12)))
+		Expect(config.CipherSuites).To(Equal([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}))
+		Expect(config.ClientSessionCache).NotTo(BeNil())
+	})
+
+	It("rejects invalid settings", func() {
+		cert, _ := selfSignedCert()
+		for _, c := range []struct {
+			config loadgen.TLSConfig
+			err    string
+		}{
+			{loadgen.TLSConfig{CA: []byte("not a certificate")}, "CA bundle contains no certificates"},
+			{loadgen.TLSConfig{Cert: cert}, "client certificate and key must be set together"},
+			{loadgen.TLSConfig{MinVersion: "1.4"}, `unknown TLS version "1.4", use 1.0, 1.1, 1.2 or 1.3`},
+			{loadgen.TLSConfig{MinVersion: "1.3", MaxVersion: "1.2"}, "minimum TLS version is above the maximum"},
+			{loadgen.TLSConfig{CipherSuites: []string{"RC5"}}, `unknown cipher suite "RC5"`},
+		} {
+			_, err := c.config.ClientConfig()
+			Expect(err).To(MatchError(c.err))
+		}
+	})
+})
+
+// selfSignedCert returns a PEM encoded certificate for 127.0.0.1 and its key.
+func selfSignedCert() ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "throughputramp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
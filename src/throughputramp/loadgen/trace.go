@@ -0,0 +1,79 @@
+package loadgen
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// phaseTrace records when each phase of a request starts and ends. The
+// transport may call the hooks from other goroutines, e.g. when a dial
+// finishes after the request was served by another connection.
+type phaseTrace struct {
+	mu           sync.Mutex
+	getConn      time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	reused       bool
+	tlsStart     time.Time
+	tlsDone      time.Time
+	tlsResumed   bool
+}
+
+func (t *phaseTrace) clientTrace() *httptrace.ClientTrace {
+	record := func(at *time.Time) {
+		t.mu.Lock()
+		*at = time.Now()
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		GetConn:  func(string) { record(&t.getConn) },
+		DNSStart: func(httptrace.DNSStartInfo) { record(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { record(&t.dnsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = time.Now()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() { record(&t.tlsStart) },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				return
+			}
+			t.mu.Lock()
+			t.tlsDone = time.Now()
+			t.tlsResumed = state.DidResume
+			t.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { record(&t.wroteRequest) },
+		GotFirstResponseByte: func() { record(&t.firstByte) },
+	}
+}
+
+// apply copies the phase durations into the sample. Phases that did not
+// complete are left at zero.
+func (t *phaseTrace) apply(s *Sample, end time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s.ConnReused = t.reused
+	s.DNS = between(t.dnsStart, t.dnsDone)
+	s.Connect = between(t.getConn, t.gotConn)
+	s.RequestWrite = between(t.gotConn, t.wroteRequest)
+	s.ResponseDelay = between(t.wroteRequest, t.firstByte)
+	s.ResponseRead = between(t.firstByte, end)
+	s.TLSHandshake = between(t.tlsStart, t.tlsDone)
+	s.TLSResumed = t.tlsResumed
+}
+
+func between(from, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return to.Sub(from)
+}
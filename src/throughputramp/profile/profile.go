@@ -0,0 +1,182 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"throughputramp/loadgen"
+)
+
+const (
+	StageStep     = "step"
+	StageLinear   = "linear"
+	StageSpike    = "spike"
+	StageHold     = "hold"
+	StageRampDown = "ramp-down"
+
+	UnitConcurrency = "concurrency"
+	UnitRate        = "rate"
+
+	DefaultWorkers = 100
+)
+
+// Profile is a sequence of stages that together describe the traffic shape of
+// a throughputramp run. Profiles are written in YAML; JSON documents are
+// accepted as well.
+type Profile struct {
+	Stages []Stage `yaml:"stages"`
+}
+
+// Stage describes one part of a profile. Depending on Unit the levels are
+// either numbers of concurrent workers or open-loop requests per second.
+//
+//	step:      From to To in increments of By, one step per level
+//	ramp-down: From down to To in decrements of By
+//	linear:    From to To spread evenly over Steps steps
+//	spike:     From, then To, then From again
+//	hold:      a single step at Level
+//
+// Every step is bounded by Requests, Duration or both. For linear stages
+// Duration is the length of the whole stage and is split across its steps.
+// Warmup is run before every step of the stage and excluded from its results.
+type Stage struct {
+	Type      string   `yaml:"type"`
+	Unit      string   `yaml:"unit"`
+	Level     int      `yaml:"level"`
+	From      int      `yaml:"from"`
+	To        int      `yaml:"to"`
+	By        int      `yaml:"by"`
+	Steps     int      `yaml:"steps"`
+	Requests  int      `yaml:"requests"`
+	Duration  Duration `yaml:"duration"`
+	Warmup    Duration `yaml:"warmup"`
+	RateLimit int      `yaml:"rate_limit"`
+	Workers   int      `yaml:"workers"`
+}
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func Load(path string) (*Profile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile: %s", err)
+	}
+	return Parse(contents)
+}
+
+func Parse(contents []byte) (*Profile, error) {
+	var p Profile
+	if err := yaml.UnmarshalStrict(contents, &p); err != nil {
+		return nil, fmt.Errorf("parsing profile: %s", err)
+	}
+	if len(p.Stages) == 0 {
+		return nil, errors.New("profile has no stages")
+	}
+	return &p, nil
+}
+
+// Steps expands all stages of the profile into the steps to run, in order.
+func (p *Profile) Steps() ([]loadgen.Step, error) {
+	var steps []loadgen.Step
+	for i, stage := range p.Stages {
+		stageSteps, err := stage.steps()
+		if err != nil {
+			return nil, fmt.Errorf("stage %d (%s): %s", i+1, stage.Type, err)
+		}
+		steps = append(steps, stageSteps...)
+	}
+	return steps, nil
+}
+
+func (s Stage) steps() ([]loadgen.Step, error) {
+	if s.Unit != "" && s.Unit != UnitConcurrency && s.Unit != UnitRate {
+		return nil, fmt.Errorf("unknown unit %q", s.Unit)
+	}
+	if s.Requests < 0 || s.Duration < 0 || s.Warmup < 0 {
+		return nil, errors.New("requests, duration and warmup must not be negative")
+	}
+	if s.Requests == 0 && s.Duration == 0 {
+		return nil, errors.New("requests or duration is required")
+	}
+
+	var levels []int
+	duration := time.Duration(s.Duration)
+	switch s.Type {
+	case StageStep:
+		if s.By < 1 || s.From > s.To {
+			return nil, errors.New("step needs from <= to and by >= 1")
+		}
+		for l := s.From; l <= s.To; l += s.By {
+			levels = append(levels, l)
+		}
+	case StageRampDown:
+		if s.By < 1 || s.From < s.To {
+			return nil, errors.New("ramp-down needs from >= to and by >= 1")
+		}
+		for l := s.From; l >= s.To; l -= s.By {
+			levels = append(levels, l)
+		}
+	case StageLinear:
+		if s.Steps < 2 {
+			return nil, errors.New("linear needs at least 2 steps")
+		}
+		for i := 0; i < s.Steps; i++ {
+			levels = append(levels, s.From+(s.To-s.From)*i/(s.Steps-1))
+		}
+		duration /= time.Duration(s.Steps)
+	case StageSpike:
+		levels = []int{s.From, s.To, s.From}
+	case StageHold:
+		levels = []int{s.Level}
+	default:
+		return nil, fmt.Errorf("unknown stage type %q", s.Type)
+	}
+
+	steps := make([]loadgen.Step, 0, len(levels))
+	for _, l := range levels {
+		if l < 1 {
+			return nil, fmt.Errorf("%s must be at least 1, got %d", s.unit(), l)
+		}
+		step := loadgen.Step{
+			NumRequests: s.Requests,
+			Duration:    duration,
+			Warmup:      time.Duration(s.Warmup),
+		}
+		if s.unit() == UnitRate {
+			step.Rate = l
+			step.Concurrency = s.Workers
+			if step.Concurrency == 0 {
+				step.Concurrency = DefaultWorkers
+			}
+		} else {
+			step.Concurrency = l
+			step.RateLimit = s.RateLimit
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func (s Stage) unit() string {
+	if s.Unit == "" {
+		return UnitConcurrency
+	}
+	return s.Unit
+}
@@ -0,0 +1,136 @@
+package profile_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"throughputramp/loadgen"
+	"throughputramp/profile"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profile", func() {
+	steps := func(contents string) ([]loadgen.Step, error) {
+		p, err := profile.Parse([]byte(contents))
+		Expect(err).ToNot(HaveOccurred())
+		return p.Steps()
+	}
+
+	It("expands step stages", func() {
+		s, err := steps(`
+stages:
+- type: step
+  from: 1
+  to: 5
+  by: 2
+  requests: 100
+  rate_limit: 10
+`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal([]loadgen.Step{
+			{NumRequests: 100, Concurrency: 1, RateLimit: 10},
+			{NumRequests: 100, Concurrency: 3, RateLimit: 10},
+			{NumRequests: 100, Concurrency: 5, RateLimit: 10},
+		}))
+	})
+
+	It("expands ramp-down stages", func() {
+		s, err := steps(`{"stages": [{"type": "ramp-down", "from": 30, "to": 10, "by": 10, "requests": 100}]}`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal([]loadgen.Step{
+			{NumRequests: 100, Concurrency: 30},
+			{NumRequests: 100, Concurrency: 20},
+			{NumRequests: 100, Concurrency: 10},
+		}))
+	})
+
+	It("splits the duration of linear stages across their steps", func() {
+		s, err := steps(`
+stages:
+- type: linear
+  unit: rate
+  from: 100
+  to: 400
+  steps: 4
+  duration: 2m
+  workers: 50
+`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal([]loadgen.Step{
+			{Rate: 100, Concurrency: 50, Duration: 30 * time.Second},
+			{Rate: 200, Concurrency: 50, Duration: 30 * time.Second},
+			{Rate: 300, Concurrency: 50, Duration: 30 * time.Second},
+			{Rate: 400, Concurrency: 50, Duration: 30 * time.Second},
+		}))
+	})
+
+	It("expands spike and hold stages", func() {
+		s, err := steps(`
+stages:
+- type: spike
+  unit: rate
+  from: 10
+  to: 1000
+  duration: 10s
+- type: hold
+  level: 20
+  duration: 1h
+  warmup: 1m
+`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal([]loadgen.Step{
+			{Rate: 10, Concurrency: profile.DefaultWorkers, Duration: 10 * time.Second},
+			{Rate: 1000, Concurrency: profile.DefaultWorkers, Duration: 10 * time.Second},
+			{Rate: 10, Concurrency: profile.DefaultWorkers, Duration: 10 * time.Second},
+			{Concurrency: 20, Duration: time.Hour, Warmup: time.Minute},
+		}))
+	})
+
+	It("loads profiles from a file", func() {
+		dir, err := ioutil.TempDir("", "profile")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "profile.yml")
+		Expect(ioutil.WriteFile(path, []byte("stages: [{type: hold, level: 1, requests: 5}]"), 0644)).To(Succeed())
+
+		p, err := profile.Load(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Stages).To(HaveLen(1))
+	})
+
+	Describe("errors", func() {
+		It("rejects profiles without stages", func() {
+			_, err := profile.Parse([]byte("stages: []"))
+			Expect(err).To(MatchError("profile has no stages"))
+		})
+
+		It("rejects unknown fields", func() {
+			_, err := profile.Parse([]byte("stages: [{type: hold, lvl: 1}]"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects invalid durations", func() {
+			_, err := profile.Parse([]byte("stages: [{type: hold, level: 1, duration: soon}]"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects unknown stage types", func() {
+			_, err := steps("stages: [{type: sawtooth, requests: 1}]")
+			Expect(err).To(MatchError(`stage 1 (sawtooth): unknown stage type "sawtooth"`))
+		})
+
+		It("rejects stages that are not bounded", func() {
+			_, err := steps("stages: [{type: hold, level: 1}]")
+			Expect(err).To(MatchError("stage 1 (hold): requests or duration is required"))
+		})
+
+		It("rejects levels below 1", func() {
+			_, err := steps("stages: [{type: spike, from: 0, to: 10, requests: 10}]")
+			Expect(err).To(MatchError("stage 1 (spike): concurrency must be at least 1, got 0"))
+		})
+	})
+})
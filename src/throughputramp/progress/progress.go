@@ -0,0 +1,279 @@
+// Package progress tracks a running ramp so that operators can watch it: the
+// current step, the elapsed time, the requests and errors so far and the
+// throughput and latency percentiles over the last seconds. The status is
+// served as JSON and in the Prometheus text format and can be printed
+// periodically.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"throughputramp/analysis"
+	"throughputramp/histogram"
+	"throughputramp/loadgen"
+)
+
+// Window is the time the rolling throughput and latency cover.
+const Window = 10 * time.Second
+
+const windowSeconds = int(Window / time.Second)
+
+// Status is a snapshot of a run. Requests, Errors and NonSuccess count all
+// steps so far, StepRequests and StepErrors the running step. RPS and the
+// latencies, in milliseconds, cover the requests completed within the last
+// Window. LastStep summarizes the last step that completed.
+//
+// Live is false when the generators only report a step once it completes.
+// The counts of the running step, RPS and the latencies are then unavailable
+// and left out of the JSON, the metrics and String.
+type Status struct {
+	Running      bool                  `json:"running"`
+	Live         bool                  `json:"live"`
+	Target       string                `json:"target,omitempty"`
+	Step         int                   `json:"step"`
+	Steps        int                   `json:"steps"`
+	Concurrency  int                   `json:"concurrency"`
+	Rate         int                   `json:"rate"`
+	Elapsed      float64               `json:"elapsed_seconds"`
+	StepElapsed  float64               `json:"step_elapsed_seconds"`
+	Requests     int                   `json:"requests"`
+	Errors       int                   `json:"errors"`
+	NonSuccess   int                   `json:"non_2xx"`
+	StepRequests int                   `json:"step_requests"`
+	StepErrors   int                   `json:"step_errors"`
+	RPS          float64               `json:"rps"`
+	P50          float64               `json:"p50_ms"`
+	P90          float64               `json:"p90_ms"`
+	P99          float64               `json:"p99_ms"`
+	Max          float64               `json:"max_ms"`
+	LastStep     *analysis.StepSummary `json:"last_step,omitempty"`
+}
+
+func (s Status) String() string {
+	target := ""
+	if s.Target != "" {
+		target = s.Target + ": "
+	}
+	rolling := ""
+	if s.Live {
+		rolling = fmt.Sprintf("%.1f requests per second, p50 %.3fms, p99 %.3fms, ", s.RPS, s.P50, s.P99)
+	}
+	return fmt.Sprintf("%sstep %d/%d, %s elapsed, %s%d requests, %d errors, %d non-2xx",
+		target,
+		s.Step,
+		s.Steps,
+		time.Duration(s.Elapsed*float64(time.Second)).Round(time.Second),
+		rolling,
+		s.Requests,
+		s.Errors,
+		s.NonSuccess,
+	)
+}
+
+// MarshalJSON leaves the fields that are unavailable without Live out.
+func (s Status) MarshalJSON() ([]byte, error) {
+	type status Status
+	if s.Live {
+		return json.Marshal(status(s))
+	}
+	// The nil fields hide the ones of status with the same names.
+	return json.Marshal(struct {
+		status
+		StepRequests *int     `json:"step_requests,omitempty"`
+		StepErrors   *int     `json:"step_errors,omitempty"`
+		RPS          *float64 `json:"rps,omitempty"`
+		P50          *float64 `json:"p50_ms,omitempty"`
+		P90          *float64 `json:"p90_ms,omitempty"`
+		P99          *float64 `json:"p99_ms,omitempty"`
+		Max          *float64 `json:"max_ms,omitempty"`
+	}{status: status(s)})
+}
+
+type counts struct {
+	requests   int
+	errors     int
+	nonSuccess int
+}
+
+func (c *counts) record(s loadgen.Sample) {
+	c.requests++
+	if s.Err != nil {
+		c.errors++
+	}
+	if (s.StatusCode < 200 || s.StatusCode > 299) && s.StatusCode != http.StatusSwitchingProtocols {
+		c.nonSuccess++
+	}
+}
+
+// second holds the requests completed within one second.
+type second struct {
+	unix    int64
+	counts  counts
+	latency *histogram.Histogram
+}
+
+// Tracker follows a run. Samples are only recorded while they are sent by
+// generators that report them as they go; the others only update the totals
+// when a step completes. It is safe for concurrent use.
+type Tracker struct {
+	mu sync.Mutex
+
+	running   bool
+	live      bool
+	start     time.Time
+	steps     int
+	target    string
+	step      int
+	config    loadgen.Step
+	stepStart time.Time
+
+	total    counts
+	current  counts
+	window   [windowSeconds]second
+	lastStep *analysis.StepSummary
+}
+
+func NewTracker() *Tracker {
+	t := &Tracker{}
+	for i := range t.window {
+		t.window[i].latency = newHistogram()
+	}
+	return t
+}
+
+func newHistogram() *histogram.Histogram {
+	h, err := histogram.New(1, int64(loadgen.MaxLatency/time.Microsecond), 3)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// Start marks the beginning of a run of the given number of steps. live
+// reports whether the generators pass their samples to Record as they go.
+func (t *Tracker) Start(steps int, live bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running = true
+	t.live = live
+	t.start = time.Now()
+	t.steps = steps
+}
+
+// StartStep marks the beginning of step n of the named target.
+func (t *Tracker) StartStep(target string, n int, step loadgen.Step) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.target = target
+	t.step = n
+	t.config = step
+	t.stepStart = time.Now()
+	t.current = counts{}
+}
+
+// Record counts a sample of the running step. It is meant to be passed as
+// loadgen.HTTPGenerator.Observe.
+func (t *Tracker) Record(s loadgen.Sample) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current.record(s)
+
+	end := s.Start.Add(s.ResponseTime).Unix()
+	bucket := &t.window[int(end%int64(windowSeconds))]
+	if bucket.unix != end {
+		bucket.unix = end
+		bucket.counts = counts{}
+		bucket.latency.Reset()
+	}
+	bucket.counts.record(s)
+	if s.Err == nil {
+		latency := s.ResponseTime
+		if latency > loadgen.MaxLatency {
+			latency = loadgen.MaxLatency
+		}
+		bucket.latency.Record(int64(latency / time.Microsecond))
+	}
+}
+
+// EndStep adds the result of the running step to the totals.
+func (t *Tracker) EndStep(summary analysis.StepSummary) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total.requests += summary.Requests
+	t.total.errors += summary.Errors
+	t.total.nonSuccess += summary.NonSuccess
+	t.current = counts{}
+	t.lastStep = &summary
+}
+
+// Finish marks the end of the run.
+func (t *Tracker) Finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running = false
+}
+
+// Status returns a snapshot of the run.
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	status := Status{
+		Running:      t.running,
+		Live:         t.live,
+		Target:       t.target,
+		Step:         t.step,
+		Steps:        t.steps,
+		Concurrency:  t.config.Concurrency,
+		Rate:         t.config.Rate,
+		Requests:     t.total.requests + t.current.requests,
+		Errors:       t.total.errors + t.current.errors,
+		NonSuccess:   t.total.nonSuccess + t.current.nonSuccess,
+		StepRequests: t.current.requests,
+		StepErrors:   t.current.errors,
+		LastStep:     t.lastStep,
+	}
+	if t.start.IsZero() {
+		return status
+	}
+	status.Elapsed = now.Sub(t.start).Seconds()
+	if !t.stepStart.IsZero() {
+		status.StepElapsed = now.Sub(t.stepStart).Seconds()
+	}
+	if !t.live {
+		return status
+	}
+
+	// The window ends now and starts at the beginning of its oldest second,
+	// or at the start of the run if that is later.
+	oldest := now.Unix() - int64(windowSeconds) + 1
+	windowStart := time.Unix(oldest, 0)
+	if windowStart.Before(t.start) {
+		windowStart = t.start
+	}
+	latency := newHistogram()
+	requests := 0
+	for _, bucket := range t.window {
+		if bucket.unix < oldest || bucket.unix > now.Unix() {
+			continue
+		}
+		requests += bucket.counts.requests
+		latency.Merge(bucket.latency)
+	}
+	if span := now.Sub(windowStart).Seconds(); span > 0 {
+		status.RPS = float64(requests) / span
+	}
+	status.P50 = milliseconds(latency.ValueAtPercentile(50))
+	status.P90 = milliseconds(latency.ValueAtPercentile(90))
+	status.P99 = milliseconds(latency.ValueAtPercentile(99))
+	status.Max = milliseconds(latency.Max())
+	return status
+}
+
+func milliseconds(us int64) float64 {
+	return float64(us) / 1000
+}
@@ -0,0 +1,130 @@
+package progress_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"throughputramp/analysis"
+	"throughputramp/loadgen"
+	"throughputramp/progress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tracker", func() {
+	var tracker *progress.Tracker
+
+	BeforeEach(func() {
+		tracker = progress.NewTracker()
+	})
+
+	It("is idle before the run starts", func() {
+		status := tracker.Status()
+		Expect(status.Running).To(BeFalse())
+		Expect(status.Step).To(BeZero())
+		Expect(status.RPS).To(BeZero())
+	})
+
+	It("follows the running step", func() {
+		tracker.Start(5, true)
+		tracker.StartStep("router", 2, loadgen.Step{Concurrency: 10, Rate: 100})
+		now := time.Now()
+		for i := 0; i < 20; i++ {
+			tracker.Record(loadgen.Sample{Start: now.Add(-2 * time.Millisecond), ResponseTime: 2 * time.Millisecond, StatusCode: 200})
+		}
+		tracker.Record(loadgen.Sample{Start: now.Add(-8 * time.Millisecond), ResponseTime: 8 * time.Millisecond, StatusCode: 200})
+		tracker.Record(loadgen.Sample{Start: now, ResponseTime: time.Second, Err: errors.New("timeout")})
+
+		status := tracker.Status()
+		Expect(status.Running).To(BeTrue())
+		Expect(status.Target).To(Equal("router"))
+		Expect(status.Step).To(Equal(2))
+		Expect(status.Steps).To(Equal(5))
+		Expect(status.Concurrency).To(Equal(10))
+		Expect(status.Rate).To(Equal(100))
+		Expect(status.Elapsed).To(BeNumerically(">", 0))
+		Expect(status.Requests).To(Equal(22))
+		Expect(status.Errors).To(Equal(1))
+		Expect(status.NonSuccess).To(Equal(1))
+		Expect(status.StepRequests).To(Equal(22))
+		Expect(status.StepErrors).To(Equal(1))
+		Expect(status.RPS).To(BeNumerically(">", 0))
+		Expect(status.P50).To(BeNumerically("~", 2, 0.01))
+		Expect(status.Max).To(BeNumerically("~", 8, 0.01))
+	})
+
+	It("adds completed steps to the totals", func() {
+		tracker.Start(2, true)
+		tracker.StartStep("", 1, loadgen.Step{Concurrency: 1})
+		tracker.Record(loadgen.Sample{Start: time.Now(), ResponseTime: time.Millisecond, StatusCode: 200})
+		tracker.EndStep(analysis.StepSummary{Step: 1, Requests: 100, Errors: 2, NonSuccess: 3})
+		tracker.StartStep("", 2, loadgen.Step{Concurrency: 2})
+		tracker.Record(loadgen.Sample{Start: time.Now(), ResponseTime: time.Millisecond, StatusCode: 500})
+
+		status := tracker.Status()
+		Expect(status.Requests).To(Equal(101))
+		Expect(status.Errors).To(Equal(2))
+		Expect(status.NonSuccess).To(Equal(4))
+		Expect(status.StepRequests).To(Equal(1))
+		Expect(status.LastStep.Step).To(Equal(1))
+
+		tracker.Finish()
+		Expect(tracker.Status().Running).To(BeFalse())
+	})
+
+	It("forgets requests that completed before the window", func() {
+		tracker.Start(1, true)
+		tracker.StartStep("", 1, loadgen.Step{Concurrency: 1})
+		old := time.Now().Add(-2 * progress.Window)
+		tracker.Record(loadgen.Sample{Start: old, ResponseTime: time.Second, StatusCode: 200})
+
+		status := tracker.Status()
+		Expect(status.StepRequests).To(Equal(1))
+		Expect(status.RPS).To(BeZero())
+		Expect(status.Max).To(BeZero())
+	})
+
+	It("prints a summary line", func() {
+		status := progress.Status{Live: true, Target: "router", Step: 3, Steps: 10, Elapsed: 90.4, RPS: 1234.56, P50: 1.2, P99: 8.3, Requests: 5000, Errors: 3, NonSuccess: 5}
+		Expect(status.String()).To(Equal("router: step 3/10, 1m30s elapsed, 1234.6 requests per second, p50 1.200ms, p99 8.300ms, 5000 requests, 3 errors, 5 non-2xx"))
+	})
+
+	Context("when the generators only report completed steps", func() {
+		BeforeEach(func() {
+			tracker.Start(2, false)
+			tracker.StartStep("", 1, loadgen.Step{Concurrency: 1})
+			tracker.EndStep(analysis.StepSummary{Step: 1, Requests: 100, Errors: 2, NonSuccess: 3})
+			tracker.StartStep("", 2, loadgen.Step{Concurrency: 2})
+		})
+
+		It("updates the totals when a step completes", func() {
+			status := tracker.Status()
+			Expect(status.Live).To(BeFalse())
+			Expect(status.Requests).To(Equal(100))
+			Expect(status.Step).To(Equal(2))
+		})
+
+		It("leaves the rolling fields out", func() {
+			status := tracker.Status()
+			Expect(status.String()).To(MatchRegexp(`^step 2/2, \d+s elapsed, 100 requests, 2 errors, 3 non-2xx$`))
+
+			statusJSON, err := json.Marshal(status)
+			Expect(err).NotTo(HaveOccurred())
+			var fields map[string]interface{}
+			Expect(json.Unmarshal(statusJSON, &fields)).To(Succeed())
+			Expect(fields).To(HaveKeyWithValue("live", false))
+			Expect(fields).To(HaveKeyWithValue("requests", 100.0))
+			for _, name := range []string{"step_requests", "step_errors", "rps", "p50_ms", "p90_ms", "p99_ms", "max_ms"} {
+				Expect(fields).NotTo(HaveKey(name))
+			}
+
+			metrics := &bytes.Buffer{}
+			progress.WriteMetrics(metrics, status)
+			Expect(metrics.String()).To(ContainSubstring("throughputramp_requests_total 100\n"))
+			Expect(metrics.String()).NotTo(ContainSubstring("rolling"))
+		})
+	})
+})
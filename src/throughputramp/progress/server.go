@@ -0,0 +1,69 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Handler serves the status of t as JSON on / and in the Prometheus text
+// format on /metrics.
+func Handler(t *Tracker) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(t.Status())
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteMetrics(w, t.Status())
+	})
+	return mux
+}
+
+// WriteMetrics writes s in the Prometheus text exposition format. The rolling
+// metrics are left out unless s is Live.
+func WriteMetrics(w io.Writer, s Status) {
+	running := 0
+	if s.Running {
+		running = 1
+	}
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+	}
+	metric("throughputramp_running", "gauge", "Whether the ramp is running.", float64(running))
+	metric("throughputramp_step", "gauge", "Number of the running step, starting at 1.", float64(s.Step))
+	metric("throughputramp_steps", "gauge", "Number of steps of the ramp.", float64(s.Steps))
+	metric("throughputramp_concurrency", "gauge", "Workers of the running step.", float64(s.Concurrency))
+	metric("throughputramp_rate", "gauge", "Requests per second of the running open-loop step, 0 for closed-loop steps.", float64(s.Rate))
+	metric("throughputramp_elapsed_seconds", "gauge", "Time since the ramp started.", s.Elapsed)
+	metric("throughputramp_step_elapsed_seconds", "gauge", "Time since the running step started, including its warm-up.", s.StepElapsed)
+	metric("throughputramp_requests_total", "counter", "Requests sent in all steps.", float64(s.Requests))
+	metric("throughputramp_errors_total", "counter", "Requests that failed in all steps.", float64(s.Errors))
+	metric("throughputramp_non_2xx_total", "counter", "Requests without a 2xx response in all steps, including the failed ones.", float64(s.NonSuccess))
+	if !s.Live {
+		return
+	}
+	metric("throughputramp_rolling_requests_per_second", "gauge", "Requests completed per second over the rolling window.", s.RPS)
+
+	name := "throughputramp_rolling_latency_seconds"
+	fmt.Fprintf(w, "# HELP %s Latency percentiles of the requests completed within the rolling window.\n# TYPE %s gauge\n", name, name)
+	for _, q := range []struct {
+		quantile string
+		ms       float64
+	}{
+		{"0.5", s.P50},
+		{"0.9", s.P90},
+		{"0.99", s.P99},
+		{"1", s.Max},
+	} {
+		fmt.Fprintf(w, "%s{quantile=%q} %g\n", name, q.quantile, q.ms/1000)
+	}
+}
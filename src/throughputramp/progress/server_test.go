@@ -0,0 +1,70 @@
+package progress_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"throughputramp/loadgen"
+	"throughputramp/progress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		tracker := progress.NewTracker()
+		tracker.Start(4, true)
+		tracker.StartStep("", 1, loadgen.Step{Concurrency: 8})
+		tracker.Record(loadgen.Sample{Start: time.Now(), ResponseTime: 5 * time.Millisecond, StatusCode: 200})
+		server = httptest.NewServer(progress.Handler(tracker))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := http.Get(server.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, string(body)
+	}
+
+	It("serves the status as JSON", func() {
+		resp, body := get("/")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+		var status progress.Status
+		Expect(json.Unmarshal([]byte(body), &status)).To(Succeed())
+		Expect(status.Running).To(BeTrue())
+		Expect(status.Steps).To(Equal(4))
+		Expect(status.Concurrency).To(Equal(8))
+		Expect(status.Requests).To(Equal(1))
+		Expect(status.Live).To(BeTrue())
+		Expect(status.P50).To(BeNumerically("~", 5, 0.01))
+	})
+
+	It("serves Prometheus metrics", func() {
+		resp, body := get("/metrics")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+		Expect(body).To(ContainSubstring("# TYPE throughputramp_requests_total counter\nthroughputramp_requests_total 1\n"))
+		Expect(body).To(ContainSubstring("throughputramp_running 1\n"))
+		Expect(body).To(ContainSubstring("throughputramp_step 1\n"))
+		Expect(body).To(ContainSubstring("throughputramp_concurrency 8\n"))
+		Expect(body).To(ContainSubstring(`throughputramp_rolling_latency_seconds{quantile="0.99"} 0.005`))
+	})
+
+	It("serves nothing else", func() {
+		resp, _ := get("/other")
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+})
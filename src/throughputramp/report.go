@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"throughputramp/report"
+	"throughputramp/uploader"
+)
+
+// runReport implements the report subcommand, which regenerates the HTML
+// report of a stored run. It returns 0 on success and 2 on errors.
+func runReport(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	output := flags.String("o", "report.html", "File to write the report to")
+	s3Endpoint := flags.String("s3-endpoint", "", "The endpoint for the S3 service to download s3:// results from.")
+	s3Region := flags.String("s3-region", "", "The region for the S3 service to download s3:// results from. If provided, endpoint is ignored.")
+	accessKeyID := flags.String("access-key-id", "", "AccessKeyID for the S3 service.")
+	secretAccessKey := flags.String("secret-access-key", "", "SecretAccessKey for the S3 service.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: throughputramp report [flags] <results>\n\n"+
+			"Results are read from a local directory or from s3://<bucket>/<timestamp>.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	read, err := resultReader(flags.Arg(0), uploader.Config{
+		Endpoint:        *s3Endpoint,
+		AwsRegion:       *s3Region,
+		AccessKeyID:     *accessKeyID,
+		SecretAccessKey: *secretAccessKey,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+
+	var input report.Input
+	input.Summary, err = read("summary.json")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+	// Runs before run.json and throughput.csv were written, and runs
+	// without a cpumonitor, still get the remaining charts.
+	optional := []struct {
+		name     string
+		contents *[]byte
+	}{
+		{"run.json", &input.Run},
+		{"throughput.csv", &input.Throughput},
+		{"cpuStats.csv", &input.CPU},
+	}
+	for _, file := range optional {
+		if *file.contents, err = read(file.name); err != nil {
+			fmt.Fprintf(os.Stderr, "Leaving out %s: %s\n", file.name, err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := report.Generate(buf, input); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+	fmt.Fprintf(os.Stdout, "report written to %s\n", *output)
+	return 0
+}
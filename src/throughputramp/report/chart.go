@@ -0,0 +1,159 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+)
+
+const (
+	chartWidth   = 800
+	chartHeight  = 320
+	marginLeft   = 70
+	marginRight  = 20
+	marginTop    = 20
+	marginBottom = 50
+	tickCount    = 6
+)
+
+var palette = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b"}
+
+type point struct {
+	x, y float64
+}
+
+// series is drawn as a line, or as unconnected markers when scatter is set.
+type series struct {
+	name    string
+	points  []point
+	scatter bool
+}
+
+// rule is a labelled horizontal or vertical line across the plot area.
+type rule struct {
+	at    float64
+	label string
+}
+
+type chart struct {
+	xLabel, yLabel string
+	series         []series
+	xRules         []rule
+	yRules         []rule
+}
+
+// svg renders the chart as an inline SVG element. The y axis starts at zero
+// and the x axis spans the data.
+func (c chart) svg() template.HTML {
+	xMin, xMax := math.Inf(1), math.Inf(-1)
+	yMax := 0.0
+	for _, s := range c.series {
+		for _, p := range s.points {
+			if math.IsNaN(p.y) {
+				continue
+			}
+			xMin = math.Min(xMin, p.x)
+			xMax = math.Max(xMax, p.x)
+			yMax = math.Max(yMax, p.y)
+		}
+	}
+	for _, r := range c.yRules {
+		yMax = math.Max(yMax, r.at)
+	}
+	if math.IsInf(xMin, 0) {
+		xMin, xMax = 0, 1
+	}
+	if xMax == xMin {
+		xMin, xMax = xMin-1, xMax+1
+	}
+	if yMax == 0 {
+		yMax = 1
+	}
+	xTicks := ticks(xMin, xMax)
+	yTicks := ticks(0, yMax*1.05)
+	yMax = yTicks[len(yTicks)-1]
+
+	plotWidth := float64(chartWidth - marginLeft - marginRight)
+	plotHeight := float64(chartHeight - marginTop - marginBottom)
+	px := func(x float64) float64 { return marginLeft + (x-xMin)/(xMax-xMin)*plotWidth }
+	py := func(y float64) float64 { return marginTop + plotHeight - y/yMax*plotHeight }
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(buf, `<rect x="%d" y="%d" width="%g" height="%g" fill="none" stroke="#999"/>`, marginLeft, marginTop, plotWidth, plotHeight)
+
+	for _, t := range xTicks {
+		if t < xMin || t > xMax {
+			continue
+		}
+		fmt.Fprintf(buf, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#eee"/>`, px(t), marginTop, px(t), marginTop+plotHeight)
+		fmt.Fprintf(buf, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, px(t), marginTop+plotHeight+15, formatTick(t))
+	}
+	for _, t := range yTicks {
+		fmt.Fprintf(buf, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#eee"/>`, marginLeft, py(t), marginLeft+plotWidth, py(t))
+		fmt.Fprintf(buf, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, marginLeft-5, py(t)+4, formatTick(t))
+	}
+	fmt.Fprintf(buf, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, marginLeft+plotWidth/2, chartHeight-10, template.HTMLEscapeString(c.xLabel))
+	fmt.Fprintf(buf, `<text transform="translate(15 %.1f) rotate(-90)" text-anchor="middle">%s</text>`, marginTop+plotHeight/2, template.HTMLEscapeString(c.yLabel))
+
+	for _, r := range c.xRules {
+		if r.at < xMin || r.at > xMax {
+			continue
+		}
+		fmt.Fprintf(buf, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#bbb" stroke-dasharray="4 3"/>`, px(r.at), marginTop, px(r.at), marginTop+plotHeight)
+		fmt.Fprintf(buf, `<text x="%.1f" y="%d" fill="#777">%s</text>`, px(r.at)+3, marginTop+12, template.HTMLEscapeString(r.label))
+	}
+	for _, r := range c.yRules {
+		fmt.Fprintf(buf, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#d62728" stroke-dasharray="6 3"/>`, marginLeft, py(r.at), marginLeft+plotWidth, py(r.at))
+		fmt.Fprintf(buf, `<text x="%d" y="%.1f" fill="#d62728">%s</text>`, marginLeft+5, py(r.at)-4, template.HTMLEscapeString(r.label))
+	}
+
+	for i, s := range c.series {
+		color := palette[i%len(palette)]
+		if s.scatter {
+			for _, p := range s.points {
+				if !math.IsNaN(p.y) {
+					fmt.Fprintf(buf, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`, px(p.x), py(p.y), color)
+				}
+			}
+		} else {
+			fmt.Fprintf(buf, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="`, color)
+			for _, p := range s.points {
+				if !math.IsNaN(p.y) {
+					fmt.Fprintf(buf, "%.1f,%.1f ", px(p.x), py(p.y))
+				}
+			}
+			buf.WriteString(`"/>`)
+		}
+		legendY := marginTop + 15 + 15*i
+		fmt.Fprintf(buf, `<rect x="%.1f" y="%d" width="10" height="10" fill="%s"/>`, marginLeft+plotWidth-150, legendY-9, color)
+		fmt.Fprintf(buf, `<text x="%.1f" y="%d">%s</text>`, marginLeft+plotWidth-135, legendY, template.HTMLEscapeString(s.name))
+	}
+
+	buf.WriteString(`</svg>`)
+	return template.HTML(buf.String())
+}
+
+// ticks returns evenly spaced round values from at most min to at least
+// max.
+func ticks(min, max float64) []float64 {
+	step := math.Pow(10, math.Floor(math.Log10((max-min)/tickCount)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if (max-min)/(step*m) <= tickCount {
+			step *= m
+			break
+		}
+	}
+	var t []float64
+	for i := math.Floor(min / step); i <= math.Ceil(max/step); i++ {
+		t = append(t, i*step)
+	}
+	return t
+}
+
+func formatTick(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
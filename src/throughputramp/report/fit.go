@@ -0,0 +1,101 @@
+package report
+
+import (
+	"errors"
+	"math"
+)
+
+// Fit models the latency of a router as a function of its throughput with
+// the generalized linear model the Performance_Data notebook used: an
+// inverse Gaussian family with an inverse squared link, so that
+//
+//	latency = 1 / sqrt(Intercept + Slope*throughput)
+//
+// The model suits latency curves that grow steeply as throughput approaches
+// the router's capacity.
+type Fit struct {
+	Intercept float64
+	Slope     float64
+}
+
+const (
+	fitIterations = 100
+	fitTolerance  = 1e-10
+)
+
+// FitLatency fits the model to the given points by iteratively reweighted
+// least squares. Points with a non-positive latency are ignored.
+func FitLatency(throughput, latency []float64) (Fit, error) {
+	var x, y []float64
+	for i := range throughput {
+		if i < len(latency) && latency[i] > 0 {
+			x = append(x, throughput[i])
+			y = append(y, latency[i])
+		}
+	}
+	if len(x) < 2 {
+		return Fit{}, errors.New("fit needs at least two points")
+	}
+
+	// Start from the linear model of the transformed latencies.
+	eta := make([]float64, len(y))
+	for i := range y {
+		eta[i] = 1 / (y[i] * y[i])
+	}
+	var fit Fit
+	z := make([]float64, len(y))
+	w := make([]float64, len(y))
+	for iteration := 0; iteration < fitIterations; iteration++ {
+		for i := range y {
+			if eta[i] <= 0 {
+				return Fit{}, errors.New("fit did not converge")
+			}
+			mu := 1 / math.Sqrt(eta[i])
+			// Working response and weights of the canonical link, where
+			// dη/dμ = -2/μ³ and the variance function is μ³.
+			z[i] = eta[i] - 2*(y[i]-mu)/(mu*mu*mu)
+			w[i] = mu * mu * mu
+		}
+		next, err := weightedLeastSquares(x, z, w)
+		if err != nil {
+			return Fit{}, err
+		}
+		converged := math.Abs(next.Intercept-fit.Intercept) <= fitTolerance*math.Abs(next.Intercept) &&
+			math.Abs(next.Slope-fit.Slope) <= fitTolerance*math.Abs(next.Slope)
+		fit = next
+		if converged {
+			return fit, nil
+		}
+		for i := range x {
+			eta[i] = fit.Intercept + fit.Slope*x[i]
+		}
+	}
+	return fit, nil
+}
+
+// Latency returns the latency the model predicts for throughput, or NaN
+// beyond the throughput the model can sustain.
+func (f Fit) Latency(throughput float64) float64 {
+	eta := f.Intercept + f.Slope*throughput
+	if eta <= 0 {
+		return math.NaN()
+	}
+	return 1 / math.Sqrt(eta)
+}
+
+func weightedLeastSquares(x, y, w []float64) (Fit, error) {
+	var sw, swx, swy, swxx, swxy float64
+	for i := range x {
+		sw += w[i]
+		swx += w[i] * x[i]
+		swy += w[i] * y[i]
+		swxx += w[i] * x[i] * x[i]
+		swxy += w[i] * x[i] * y[i]
+	}
+	det := sw*swxx - swx*swx
+	if !(det > 1e-12*sw*swxx) {
+		return Fit{}, errors.New("fit needs points with at least two distinct throughputs")
+	}
+	slope := (sw*swxy - swx*swy) / det
+	return Fit{Intercept: (swy - slope*swx) / sw, Slope: slope}, nil
+}
@@ -0,0 +1,56 @@
+package report_test
+
+import (
+	"math"
+
+	"throughputramp/report"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FitLatency", func() {
+	It("recovers the model from latencies that follow it", func() {
+		model := report.Fit{Intercept: 1, Slope: -1.0 / 5000}
+		var throughput, latency []float64
+		for t := 500.0; t < 5000; t += 500 {
+			throughput = append(throughput, t)
+			latency = append(latency, model.Latency(t))
+		}
+
+		fit, err := report.FitLatency(throughput, latency)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fit.Intercept).To(BeNumerically("~", model.Intercept, 1e-9))
+		Expect(fit.Slope).To(BeNumerically("~", model.Slope, 1e-12))
+	})
+
+	It("fits noisy latencies", func() {
+		throughput := []float64{100, 200, 300, 400, 500, 600}
+		latency := []float64{1.1, 1.05, 1.2, 1.3, 1.6, 2.4}
+
+		fit, err := report.FitLatency(throughput, latency)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fit.Slope).To(BeNumerically("<", 0))
+		for i := range throughput {
+			Expect(fit.Latency(throughput[i])).To(BeNumerically("~", latency[i], 0.3))
+		}
+	})
+
+	It("predicts no latency beyond the sustainable throughput", func() {
+		fit := report.Fit{Intercept: 1, Slope: -0.01}
+		Expect(fit.Latency(0)).To(Equal(1.0))
+		Expect(math.IsNaN(fit.Latency(100))).To(BeTrue())
+	})
+
+	It("needs two distinct throughputs", func() {
+		_, err := report.FitLatency([]float64{100}, []float64{1})
+		Expect(err).To(MatchError("fit needs at least two points"))
+		_, err = report.FitLatency([]float64{100, 100}, []float64{1, 2})
+		Expect(err).To(MatchError("fit needs points with at least two distinct throughputs"))
+	})
+
+	It("ignores points without latency", func() {
+		_, err := report.FitLatency([]float64{100, 200}, []float64{1, 0})
+		Expect(err).To(HaveOccurred())
+	})
+})
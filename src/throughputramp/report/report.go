@@ -0,0 +1,210 @@
+// Package report renders the results of a throughputramp run as a single
+// self-contained HTML page with inline SVG charts.
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"time"
+
+	"throughputramp/analysis"
+	"throughputramp/data"
+)
+
+// Input holds the output files of a run the report is generated from. Only
+// Summary is required; the charts of missing files are left out.
+type Input struct {
+	Summary    []byte // summary.json
+	Run        []byte // run.json
+	Throughput []byte // throughput.csv
+	CPU        []byte // cpuStats.csv
+}
+
+type page struct {
+	Run        *data.RunMetadata
+	Summary    analysis.Summary
+	SLOLatency float64
+	Throughput template.HTML
+	Latency    template.HTML
+	CPU        template.HTML
+	Headroom   template.HTML
+	FitError   string
+}
+
+// Generate writes the HTML report of in to w.
+func Generate(w io.Writer, in Input) error {
+	var p page
+	if len(in.Summary) == 0 {
+		return errors.New("summary is required")
+	}
+	if err := json.Unmarshal(in.Summary, &p.Summary); err != nil {
+		return fmt.Errorf("parsing summary: %s", err)
+	}
+	p.SLOLatency = p.Summary.SLO.Latency.Seconds() * 1000
+	if len(in.Run) != 0 {
+		p.Run = new(data.RunMetadata)
+		if err := json.Unmarshal(in.Run, p.Run); err != nil {
+			return fmt.Errorf("parsing run metadata: %s", err)
+		}
+	}
+
+	start := p.startTime()
+	stepRules := p.stepRules(start)
+	if len(in.Throughput) != 0 {
+		points, err := readTimeSeries(in.Throughput, start, 2)
+		if err != nil {
+			return fmt.Errorf("parsing throughput: %s", err)
+		}
+		p.Throughput = chart{
+			xLabel: "seconds since start",
+			yLabel: "requests per second",
+			series: []series{{name: "throughput", points: points}},
+			xRules: stepRules,
+		}.svg()
+	}
+	if len(in.CPU) != 0 {
+		points, err := readTimeSeries(in.CPU, start, 1)
+		if err != nil {
+			return fmt.Errorf("parsing cpu stats: %s", err)
+		}
+		p.CPU = chart{
+			xLabel: "seconds since start",
+			yLabel: "CPU %",
+			series: []series{{name: "mean CPU", points: points}},
+			xRules: stepRules,
+		}.svg()
+	}
+	if len(p.Summary.Steps) != 0 {
+		p.Latency = p.latencyChart()
+		p.Headroom, p.FitError = p.headroomChart()
+	}
+
+	return pageTemplate.Execute(w, p)
+}
+
+// startTime is the start of the run, or of its first step for runs without
+// metadata.
+func (p page) startTime() time.Time {
+	if p.Run != nil && !p.Run.StartTime.IsZero() {
+		return p.Run.StartTime
+	}
+	if len(p.Summary.Steps) != 0 {
+		return p.Summary.Steps[0].Start
+	}
+	return time.Time{}
+}
+
+func (p page) stepRules(start time.Time) []rule {
+	var rules []rule
+	for _, s := range p.Summary.Steps {
+		r := rule{at: s.Start.Sub(start).Seconds()}
+		if len(p.Summary.Steps) <= 20 {
+			r.label = strconv.Itoa(s.Step)
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+func (p page) latencyChart() template.HTML {
+	c := chart{xLabel: "step", yLabel: "latency (ms)"}
+	for _, percentile := range []float64{50, 90, 99, 99.9} {
+		s := series{name: fmt.Sprintf("p%v", percentile)}
+		for _, step := range p.Summary.Steps {
+			s.points = append(s.points, point{float64(step.Step), step.Percentile(percentile)})
+		}
+		c.series = append(c.series, s)
+	}
+	return c.svg()
+}
+
+// headroomChart plots the SLO percentile latency of every step against its
+// throughput together with the fitted latency model.
+func (p page) headroomChart() (template.HTML, string) {
+	percentile := p.Summary.SLO.Percentile
+	if percentile == 0 {
+		percentile = 99
+	}
+	var throughput, latency []float64
+	measured := series{name: fmt.Sprintf("p%v by step", percentile), scatter: true}
+	for _, s := range p.Summary.Steps {
+		if s.Throughput == 0 {
+			continue
+		}
+		throughput = append(throughput, s.Throughput)
+		latency = append(latency, s.Percentile(percentile))
+		measured.points = append(measured.points, point{s.Throughput, s.Percentile(percentile)})
+	}
+	c := chart{
+		xLabel: "throughput (requests per second)",
+		yLabel: fmt.Sprintf("p%v latency (ms)", percentile),
+		series: []series{measured},
+	}
+	if p.SLOLatency > 0 {
+		c.yRules = append(c.yRules, rule{at: p.SLOLatency, label: "SLO"})
+	}
+	if p.Summary.Knee != nil {
+		c.xRules = append(c.xRules, rule{at: p.Summary.Knee.Throughput, label: "knee"})
+	}
+
+	fit, err := FitLatency(throughput, latency)
+	if err != nil {
+		return c.svg(), err.Error()
+	}
+	min, max := throughput[0], throughput[0]
+	for _, t := range throughput {
+		if t < min {
+			min = t
+		}
+		if t > max {
+			max = t
+		}
+	}
+	fitted := series{name: "fit"}
+	for i := 0; i <= 50; i++ {
+		t := min + (max-min)*float64(i)/50
+		fitted.points = append(fitted.points, point{t, fit.Latency(t)})
+	}
+	c.series = append(c.series, fitted)
+	return c.svg(), ""
+}
+
+// readTimeSeries reads a CSV document with a header row, an RFC 3339
+// timestamp in the column before firstValue and values in all following
+// columns. Each row becomes a point at its offset from start in seconds with
+// the mean of its values.
+func readTimeSeries(contents []byte, start time.Time, firstValue int) ([]point, error) {
+	records, err := csv.NewReader(bytes.NewReader(contents)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var points []point
+	for i, record := range records {
+		if i == 0 {
+			continue
+		}
+		if len(record) <= firstValue {
+			return nil, fmt.Errorf("row %d has no values", i+1)
+		}
+		t, err := time.Parse(time.RFC3339Nano, record[firstValue-1])
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %s", i+1, err)
+		}
+		sum := 0.0
+		for _, field := range record[firstValue:] {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %s", i+1, err)
+			}
+			sum += v
+		}
+		points = append(points, point{t.Sub(start).Seconds(), sum / float64(len(record)-firstValue)})
+	}
+	return points, nil
+}
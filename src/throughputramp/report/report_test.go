@@ -0,0 +1,120 @@
+package report_test
+
+import (
+	"bytes"
+	"strings"
+
+	"throughputramp/report"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const summaryJSON = `{
+	"slo": {"percentile": 99, "latency_ms": 10},
+	"knee": {"step": 2, "start_time": "2016-12-15T23:00:10Z", "concurrency": 2, "throughput": 190, "p99_ms": 8},
+	"steps": [
+		{"step": 1, "start_time": "2016-12-15T23:00:00Z", "end_time": "2016-12-15T23:00:10Z", "concurrency": 1, "requests": 1000, "throughput": 100, "p50_ms": 2, "p90_ms": 3, "p99_ms": 5, "p99_9_ms": 6, "max_ms": 7},
+		{"step": 2, "start_time": "2016-12-15T23:00:10Z", "end_time": "2016-12-15T23:00:20Z", "concurrency": 2, "requests": 1900, "throughput": 190, "p50_ms": 3, "p90_ms": 5, "p99_ms": 8, "p99_9_ms": 9, "max_ms": 10},
+		{"step": 3, "start_time": "2016-12-15T23:00:20Z", "end_time": "2016-12-15T23:00:30Z", "concurrency": 3, "requests": 2000, "throughput": 200, "p50_ms": 10, "p90_ms": 20, "p99_ms": 40, "p99_9_ms": 50, "max_ms": 60}
+	]
+}`
+
+const runJSON = `{
+	"throughputramp_version": "1.2.3",
+	"go_version": "go1.16",
+	"generator": "http",
+	"router": "http://router.example.com",
+	"host": "<app>.example.com",
+	"routing_release_version": "0.150.0",
+	"start_time": "2016-12-15T23:00:00Z",
+	"end_time": "2016-12-15T23:00:31Z"
+}`
+
+const throughputCSV = `step,start-time,throughput
+1,2016-12-15T23:00:00Z,100.000000
+1,2016-12-15T23:00:05Z,100.000000
+2,2016-12-15T23:00:10Z,190.000000
+2,2016-12-15T23:00:15Z,190.000000
+3,2016-12-15T23:00:20Z,200.000000
+3,2016-12-15T23:00:25Z,200.000000`
+
+const cpuCSV = `timestamp,percentage,percentage
+2016-12-15T23:00:01Z,10.000000,20.000000
+2016-12-15T23:00:15Z,40.000000,50.000000`
+
+var _ = Describe("Generate", func() {
+	var input report.Input
+
+	BeforeEach(func() {
+		input = report.Input{
+			Summary:    []byte(summaryJSON),
+			Run:        []byte(runJSON),
+			Throughput: []byte(throughputCSV),
+			CPU:        []byte(cpuCSV),
+		}
+	})
+
+	generate := func() string {
+		buf := new(bytes.Buffer)
+		Expect(report.Generate(buf, input)).To(Succeed())
+		return buf.String()
+	}
+
+	It("renders a chart for throughput, latency, CPU and headroom", func() {
+		html := generate()
+		Expect(strings.Count(html, "<svg")).To(Equal(4))
+		Expect(html).To(ContainSubstring("<h2>Throughput over time</h2>"))
+		Expect(html).To(ContainSubstring("<h2>CPU over time</h2>"))
+		Expect(html).To(ContainSubstring(">fit</text>"))
+		Expect(html).To(ContainSubstring(">SLO</text>"))
+		Expect(html).To(ContainSubstring(">knee</text>"))
+		Expect(html).To(ContainSubstring("knee at step 2 (concurrency 2, rate 0): 190.0 requests per second, p99 latency 8.000ms"))
+	})
+
+	It("is self-contained", func() {
+		html := generate()
+		Expect(html).NotTo(ContainSubstring("<script"))
+		Expect(html).NotTo(ContainSubstring("<link"))
+		Expect(html).NotTo(MatchRegexp(`(src|href)=`))
+	})
+
+	It("describes the run and escapes its values", func() {
+		html := generate()
+		Expect(html).To(ContainSubstring("http://router.example.com"))
+		Expect(html).To(ContainSubstring("&lt;app&gt;.example.com"))
+		Expect(html).To(ContainSubstring("0.150.0"))
+		Expect(html).To(ContainSubstring("1.2.3 (go1.16)"))
+	})
+
+	It("plots the mean of all CPUs", func() {
+		Expect(generate()).To(MatchRegexp(`<polyline[^>]*points="[0-9.]+,[0-9.]+ [0-9.]+,[0-9.]+ "`))
+	})
+
+	It("leaves out the charts of missing files", func() {
+		input.Run = nil
+		input.Throughput = nil
+		input.CPU = nil
+		html := generate()
+		Expect(strings.Count(html, "<svg")).To(Equal(2))
+		Expect(html).To(ContainSubstring("No throughput data."))
+		Expect(html).To(ContainSubstring("No CPU data"))
+	})
+
+	It("explains a missing fit", func() {
+		input.Summary = []byte(`{"slo": {"percentile": 99}, "steps": [{"step": 1, "throughput": 100, "p99_ms": 5}]}`)
+		Expect(generate()).To(ContainSubstring("No fit: fit needs at least two points."))
+	})
+
+	It("requires a summary", func() {
+		input.Summary = nil
+		Expect(report.Generate(new(bytes.Buffer), input)).To(MatchError("summary is required"))
+		input.Summary = []byte("{")
+		Expect(report.Generate(new(bytes.Buffer), input)).To(MatchError(HavePrefix("parsing summary:")))
+	})
+
+	It("fails on malformed CSV", func() {
+		input.CPU = []byte("timestamp,percentage\nyesterday,10")
+		Expect(report.Generate(new(bytes.Buffer), input)).To(MatchError(HavePrefix("parsing cpu stats: row 2:")))
+	})
+})
@@ -0,0 +1,63 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"time"
+)
+
+var pageTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"float": func(f float64) string { return fmt.Sprintf("%.3f", f) },
+	"time":  func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>throughputramp report{{with .Run}} {{time .StartTime}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: right; }
+th { background: #f4f4f4; }
+td.text, th.text { text-align: left; }
+.note { color: #777; }
+</style>
+</head>
+<body>
+<h1>throughputramp report</h1>
+{{with .Run}}
+<table>
+<tr><th class="text">Router</th><td class="text">{{.Router}}</td></tr>
+{{if .Host}}<tr><th class="text">Host</th><td class="text">{{.Host}}</td></tr>{{end}}
+<tr><th class="text">Generator</th><td class="text">{{.Generator}}</td></tr>
+{{if .RoutingReleaseVersion}}<tr><th class="text">Routing release</th><td class="text">{{.RoutingReleaseVersion}}</td></tr>{{end}}
+{{if .RouteTableSize}}<tr><th class="text">Route table size</th><td class="text">{{.RouteTableSize}}</td></tr>{{end}}
+<tr><th class="text">Started</th><td class="text">{{time .StartTime}}</td></tr>
+<tr><th class="text">Ended</th><td class="text">{{time .EndTime}}</td></tr>
+<tr><th class="text">throughputramp</th><td class="text">{{.ThroughputrampVersion}} ({{.GoVersion}})</td></tr>
+</table>
+{{end}}
+<p>{{.Summary}}</p>
+{{with .Summary.StopReason}}<p>{{if $.Summary.Incomplete}}Incomplete{{else}}Ended early{{end}}: {{.}}</p>{{end}}
+
+<h2>Throughput over time</h2>
+{{with .Throughput}}{{.}}{{else}}<p class="note">No throughput data.</p>{{end}}
+
+<h2>Latency percentiles per step</h2>
+{{with .Latency}}{{.}}{{else}}<p class="note">No steps.</p>{{end}}
+
+<h2>CPU over time</h2>
+{{with .CPU}}{{.}}{{else}}<p class="note">No CPU data: the run did not use a cpumonitor.</p>{{end}}
+
+<h2>Headroom</h2>
+{{with .Headroom}}{{.}}{{end}}
+{{with .FitError}}<p class="note">No fit: {{.}}.</p>{{end}}
+
+<h2>Steps</h2>
+<table>
+<tr><th>Step</th><th>Concurrency</th><th>Rate</th><th>Requests</th><th>Errors</th><th>Non-2xx</th><th>Throughput</th><th>p50 ms</th><th>p90 ms</th><th>p99 ms</th><th>p99.9 ms</th><th>Max ms</th></tr>
+{{range .Summary.Steps}}<tr><td>{{.Step}}{{if .Incomplete}} (incomplete){{end}}</td><td>{{.Concurrency}}</td><td>{{.Rate}}</td><td>{{.Requests}}</td><td>{{.Errors}}</td><td>{{.NonSuccess}}</td><td>{{float .Throughput}}</td><td>{{float .P50}}</td><td>{{float .P90}}</td><td>{{float .P99}}</td><td>{{float .P999}}</td><td>{{float .Max}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,114 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/ginkgomon"
+)
+
+var _ = Describe("Report", func() {
+	var (
+		runner       *ginkgomon.Runner
+		results, tmp string
+	)
+
+	const (
+		summaryJSON = `{"slo": {"percentile": 99, "latency_ms": 0}, "steps": [` +
+			`{"step": 1, "start_time": "2016-12-15T23:00:00Z", "concurrency": 1, "throughput": 100, "p99_ms": 5},` +
+			`{"step": 2, "start_time": "2016-12-15T23:00:10Z", "concurrency": 2, "throughput": 180, "p99_ms": 9}]}`
+		throughputCSV = "step,start-time,throughput\n" +
+			"1,2016-12-15T23:00:00Z,100.000000\n" +
+			"2,2016-12-15T23:00:10Z,180.000000\n"
+	)
+
+	generateReport := func(args ...string) {
+		runner = ginkgomon.New(ginkgomon.Config{
+			Name:    "throughputramp-report",
+			Command: exec.Command(binPath, append([]string{"report"}, args...)...),
+		})
+		process := ifrit.Background(runner)
+		Eventually(process.Wait(), "5s").Should(Receive())
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmp, err = ioutil.TempDir("", "report")
+		Expect(err).NotTo(HaveOccurred())
+		results = filepath.Join(tmp, "results")
+		Expect(os.Mkdir(results, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(results, "summary.json"), []byte(summaryJSON), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(results, "throughput.csv"), []byte(throughputCSV), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmp)).To(Succeed())
+	})
+
+	It("writes the report of a local run and leaves out missing files", func() {
+		output := filepath.Join(tmp, "out.html")
+		generateReport("-o", output, results)
+		Expect(runner.ExitCode()).To(Equal(0))
+		Expect(runner).To(gbytes.Say("report written to " + output))
+		Expect(runner.Err()).To(gbytes.Say("Leaving out run.json"))
+		Expect(runner.Err()).To(gbytes.Say("Leaving out cpuStats.csv"))
+
+		html, err := ioutil.ReadFile(output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(html)).To(HavePrefix("<!DOCTYPE html>"))
+		Expect(string(html)).To(ContainSubstring("<h2>Throughput over time</h2>\n<svg"))
+	})
+
+	It("exits 2 when the summary cannot be read", func() {
+		Expect(os.Remove(filepath.Join(results, "summary.json"))).To(Succeed())
+		generateReport("-o", filepath.Join(tmp, "out.html"), results)
+		Expect(runner.ExitCode()).To(Equal(2))
+		Expect(runner.Err()).To(gbytes.Say("summary.json"))
+	})
+
+	It("exits 2 with usage without results", func() {
+		generateReport()
+		Expect(runner.ExitCode()).To(Equal(2))
+		Expect(runner.Err()).To(gbytes.Say("Usage: throughputramp report"))
+	})
+
+	Context("when the run is stored in S3", func() {
+		var testS3Server *ghttp.Server
+
+		BeforeEach(func() {
+			testS3Server = ghttp.NewServer()
+			testS3Server.RouteToHandler("GET", "/blah-bucket/summary-2016-12-15T23:00:00Z.json",
+				ghttp.RespondWith(http.StatusOK, summaryJSON))
+			testS3Server.RouteToHandler("GET", "/blah-bucket/throughput-2016-12-15T23:00:00Z.csv",
+				ghttp.RespondWith(http.StatusOK, throughputCSV))
+			testS3Server.AllowUnhandledRequests = true
+			testS3Server.UnhandledRequestStatusCode = http.StatusNotFound
+		})
+
+		AfterEach(func() {
+			testS3Server.Close()
+		})
+
+		It("downloads its results", func() {
+			output := filepath.Join(tmp, "out.html")
+			generateReport(
+				"-o", output,
+				"-s3-endpoint", testS3Server.URL(),
+				"-access-key-id", "ABCD",
+				"-secret-access-key", "ABCD",
+				"s3://blah-bucket/2016-12-15T23:00:00Z",
+			)
+			Expect(runner.ExitCode()).To(Equal(0))
+			Expect(output).To(BeAnExistingFile())
+			Expect(testS3Server.ReceivedRequests()).To(HaveLen(4))
+		})
+	})
+})
@@ -0,0 +1,76 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultHTTPTimeout is the time an upload is given when HTTP.Timeout is 0.
+const DefaultHTTPTimeout = 5 * time.Minute
+
+// HTTP uploads every file with a PUT request to its key below URL. Together
+// with an Authorization header this works with the XML API of Google Cloud
+// Storage and other stores that accept plain PUT uploads. Every upload is
+// given Timeout to complete, DefaultHTTPTimeout if it is 0.
+type HTTP struct {
+	URL     string
+	Header  http.Header
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+func (h *HTTP) Put(f File) (string, error) {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	location := strings.TrimSuffix(h.URL, "/") + "/" + url.PathEscape(f.Key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location, bytes.NewReader(f.Contents))
+	if err != nil {
+		return "", err
+	}
+	for name, values := range h.Header {
+		req.Header[name] = values
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType(f.Key))
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("PUT %s: %s", location, resp.Status)
+	}
+	return location, nil
+}
+
+func contentType(name string) string {
+	switch path.Ext(name) {
+	case ".csv":
+		return "text/csv"
+	case ".json":
+		return "application/json"
+	case ".hlog":
+		return "text/plain"
+	case ".html":
+		return "text/html; charset=utf-8"
+	default:
+		return "application/octet-stream"
+	}
+}
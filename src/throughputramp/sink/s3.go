@@ -0,0 +1,16 @@
+package sink
+
+import (
+	"bytes"
+
+	"throughputramp/uploader"
+)
+
+// S3 uploads files by key to an S3 bucket.
+type S3 struct {
+	Config *uploader.Config
+}
+
+func (s *S3) Put(f File) (string, error) {
+	return uploader.Upload(s.Config, bytes.NewReader(f.Contents), f.Key)
+}
@@ -0,0 +1,89 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// File is one result file of a run. Name is the plain file name used when
+// the results of a single run are stored together, Key the timestamped name
+// used in buckets shared by many runs.
+type File struct {
+	Name     string
+	Key      string
+	Contents []byte
+}
+
+// SamplesFile is the name of the file with every request of a run.
+const SamplesFile = "perfResults.csv"
+
+// NewFile returns a result file named name of the run started at timestamp.
+func NewFile(name, timestamp string, contents []byte) File {
+	return File{Name: name, Key: Key(name, timestamp), Contents: contents}
+}
+
+// NewTargetFile returns a result file of one target of a run against several
+// routers. Its name is placed in a directory named after the target and its
+// key carries the target after the timestamp, so that the results of every
+// target read back like those of a run of their own.
+func NewTargetFile(target, name, timestamp string, contents []byte) File {
+	return File{Name: path.Join(target, name), Key: Key(name, timestamp+"-"+target), Contents: contents}
+}
+
+// Key returns the timestamped name of a result file, e.g.
+// steps-<timestamp>.csv. The samples file is keyed by the bare timestamp, as
+// it was the only result file of early runs.
+func Key(name, timestamp string) string {
+	ext := path.Ext(name)
+	if name == SamplesFile {
+		return timestamp + ext
+	}
+	return strings.TrimSuffix(name, ext) + "-" + timestamp + ext
+}
+
+// Sink stores result files and returns where each file was stored.
+type Sink interface {
+	Put(f File) (string, error)
+}
+
+// Local stores files by name in a directory, creating it and the
+// directories of the names if needed.
+type Local struct {
+	Dir string
+}
+
+func (l *Local) Put(f File) (string, error) {
+	path := filepath.Join(l.Dir, filepath.FromSlash(f.Name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, f.Contents, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Writer writes every file to W, each preceded by a line with its name.
+type Writer struct {
+	W io.Writer
+}
+
+func (w *Writer) Put(f File) (string, error) {
+	if _, err := fmt.Fprintf(w.W, "==> %s <==\n", f.Name); err != nil {
+		return "", err
+	}
+	if _, err := w.W.Write(f.Contents); err != nil {
+		return "", err
+	}
+	if len(f.Contents) > 0 && f.Contents[len(f.Contents)-1] != '\n' {
+		if _, err := io.WriteString(w.W, "\n"); err != nil {
+			return "", err
+		}
+	}
+	return "stdout", nil
+}
@@ -0,0 +1,152 @@
+package sink_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"throughputramp/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Sink", func() {
+	var file sink.File
+
+	BeforeEach(func() {
+		file = sink.File{
+			Name:     "steps.csv",
+			Key:      "steps-2016-12-15T23:00:00Z.csv",
+			Contents: []byte("step,start-time\n1,0\n"),
+		}
+	})
+
+	Describe("NewFile", func() {
+		It("keys files by name and timestamp", func() {
+			f := sink.NewFile("steps.csv", "2016-12-15T23:00:00Z", nil)
+			Expect(f.Name).To(Equal("steps.csv"))
+			Expect(f.Key).To(Equal("steps-2016-12-15T23:00:00Z.csv"))
+			Expect(sink.Key("perfResults.csv", "2016-12-15T23:00:00Z")).To(Equal("2016-12-15T23:00:00Z.csv"))
+		})
+
+		It("places the files of a target in its directory and after the timestamp in its key", func() {
+			f := sink.NewTargetFile("b", "steps.csv", "2016-12-15T23:00:00Z", nil)
+			Expect(f.Name).To(Equal("b/steps.csv"))
+			Expect(f.Key).To(Equal("steps-2016-12-15T23:00:00Z-b.csv"))
+			f = sink.NewTargetFile("b", "perfResults.csv", "2016-12-15T23:00:00Z", nil)
+			Expect(f.Key).To(Equal("2016-12-15T23:00:00Z-b.csv"))
+		})
+	})
+
+	Describe("Local", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "sink")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("writes the file by name, creating the directory", func() {
+			local := &sink.Local{Dir: filepath.Join(dir, "results")}
+			loc, err := local.Put(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loc).To(Equal(filepath.Join(dir, "results", "steps.csv")))
+
+			contents, err := ioutil.ReadFile(loc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(contents).To(Equal(file.Contents))
+		})
+
+		It("creates the directories of names", func() {
+			local := &sink.Local{Dir: dir}
+			loc, err := local.Put(sink.NewTargetFile("b", "steps.csv", "2016-12-15T23:00:00Z", file.Contents))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loc).To(Equal(filepath.Join(dir, "b", "steps.csv")))
+			Expect(loc).To(BeAnExistingFile())
+		})
+	})
+
+	Describe("Writer", func() {
+		It("writes the name followed by the contents", func() {
+			out := new(bytes.Buffer)
+			w := &sink.Writer{W: out}
+			_, err := w.Put(file)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = w.Put(sink.File{Name: "run.json", Contents: []byte("{}")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.String()).To(Equal("==> steps.csv <==\nstep,start-time\n1,0\n==> run.json <==\n{}\n"))
+		})
+	})
+
+	Describe("HTTP", func() {
+		var server *ghttp.Server
+
+		BeforeEach(func() {
+			server = ghttp.NewServer()
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("puts the file by key below the url", func() {
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("PUT", "/bucket/steps-2016-12-15T23:00:00Z.csv"),
+				ghttp.VerifyHeaderKV("Authorization", "Bearer token"),
+				ghttp.VerifyHeaderKV("Content-Type", "text/csv"),
+				ghttp.VerifyBody(file.Contents),
+				ghttp.RespondWith(http.StatusOK, nil),
+			))
+
+			h := &sink.HTTP{
+				URL:    server.URL() + "/bucket/",
+				Header: http.Header{"Authorization": {"Bearer token"}},
+			}
+			loc, err := h.Put(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loc).To(Equal(server.URL() + "/bucket/steps-2016-12-15T23:00:00Z.csv"))
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		It("serves reports as HTML", func() {
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("PUT", "/report-2016-12-15T23:00:00Z.html"),
+				ghttp.VerifyHeaderKV("Content-Type", "text/html; charset=utf-8"),
+				ghttp.RespondWith(http.StatusOK, nil),
+			))
+
+			h := &sink.HTTP{URL: server.URL()}
+			_, err := h.Put(sink.NewFile("report.html", "2016-12-15T23:00:00Z", []byte("<html></html>")))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("gives up on uploads that do not complete in time", func() {
+			server.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
+				ioutil.ReadAll(req.Body)
+				<-req.Context().Done()
+			})
+
+			h := &sink.HTTP{URL: server.URL(), Timeout: 100 * time.Millisecond}
+			_, err := h.Put(file)
+			Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+		})
+
+		It("fails on non-2xx responses", func() {
+			server.AppendHandlers(ghttp.RespondWith(http.StatusForbidden, nil))
+
+			h := &sink.HTTP{URL: server.URL()}
+			_, err := h.Put(file)
+			Expect(err).To(MatchError(ContainSubstring("403 Forbidden")))
+		})
+	})
+})
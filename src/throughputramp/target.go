@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"throughputramp/analysis"
+	"throughputramp/checkpoint"
+	"throughputramp/data"
+	"throughputramp/histogram"
+	"throughputramp/loadgen"
+	"throughputramp/report"
+	"throughputramp/sink"
+)
+
+const (
+	orderAlternate = "alternate"
+	orderFixed     = "fixed"
+)
+
+var targetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// target is a router under test together with the results collected from
+// it. The name is empty in runs with a single target, whose results are
+// stored without it.
+type target struct {
+	name      string
+	url       string
+	generator loadgen.Generator
+
+	samples          *bytes.Buffer
+	sampleWriter     *data.SampleWriter
+	throughput       *bytes.Buffer
+	throughputWriter *data.ThroughputWriter
+	latencyLog       *bytes.Buffer
+	latencyLogWriter *histogram.LogWriter
+	// stepData is what the last recorded step added to the datasets.
+	stepData checkpoint.Step
+
+	steps      []analysis.StepSummary
+	stopReason string
+	err        error
+	done       bool
+}
+
+// parseTargets parses the router arguments. Each is a URL, optionally
+// prefixed with a name as in name=URL. With more than one target, unnamed
+// ones are named target-<n> after their position.
+func parseTargets(args []string) ([]*target, error) {
+	var targets []*target
+	names := make(map[string]bool)
+	for i, arg := range args {
+		t := &target{url: arg}
+		if eq := strings.Index(arg, "="); eq > 0 && !strings.ContainsAny(arg[:eq], ":/") {
+			t.name, t.url = arg[:eq], arg[eq+1:]
+			if !targetNamePattern.MatchString(t.name) {
+				return nil, fmt.Errorf("target name %q may only contain letters, digits, '.', '_' and '-'", t.name)
+			}
+		} else if len(args) > 1 {
+			t.name = fmt.Sprintf("target-%d", i+1)
+		}
+		if names[t.name] {
+			return nil, fmt.Errorf("duplicate target name %q", t.name)
+		}
+		names[t.name] = true
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// order returns the targets that still run step i in the order they run
+// it. Alternating rotates the first target with every step, so that no
+// target always runs right after the same other one.
+func order(targets []*target, i int, mode string) []*target {
+	var ordered []*target
+	for j := range targets {
+		k := j
+		if mode == orderAlternate {
+			k = (i + j) % len(targets)
+		}
+		if !targets[k].done {
+			ordered = append(ordered, targets[k])
+		}
+	}
+	return ordered
+}
+
+func (t *target) start(startTime time.Time, throughputInterval time.Duration) error {
+	t.samples = new(bytes.Buffer)
+	t.sampleWriter = data.NewSampleWriter(t.samples)
+	t.throughput = new(bytes.Buffer)
+	t.throughputWriter = data.NewThroughputWriter(t.throughput, throughputInterval)
+	t.latencyLog = new(bytes.Buffer)
+	var err error
+	t.latencyLogWriter, err = histogram.NewLogWriter(t.latencyLog, startTime)
+	if err != nil {
+		return err
+	}
+	t.latencyLogWriter.MaxValueUnitRatio = 1000
+	return nil
+}
+
+// record adds the result of step to the datasets of the target and returns
+// its summary, which is marked incomplete if the step was interrupted.
+func (t *target) record(step int, result loadgen.Result, incomplete bool) (analysis.StepSummary, error) {
+	samples, throughput, latencyLog := t.samples.Len(), t.throughput.Len(), t.latencyLog.Len()
+	if err := t.sampleWriter.Write(step, result); err != nil {
+		return analysis.StepSummary{}, err
+	}
+	if err := t.throughputWriter.Write(step, result); err != nil {
+		return analysis.StepSummary{}, err
+	}
+	err := t.latencyLogWriter.WriteInterval(fmt.Sprintf("step-%d", step), result.Start, result.End, result.Latency)
+	if err != nil {
+		return analysis.StepSummary{}, err
+	}
+	t.stepData = checkpoint.Step{
+		Samples:    t.samples.Bytes()[samples:],
+		Throughput: t.throughput.Bytes()[throughput:],
+		LatencyLog: t.latencyLog.Bytes()[latencyLog:],
+	}
+	summary := analysis.Summarize(step, result)
+	summary.Incomplete = incomplete
+	t.steps = append(t.steps, summary)
+	return summary, nil
+}
+
+// persist writes the data of the last recorded step to the checkpoint
+// directory.
+func (t *target) persist(dir string, step int) error {
+	return checkpoint.WriteStep(dir, t.name, step, t.stepData)
+}
+
+// state returns the target as recorded in checkpoints.
+func (t *target) state() checkpoint.Target {
+	state := checkpoint.Target{
+		Name:       t.name,
+		URL:        t.url,
+		Steps:      t.steps,
+		StopReason: t.stopReason,
+	}
+	if t.err != nil {
+		state.Err = t.err.Error()
+	}
+	return state
+}
+
+// restore continues the target from its state in a checkpoint, reading the
+// data of its steps from dir. The target must have been started.
+func (t *target) restore(dir string, state checkpoint.Target) error {
+	for _, s := range state.Steps {
+		step, err := checkpoint.ReadStep(dir, t.name, s.Step)
+		if err != nil {
+			return err
+		}
+		t.samples.Write(step.Samples)
+		t.throughput.Write(step.Throughput)
+		t.latencyLog.Write(step.LatencyLog)
+	}
+	if len(state.Steps) > 0 {
+		t.sampleWriter.Resume()
+		t.throughputWriter.Resume()
+	}
+	t.steps = state.Steps
+	t.stopReason = state.StopReason
+	t.done = state.StopReason != ""
+	if state.Err != "" {
+		t.err = errors.New(state.Err)
+	}
+	return nil
+}
+
+// stop ends the ramp of the target after the current step.
+func (t *target) stop(reason string) {
+	t.stopReason = reason
+	t.done = true
+}
+
+// label prefixes messages about the target in multi-target runs.
+func (t *target) label() string {
+	if t.name == "" {
+		return ""
+	}
+	return t.name + ": "
+}
+
+// files returns the result files of the target. metadata describes the
+// whole run and is completed with the target.
+func (t *target) files(slo analysis.SLO, metadata data.RunMetadata, cpuCsv []byte) ([]sink.File, error) {
+	summary := analysis.NewSummary(t.steps, slo)
+	summary.StopReason = t.stopReason
+	summary.Incomplete = metadata.Incomplete
+	fmt.Fprintf(os.Stdout, "%s%s\n", t.label(), summary)
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling summary: %s", err)
+	}
+
+	metadata.Router = t.url
+	metadata.Target = t.name
+	runJSON, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling run metadata: %s", err)
+	}
+
+	reportHTML := new(bytes.Buffer)
+	err = report.Generate(reportHTML, report.Input{
+		Summary:    summaryJSON,
+		Run:        runJSON,
+		Throughput: t.throughput.Bytes(),
+		CPU:        cpuCsv,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("generating report: %s", err)
+	}
+
+	timestamp := metadata.StartTime.Format(time.RFC3339)
+	newFile := func(name string, contents []byte) sink.File {
+		if t.name == "" {
+			return sink.NewFile(name, timestamp, contents)
+		}
+		return sink.NewTargetFile(t.name, name, timestamp, contents)
+	}
+	var files []sink.File
+	if *keepSamples {
+		files = append(files, newFile(sink.SamplesFile, t.samples.Bytes()))
+	}
+	if len(cpuCsv) != 0 {
+		files = append(files, newFile("cpuStats.csv", cpuCsv))
+	}
+	files = append(files,
+		newFile("steps.csv", data.GenerateStepCSV(t.steps)),
+		newFile("summary.json", summaryJSON),
+		newFile("run.json", runJSON),
+		newFile("latency.hlog", t.latencyLog.Bytes()),
+		newFile("throughput.csv", t.throughput.Bytes()),
+		newFile("report.html", reportHTML.Bytes()),
+	)
+	if len(metadata.Agents) > 0 {
+		files = append(files, newFile("agents.csv", data.GenerateAgentCSV(t.steps)))
+	}
+	return files, nil
+}
@@ -1,28 +1,46 @@
 package main
 
 import (
-	"bytes"
-	"encoding/csv"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"strconv"
+	"os/signal"
+	"reflect"
+	"runtime"
+	"runtime/debug"
 	"strings"
+	"syscall"
 	"time"
 
+	"throughputramp/agent"
+	"throughputramp/analysis"
+	"throughputramp/checkpoint"
+	"throughputramp/cpumonitor"
 	"throughputramp/data"
+	"throughputramp/loadgen"
+	"throughputramp/profile"
+	"throughputramp/progress"
+	"throughputramp/sink"
 	"throughputramp/uploader"
 )
 
 var (
 	numRequests      = flag.Int("n", 1000, "number of requests to send")
 	host             = flag.String("host", "", "Value of host header for backend request.")
-	interval         = flag.Int("i", 1, "interval in seconds to average throughput")
+	appName          = flag.String("app-name", "", "App name of the routes registered by http_route_populator, <app-name>-<i>.<app-domain>, to spread the requests across instead of using -host")
+	appDomain        = flag.String("app-domain", "", "App domain of the routes registered by http_route_populator")
+	numRoutes        = flag.Int("num-routes", 0, "Number of routes registered by http_route_populator to spread the requests across")
+	routeDist        = flag.String("route-distribution", loadgen.DistributionRoundRobin, "Distribution of the requests across the routes: round-robin, uniform, zipf or hot-set")
+	zipfExponent     = flag.Float64("zipf-exponent", 1.1, "Exponent of the zipf route distribution, greater than 1. Higher values concentrate the requests on fewer routes")
+	hotRoutes        = flag.Int("hot-routes", 0, "Number of routes in the hot set of the hot-set route distribution")
+	hotTraffic       = flag.Float64("hot-traffic", 0.9, "Fraction of the requests the hot-set route distribution sends to the hot routes")
+	interval         = flag.Int("i", 1, "interval in seconds to average throughput over in throughput.csv and the report")
 	threadRateLimit  = flag.Int("q", 0, "thread rate limit")
 	lowerConcurrency = flag.Int("lower-concurrency", 1, "Starting concurrency value")
 	upperConcurrency = flag.Int("upper-concurrency", 30, "Ending concurrency value")
@@ -33,218 +51,759 @@ var (
 	accessKeyID      = flag.String("access-key-id", "", "AccessKeyID for the S3 service.")
 	secretAccessKey  = flag.String("secret-access-key", "", "SecretAccessKey for the S3 service.")
 	cpuMonitorURL    = flag.String("cpumonitor-url", "", "Endpoint for monitoring CPU metrics")
+	cpuTimeout       = flag.Duration("cpumonitor-timeout", cpumonitor.DefaultTimeout, "Timeout of every request to the cpumonitor")
+	cpuRetries       = flag.Int("cpumonitor-retries", cpumonitor.DefaultRetries, "Number of times a failed request to the cpumonitor is retried, with exponential backoff")
 	localCSV         = flag.String("local-csv", "", "Stores csv locally to a specified directory when the flag is set")
+	generatorName    = flag.String("generator", "native", "Load generator to use: native or hey")
+	disableKeepAlive = flag.Bool("disable-keepalive", false, "Open a new connection for every request")
+	maxConnRequests  = flag.Int("max-requests-per-connection", 0, "Close every connection after this many requests, 0 for no limit")
+	maxIdleConns     = flag.Int("max-idle-connections", 0, "Number of idle connections kept for reuse, 0 for one per worker")
+	connRate         = flag.Int("connection-rate", 0, "Maximum number of new connections opened per second, 0 for no limit")
+	protocol         = flag.String("protocol", loadgen.ProtocolHTTP1, "Protocol of the native generator: http1, h2 for HTTP/2 over TLS or h2c for HTTP/2 over cleartext")
+	streamsPerConn   = flag.Int("streams-per-connection", 0, "Number of workers multiplexed over each HTTP/2 connection. 0 shares connections up to the router's stream limit")
+	tlsCA            = flag.String("tls-ca", "", "PEM file with the CA certificates to verify the router with. The router's certificate is not verified when unset")
+	tlsCert          = flag.String("tls-cert", "", "PEM file with the client certificate for mutual TLS")
+	tlsKey           = flag.String("tls-key", "", "PEM file with the key of the client certificate")
+	tlsServerName    = flag.String("tls-server-name", "", "Server name sent with SNI and verified, instead of the host of the router URL")
+	tlsResumption    = flag.Bool("tls-session-resumption", false, "Resume TLS sessions when opening new connections instead of doing a full handshake")
+	tlsMinVersion    = flag.String("tls-min-version", "", "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	tlsMaxVersion    = flag.String("tls-max-version", "", "Maximum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	tlsCiphers       = flag.String("tls-ciphers", "", "Comma-separated cipher suites offered up to TLS 1.2, such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	timeout          = flag.Int("timeout", 20, "Timeout in seconds for each request, 0 for no timeout")
+	lowerRate        = flag.Int("lower-rate", 100, "Starting requests per second when ramping the request rate")
+	upperRate        = flag.Int("upper-rate", 0, "Ending requests per second. When set the ramp is open-loop and ramps the request rate instead of concurrency")
+	rateStep         = flag.Int("rate-step", 100, "Requests per second increase per run")
+	workers          = flag.Int("workers", profile.DefaultWorkers, "Maximum number of requests in flight when ramping the request rate")
+	profilePath      = flag.String("profile", "", "YAML or JSON file describing the stages of the ramp. Overrides the concurrency and rate ramp flags")
+	stepDuration     = flag.Duration("duration", 0, "Run each step for this long instead of sending -n requests")
+	warmup           = flag.Duration("warmup", 0, "Warm-up time before each step that is excluded from the results")
+	sloLatency       = flag.Duration("slo-latency", 0, "Latency objective used to find the knee, the step with the highest throughput that meets it")
+	sloPercentile    = flag.Float64("slo-percentile", 99, "Latency percentile the SLO applies to: 50, 90, 99, 99.9 or 100")
+	stopP99          = flag.Duration("stop-p99", 0, "End the ramp after a step whose p99 latency is above this value")
+	stopErrorRatio   = flag.Float64("stop-error-ratio", 0, "End the ramp after a step whose ratio of non-2xx responses and failed requests is above this value")
+	stopConnectErrs  = flag.Int("stop-connect-errors", 0, "End the ramp after a step with more connect errors than this value")
+	releaseVersion   = flag.String("routing-release-version", "", "Version of the routing release under test, recorded in run.json")
+	routeTableSize   = flag.Int("route-table-size", 0, "Number of routes registered with the router under test, recorded in run.json")
+	cpuRunInterval   = flag.Int("cpumonitor-run-interval", 0, "Sampling interval of the cpumonitor in milliseconds, recorded in run.json")
+	cpuPerCPU        = flag.Bool("cpumonitor-per-cpu", false, "Whether the cpumonitor reports usage per CPU, recorded in run.json")
+	putURL           = flag.String("put-url", "", "Upload the results with HTTP PUT requests to this URL, for example a Google Cloud Storage bucket")
+	toStdout         = flag.Bool("stdout", false, "Write the results to stdout")
+	keepSamples      = flag.Bool("samples", false, "Keep every request and write them to perfResults.csv in addition to the latency histograms")
+	targetOrder      = flag.String("target-order", orderAlternate, "Order in which every step runs against multiple routers: alternate starts each step with the next router, fixed always runs them in the given order")
+	agents           = flag.String("agents", "", "Comma-separated addresses of throughputramp agents to split the load of every step across")
+	agentToken       = flag.String("agent-token", "", "Bearer token sent to the agents. Can also be set with THROUGHPUTRAMP_AGENT_TOKEN")
+	agentCA          = flag.String("agent-ca", "", "PEM file with the CA certificates to verify agents reached over https with")
+	agentStartDelay  = flag.Duration("agent-start-delay", agent.DefaultStartDelay, "Time the agents are given to receive a step before all of them start it")
+	method           = flag.String("method", http.MethodGet, "Method of the requests sent to the router")
+	body             = flag.String("body", "", "Body of the requests sent to the router. {{seq}} and {{random}} are replaced for every request")
+	bodyFile         = flag.String("body-file", "", "File with the body of the requests sent to the router, instead of -body")
+	bodyMinSize      = flag.Int("body-min-size", 0, "Minimum size in bytes of the random bodies sent with -body-max-size")
+	bodyMaxSize      = flag.Int("body-max-size", 0, "Send a random body of -body-min-size to this many bytes with every request")
+	stream           = flag.String("stream", "", "Hold a long-lived connection per worker instead of sending requests: websocket or sse. Requires -duration")
+	messageRate      = flag.Int("message-rate", 0, "WebSocket messages sent per second over each connection, 0 to send them back to back")
+	messageSize      = flag.Int("message-size", 32, "Size in bytes of the WebSocket messages")
+	progressAddr     = flag.String("progress-addr", "", "Address, such as :8090, to serve the progress of the ramp on as JSON, and as Prometheus metrics on /metrics")
+	checkpointDir    = flag.String("checkpoint-dir", "", "Directory to persist every completed step to, so that an interrupted run can be continued with -resume")
+	resumeDir        = flag.String("resume", "", "Continue the interrupted run checkpointed to this directory after its last completed step. Requires the ramp and routers of the interrupted run. Starts a new run if the checkpointed one finished")
+	progressInterval = flag.Duration("progress-interval", 0, "Print a progress summary this often while the ramp runs, 0 to disable")
+	putHeaders       = make(headerFlag)
+	requestHeaders   = make(headerFlag)
+	requestQuery     = make(queryFlag)
 )
 
+func init() {
+	if version == "dev" {
+		version = buildVersion(version)
+	}
+	flag.Var(putHeaders, "put-header", "Header added to every -put-url request, as 'Name: value'. Can be repeated")
+	flag.Var(requestHeaders, "header", "Header added to the requests sent to the router, as 'Name: value'. {{seq}} and {{random}} are replaced for every request. Can be repeated")
+	flag.Var(requestQuery, "query", "Query parameter added to the requests sent to the router, as 'name=value'. {{seq}} and {{random}} are replaced for every request. Can be repeated")
+}
+
+// version is set at build time with -ldflags "-X main.version=...". Builds
+// without it fall back to the version recorded by the go command.
+var version = "dev"
+
+var tracker = progress.NewTracker()
+
+// secretFlags are left out of run.json.
+var secretFlags = map[string]bool{
+	"access-key-id":     true,
+	"secret-access-key": true,
+	"put-header":        true,
+	"agent-token":       true,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "compare":
+			os.Exit(runCompare(os.Args[2:]))
+		case "report":
+			os.Exit(runReport(os.Args[2:]))
+		case "agent":
+			os.Exit(runAgent(os.Args[2:]))
+		}
+	}
+
 	flag.Parse()
 	if flag.NArg() < 1 {
 		usageAndExit()
 	}
 
-	s3Config := &uploader.Config{
-		Endpoint:        *s3Endpoint,
-		AwsRegion:       *s3Region,
-		BucketName:      *bucketName,
-		AccessKeyID:     *accessKeyID,
-		SecretAccessKey: *secretAccessKey,
-	}
-	err := s3Config.Validate()
+	sinks, err := resultSinks()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "s3 config error: %s\n", err)
+		fmt.Fprintf(os.Stderr, "%s\n", err)
 		usageAndExit()
 	}
 
-	router := flag.Args()[0]
-
-	cpumonitorURL := strings.TrimPrefix(*cpuMonitorURL, "http://")
-
-	runBenchmark(router,
-		*host,
-		cpumonitorURL,
-		*numRequests,
-		*lowerConcurrency,
-		*upperConcurrency,
-		*concurrencyStep,
-		*threadRateLimit,
-		s3Config)
-
-}
-
-func uploadCSV(s3config *uploader.Config, csvData io.Reader, cpuCsv []byte) {
-	timeString := time.Now().UTC().Format(time.RFC3339)
-	csvDataFile := timeString + ".csv"
-	var cpuFilename string
-
-	loc, err := uploader.Upload(s3config, csvData, csvDataFile)
+	targets, err := parseTargets(flag.Args())
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "uploading to s3 error: %s\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		usageAndExit()
+	}
+	if *targetOrder != orderAlternate && *targetOrder != orderFixed {
+		fmt.Fprintf(os.Stderr, "unknown target order %q\n", *targetOrder)
+		usageAndExit()
+	}
+	agentList := agentURLs(*agents)
+	// The key is sent to the agents along with the rest of the step.
+	if *tlsKey != "" && !allHTTPS(agentList) {
+		fmt.Fprintf(os.Stderr, "a client certificate can only be combined with agents reached over https\n")
+		usageAndExit()
+	}
+	client, err := agentClient(*agentCA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		usageAndExit()
+	}
+	tlsConfig, err := clientTLSConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		usageAndExit()
+	}
+	request, err := requestTemplate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		usageAndExit()
+	}
+	if *agentToken == "" {
+		*agentToken = os.Getenv("THROUGHPUTRAMP_AGENT_TOKEN")
+	}
+	for _, t := range targets {
+		config := loadgen.Config{
+			URL:                      t.url,
+			Host:                     *host,
+			DisableKeepAlives:        *disableKeepAlive,
+			KeepSamples:              *keepSamples,
+			Timeout:                  time.Duration(*timeout) * time.Second,
+			Protocol:                 *protocol,
+			StreamsPerConnection:     *streamsPerConn,
+			TLS:                      tlsConfig,
+			MaxRequestsPerConnection: *maxConnRequests,
+			MaxIdleConnections:       *maxIdleConns,
+			ConnectionRate:           *connRate,
+			Request:                  request,
+			Stream: loadgen.StreamConfig{
+				Kind:        *stream,
+				MessageRate: *messageRate,
+				MessageSize: *messageSize,
+			},
+			Routes: loadgen.Routes{
+				AppName:      *appName,
+				AppDomain:    *appDomain,
+				Count:        *numRoutes,
+				Distribution: *routeDist,
+				ZipfExponent: *zipfExponent,
+				HotRoutes:    *hotRoutes,
+				HotTraffic:   *hotTraffic,
+			},
+		}
+		t.generator, err = newGenerator(*generatorName, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			usageAndExit()
+		}
+		if len(agentList) > 0 {
+			t.generator = &agent.Generator{
+				Agents:     agentList,
+				Generator:  *generatorName,
+				Config:     config,
+				Token:      *agentToken,
+				StartDelay: *agentStartDelay,
+				Client:     client,
+			}
+		}
+		if g, ok := t.generator.(*loadgen.HTTPGenerator); ok {
+			g.Observe = tracker.Record
+		}
+	}
+	var heyVersion string
+	if len(agentList) > 0 {
+		infos, err := (&agent.Generator{Agents: agentList, Token: *agentToken, Client: client}).Check(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		for i, info := range infos {
+			if info.Version != version {
+				fmt.Fprintf(os.Stderr, "Agent %s runs throughputramp %s, the coordinator %s\n", agent.Name(agentList[i]), info.Version, version)
+			}
+			if *generatorName == "hey" && info.HeyVersion != infos[0].HeyVersion {
+				fmt.Fprintf(os.Stderr, "Agent %s runs hey %s, agent %s hey %s\n", agent.Name(agentList[i]), info.HeyVersion, agent.Name(agentList[0]), infos[0].HeyVersion)
+			}
+		}
+		if *generatorName == "hey" {
+			heyVersion = infos[0].HeyVersion
+		}
+	} else if *generatorName == "hey" {
+		heyVersion = loadgen.HeyVersion()
 	}
-	fmt.Fprintf(os.Stdout, "csv uploaded to %s\n", loc)
 
-	if len(cpuCsv) != 0 {
-		cpuFilename = fmt.Sprintf("cpuStats-%s.csv", timeString)
+	slo := analysis.SLO{Percentile: *sloPercentile, Latency: *sloLatency}
+	if err := slo.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		usageAndExit()
+	}
 
-		loc, err := uploader.Upload(s3config, bytes.NewBuffer(cpuCsv), cpuFilename)
+	var monitor *cpumonitor.Client
+	if *cpuMonitorURL != "" {
+		monitor, err = cpumonitor.NewClient(*cpuMonitorURL)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "uploading to s3 error: %s\n", err)
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			usageAndExit()
 		}
-		fmt.Fprintf(os.Stdout, "cpu csv uploaded to %s\n", loc)
+		monitor.Timeout = *cpuTimeout
+		monitor.Retries = *cpuRetries
 	}
-}
 
-func writeFile(path string, data []byte) {
-	f, err := os.Create(path)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Creating csv file error: %s\n", err)
-		os.Exit(1)
+	base := loadgen.Step{
+		NumRequests: *numRequests,
+		Warmup:      *warmup,
 	}
-	_, err = f.Write(data)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Writing csv data to a file error: %s\n", err)
-		os.Exit(1)
+	if *stepDuration > 0 {
+		base.NumRequests = 0
+		base.Duration = *stepDuration
 	}
-	fmt.Fprintf(os.Stdout, "csv stored locally in file %s\n", path)
-}
-
-func runBenchmark(router,
-	host,
-	cpumonitorURL string,
-	numRequests,
-	lowerConcurrency,
-	upperConcurrency,
-	concurrencyStep,
-	threshold int,
-	uploaderConfig *uploader.Config) {
 
-	if cpumonitorURL != "" {
-		_, err := stopCPUMonitor(cpumonitorURL)
+	var steps []loadgen.Step
+	if *profilePath != "" {
+		steps, err = loadProfile(*profilePath)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Ignoring err in stopping CPU Monitor: %s\n", err)
-		}
-		if err = startCPUMonitor(cpumonitorURL); err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err)
-			os.Exit(1)
+			usageAndExit()
 		}
+	} else if *upperRate > 0 {
+		if *lowerRate < 1 {
+			fmt.Fprintf(os.Stderr, "-lower-rate must be at least 1\n")
+			usageAndExit()
+		}
+		base.Concurrency = *workers
+		steps = rateSteps(base, *lowerRate, *upperRate, *rateStep)
+	} else {
+		base.RateLimit = *threadRateLimit
+		steps = concurrencySteps(base, *lowerConcurrency, *upperConcurrency, *concurrencyStep)
+	}
+	if len(steps) == 0 {
+		fmt.Fprintf(os.Stderr, "ramp has no steps\n")
+		usageAndExit()
 	}
 
-	benchmarkData := new(bytes.Buffer)
-	for i := lowerConcurrency; i <= upperConcurrency; i += concurrencyStep {
-		heyData, benchmarkErr := run(router, host, numRequests, i, threshold)
-		if benchmarkErr != nil {
-			fmt.Fprintf(os.Stderr, "%s\n", benchmarkErr)
-			os.Exit(1)
+	stopConditions := analysis.StopConditions{
+		P99:           *stopP99,
+		ErrorRatio:    *stopErrorRatio,
+		ConnectErrors: *stopConnectErrs,
+	}
+
+	metadata := &data.RunMetadata{
+		ThroughputrampVersion: version,
+		GoVersion:             runtime.Version(),
+		HeyVersion:            heyVersion,
+		Generator:             *generatorName,
+		Router:                targets[0].url,
+		Host:                  *host,
+		RoutingReleaseVersion: *releaseVersion,
+		RouteTableSize:        *routeTableSize,
+		Flags:                 flagValues(),
+		Steps:                 data.NewStepMetadata(steps),
+	}
+	for _, a := range agentList {
+		metadata.Agents = append(metadata.Agents, agent.Name(a))
+	}
+	if monitor != nil {
+		metadata.CPUMonitor = &data.CPUMonitorConfig{
+			URL:               *cpuMonitorURL,
+			RunIntervalMillis: *cpuRunInterval,
+			PerCPU:            *cpuPerCPU,
 		}
+	}
+
+	if len(targets) > 1 {
+		metadata.TargetOrder = *targetOrder
+		for _, t := range targets {
+			metadata.Targets = append(metadata.Targets, data.TargetMetadata{Name: t.name, Router: t.url})
+		}
+	}
 
-		_, writeErr := benchmarkData.Write(heyData)
-		if benchmarkErr != nil {
-			fmt.Fprintf(os.Stderr, "Buffer error: %s\n", writeErr)
+	dir := *checkpointDir
+	var resumed *checkpoint.Checkpoint
+	if *resumeDir != "" {
+		if dir != "" {
+			fmt.Fprintf(os.Stderr, "-checkpoint-dir cannot be combined with -resume, which continues to checkpoint to its directory\n")
+			usageAndExit()
+		}
+		dir = *resumeDir
+		c, err := checkpoint.Read(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Reading checkpoint: %s\n", err)
 			os.Exit(1)
 		}
+		if c.Finished {
+			fmt.Fprintf(os.Stdout, "The run checkpointed to %s finished, starting a new run\n", dir)
+		} else {
+			if err := checkResume(c, targets, metadata.Steps); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				usageAndExit()
+			}
+			resumed = &c
+		}
 	}
 
-	var cpuCsv []byte
-	if cpumonitorURL != "" {
-		var err error
-		cpuCsv, err = stopCPUMonitor(cpumonitorURL)
+	if *progressAddr != "" {
+		listener, err := net.Listen("tcp", *progressAddr)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err)
 			os.Exit(1)
 		}
+		go func() {
+			if err := http.Serve(listener, progress.Handler(tracker)); err != nil {
+				fmt.Fprintf(os.Stderr, "Progress server: %s\n", err)
+			}
+		}()
 	}
 
-	if *localCSV != "" {
-		perfResult := filepath.Join(*localCSV, "perfResults.csv")
-		writeFile(perfResult, benchmarkData.Bytes())
+	runBenchmark(targets, monitor, steps, slo, stopConditions, metadata, sinks, dir, resumed)
+
+}
 
-		if len(cpuCsv) != 0 {
-			cpuResult := filepath.Join(*localCSV, "cpuStats.csv")
-			writeFile(cpuResult, cpuCsv)
+// buildVersion returns the module version or VCS revision the binary was
+// built from, or fallback if the go command recorded neither, as in GOPATH
+// builds.
+func buildVersion(fallback string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return fallback
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
 		}
 	}
-	uploadCSV(uploaderConfig, benchmarkData, cpuCsv)
+	return fallback
 }
 
-func run(router, host string, numRequests, concurrentRequests, rateLimit int) ([]byte, error) {
-	fmt.Fprintf(os.Stdout, "Running benchmark with %d requests, %d concurrency, and %d rate limit\n", numRequests, concurrentRequests, rateLimit)
-	args := []string{
-		"-host", host,
-		"-n", strconv.Itoa(numRequests),
-		"-c", strconv.Itoa(concurrentRequests),
-		"-q", strconv.Itoa(rateLimit),
-		"-o", "csv",
-		router,
-	}
+func flagValues() map[string]string {
+	values := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !secretFlags[f.Name] {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	return values
+}
 
-	heyData, err := exec.Command("hey", args...).Output()
+func loadProfile(path string) ([]loadgen.Step, error) {
+	p, err := profile.Load(path)
 	if err != nil {
-		return nil, fmt.Errorf("hey error: %s\nData:\n%s", err, string(heyData))
+		return nil, err
+	}
+	return p.Steps()
+}
+
+// checkResume checks that a checkpoint was written by a run of the same
+// steps against the same routers.
+func checkResume(c checkpoint.Checkpoint, targets []*target, steps []data.StepMetadata) error {
+	if !reflect.DeepEqual(c.Run.Steps, steps) {
+		return errors.New("the steps of the ramp do not match the checkpoint")
+	}
+	if len(c.Targets) != len(targets) {
+		return errors.New("the routers do not match the checkpoint")
+	}
+	for i, t := range targets {
+		if c.Targets[i].Name != t.name || c.Targets[i].URL != t.url {
+			return errors.New("the routers do not match the checkpoint")
+		}
 	}
-	return selectCSVColumns(string(heyData)), nil
+	return nil
 }
 
-func selectCSVColumns(heyData string) []byte {
-	const (
-		startTime    = 6
-		responseTime = 0
-	)
-	r := csv.NewReader(strings.NewReader(heyData))
+func concurrencySteps(base loadgen.Step, lower, upper, step int) []loadgen.Step {
+	var steps []loadgen.Step
+	for i := lower; i <= upper && step > 0; i += step {
+		s := base
+		s.Concurrency = i
+		steps = append(steps, s)
+	}
+	return steps
+}
 
-	records, err := r.ReadAll()
-	if err != nil {
-		fmt.Errorf("reading csv records %s", err)
+func rateSteps(base loadgen.Step, lower, upper, step int) []loadgen.Step {
+	var steps []loadgen.Step
+	for r := lower; r <= upper && step > 0; r += step {
+		s := base
+		s.Rate = r
+		steps = append(steps, s)
+	}
+	return steps
+}
+
+func newGenerator(name string, config loadgen.Config) (loadgen.Generator, error) {
+	switch name {
+	case "native":
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+		return loadgen.NewHTTPGenerator(config), nil
+	case "hey":
+		if config.Protocol != "" && config.Protocol != loadgen.ProtocolHTTP1 {
+			return nil, fmt.Errorf("the hey generator only supports %s", loadgen.ProtocolHTTP1)
+		}
+		return loadgen.NewHeyGenerator(config), nil
+	default:
+		return nil, fmt.Errorf("unknown generator %q", name)
 	}
-	if len(records) == 0 {
-		return nil
+}
+
+// clientTLSConfig reads the TLS flags. The certificates are passed on by
+// content, so that agents do not need the files.
+func clientTLSConfig() (loadgen.TLSConfig, error) {
+	config := loadgen.TLSConfig{
+		ServerName:        *tlsServerName,
+		SessionResumption: *tlsResumption,
+		MinVersion:        *tlsMinVersion,
+		MaxVersion:        *tlsMaxVersion,
 	}
-	var b bytes.Buffer
-	b.Write([]byte("start-time,response-time\n"))
-	for i := 1; i < len(records); i++ {
-		_, err = b.Write([]byte(fmt.Sprintf("%s,%s\n", records[i][startTime], records[i][responseTime])))
+	for _, f := range []struct {
+		path     string
+		contents *[]byte
+	}{
+		{*tlsCA, &config.CA},
+		{*tlsCert, &config.Cert},
+		{*tlsKey, &config.Key},
+	} {
+		if f.path == "" {
+			continue
+		}
+		contents, err := ioutil.ReadFile(f.path)
 		if err != nil {
-			fmt.Errorf("writing csv records %s", err)
+			return loadgen.TLSConfig{}, err
 		}
+		*f.contents = contents
 	}
-	return b.Bytes()
+	for _, name := range strings.Split(*tlsCiphers, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			config.CipherSuites = append(config.CipherSuites, name)
+		}
+	}
+	return config, nil
 }
 
-func usageAndExit() {
-	flag.Usage()
-	fmt.Fprintf(os.Stderr, "\n")
-	os.Exit(1)
+// requestTemplate reads the request flags. The body file is passed on by
+// content, so that agents do not need it.
+func requestTemplate() (loadgen.RequestTemplate, error) {
+	template := loadgen.RequestTemplate{
+		Method:      *method,
+		Header:      http.Header(requestHeaders),
+		Query:       url.Values(requestQuery),
+		Body:        []byte(*body),
+		BodyMinSize: *bodyMinSize,
+		BodyMaxSize: *bodyMaxSize,
+	}
+	if *bodyFile != "" {
+		if *body != "" {
+			return loadgen.RequestTemplate{}, errors.New("-body and -body-file cannot be combined")
+		}
+		contents, err := ioutil.ReadFile(*bodyFile)
+		if err != nil {
+			return loadgen.RequestTemplate{}, err
+		}
+		template.Body = contents
+	}
+	return template, nil
 }
 
-func startCPUMonitor(url string) error {
-	startURL := fmt.Sprintf("http://%s/start", url)
-	resp, err := http.Get(startURL)
-	if err != nil {
-		return fmt.Errorf("calling cpumonitor stop %s", err)
+// resultSinks returns the sinks selected by the flags. S3 is used when any
+// of its flags is set.
+func resultSinks() ([]sink.Sink, error) {
+	var sinks []sink.Sink
+	if *localCSV != "" {
+		sinks = append(sinks, &sink.Local{Dir: *localCSV})
+	}
+	if *s3Endpoint != "" || *s3Region != "" || *bucketName != "" || *accessKeyID != "" || *secretAccessKey != "" {
+		s3Config := &uploader.Config{
+			Endpoint:        *s3Endpoint,
+			AwsRegion:       *s3Region,
+			BucketName:      *bucketName,
+			AccessKeyID:     *accessKeyID,
+			SecretAccessKey: *secretAccessKey,
+		}
+		if err := s3Config.Validate(); err != nil {
+			return nil, fmt.Errorf("s3 config error: %s", err)
+		}
+		sinks = append(sinks, &sink.S3{Config: s3Config})
+	}
+	if *putURL != "" {
+		sinks = append(sinks, &sink.HTTP{URL: *putURL, Header: http.Header(putHeaders)})
+	}
+	if *toStdout {
+		sinks = append(sinks, &sink.Writer{W: os.Stdout})
+	}
+	if len(sinks) == 0 {
+		return nil, errors.New("no result destination: set -local-csv, -put-url, -stdout or the S3 flags")
+	}
+	return sinks, nil
+}
+
+// storeResults puts every file into every sink and reports whether all of
+// them were stored.
+func storeResults(sinks []sink.Sink, files []sink.File) bool {
+	ok := true
+	for _, s := range sinks {
+		for _, f := range files {
+			loc, err := s.Put(f)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "storing %s error: %s\n", f.Name, err)
+				ok = false
+				continue
+			}
+			fmt.Fprintf(os.Stdout, "%s stored in %s\n", f.Name, loc)
+		}
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received resp %d", resp.StatusCode)
+	return ok
+}
+
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	var headers []string
+	for name, values := range h {
+		for _, v := range values {
+			headers = append(headers, name+": "+v)
+		}
 	}
+	return strings.Join(headers, ", ")
+}
 
+func (h headerFlag) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("header %q is not of the form 'Name: value'", value)
+	}
+	http.Header(h).Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
 	return nil
 }
 
-func stopCPUMonitor(url string) ([]byte, error) {
-	startURL := fmt.Sprintf("http://%s/stop", url)
-	resp, err := http.Get(startURL)
-	if err != nil {
-		return nil, fmt.Errorf("calling cpumonitor stop %s", err)
+type queryFlag url.Values
+
+func (q queryFlag) String() string {
+	return url.Values(q).Encode()
+}
+
+func (q queryFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("query parameter %q is not of the form 'name=value'", value)
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received resp %d", resp.StatusCode)
+	url.Values(q).Add(parts[0], parts[1])
+	return nil
+}
+
+func runBenchmark(targets []*target,
+	monitor *cpumonitor.Client,
+	steps []loadgen.Step,
+	slo analysis.SLO,
+	stopConditions analysis.StopConditions,
+	metadata *data.RunMetadata,
+	sinks []sink.Sink,
+	checkpointDir string,
+	resumed *checkpoint.Checkpoint) {
+
+	// The first signal interrupts the running step and the results collected
+	// so far are stored. A second one ends the process right away.
+	ctx, interrupt := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		fmt.Fprintf(os.Stderr, "Received %s, storing the results collected so far\n", sig)
+		interrupt(fmt.Errorf("interrupted by %s", sig))
+	}()
+
+	first := 0
+	if resumed != nil {
+		*metadata = resumed.Run
+		metadata.ResumedAt = append(metadata.ResumedAt, time.Now().UTC())
+		first = resumed.Completed
+	} else {
+		metadata.StartTime = time.Now().UTC()
+	}
+	// A flaky cpumonitor only costs the CPU stats, never the results.
+	if monitor != nil {
+		if _, err := monitor.Stop(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Ignoring err in stopping CPU Monitor: %s\n", err)
+		}
+		if err := monitor.Start(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Ignoring err in starting CPU Monitor, the results will not include CPU stats: %s\n", err)
+			monitor = nil
+		}
 	}
 
-	rawData, err := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
+	for i, t := range targets {
+		if err := t.start(metadata.StartTime, time.Duration(*interval)*time.Second); err != nil {
+			fmt.Fprintf(os.Stderr, "Buffer error: %s\n", err)
+			os.Exit(1)
+		}
+		if resumed != nil {
+			if err := t.restore(checkpointDir, resumed.Targets[i]); err != nil {
+				fmt.Fprintf(os.Stderr, "Reading checkpoint: %s\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+	if resumed != nil {
+		fmt.Fprintf(os.Stdout, "Resuming after step %d of %d\n", first, len(steps))
+	}
+	writeCheckpoint(checkpointDir, first, targets, *metadata, false)
+	// Only the native generator passes its samples to the tracker as it goes.
+	_, live := targets[0].generator.(*loadgen.HTTPGenerator)
+	tracker.Start(len(steps), live)
+	if *progressInterval > 0 {
+		ticker := time.NewTicker(*progressInterval)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				fmt.Fprintf(os.Stdout, "Progress: %s\n", tracker.Status())
+			}
+		}()
+	}
+	interrupted := 0
+ramp:
+	for i := first; i < len(steps); i++ {
+		step := steps[i]
+		for _, t := range order(targets, i, *targetOrder) {
+			tracker.StartStep(t.name, i+1, step)
+			result, err := run(ctx, t, step)
+			if ctx.Err() != nil {
+				interrupted = i + 1
+				// The requests sent before the interruption are kept but
+				// not checkpointed, so that a resumed run repeats the step.
+				if result.Requests > 0 {
+					if _, err := t.record(i+1, result, true); err != nil {
+						fmt.Fprintf(os.Stderr, "Buffer error: %s\n", err)
+						os.Exit(1)
+					}
+				}
+				break ramp
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s%s\n", t.label(), err)
+				t.err = err
+				t.stop(fmt.Sprintf("step %d failed: %s", i+1, err))
+				continue
+			}
+
+			stepSummary, err := t.record(i+1, result, false)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Buffer error: %s\n", err)
+				os.Exit(1)
+			}
+			tracker.EndStep(stepSummary)
+			if checkpointDir != "" {
+				if err := t.persist(checkpointDir, i+1); err != nil {
+					fmt.Fprintf(os.Stderr, "Ignoring err in writing checkpoint: %s\n", err)
+				}
+			}
+			if reason := stopConditions.Check(stepSummary); reason != "" {
+				fmt.Fprintf(os.Stdout, "%sEnding ramp early: %s\n", t.label(), reason)
+				t.stop(reason)
+			}
+		}
+		writeCheckpoint(checkpointDir, i+1, targets, *metadata, false)
+	}
+	if interrupted > 0 {
+		reason := fmt.Sprintf("%s during step %d", context.Cause(ctx), interrupted)
+		metadata.Incomplete = true
+		for _, t := range targets {
+			if !t.done {
+				t.stop(reason)
+			}
+		}
+	}
 
-	csvData, err := data.GenerateCpuCSV(rawData)
-	if err != nil {
-		return nil, fmt.Errorf("GeneratateCpuCSV %d", resp.StatusCode)
+	tracker.Finish()
+
+	var cpuCsv []byte
+	if monitor != nil {
+		samples, err := monitor.Stop(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ignoring err in stopping CPU Monitor, the results will not include CPU stats: %s\n", err)
+		}
+		cpuCsv = data.CPUStatsCSV(samples)
 	}
 
-	return csvData, nil
+	metadata.EndTime = time.Now().UTC()
+	failed := false
+	var files []sink.File
+	for _, t := range targets {
+		targetFiles, err := t.files(slo, *metadata, cpuCsv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		files = append(files, targetFiles...)
+		failed = failed || t.err != nil
+	}
+	stored := storeResults(sinks, files)
+	if stored && interrupted == 0 {
+		writeCheckpoint(checkpointDir, len(steps), targets, *metadata, true)
+	}
+
+	if failed || !stored || interrupted > 0 {
+		os.Exit(1)
+	}
+}
+
+// writeCheckpoint records the first completed steps of the run to dir, if
+// set, and whether its results were stored. Runs continue when the
+// checkpoint cannot be written.
+func writeCheckpoint(dir string, completed int, targets []*target, metadata data.RunMetadata, finished bool) {
+	if dir == "" {
+		return
+	}
+	c := checkpoint.Checkpoint{Run: metadata, Completed: completed, Finished: finished}
+	for _, t := range targets {
+		c.Targets = append(c.Targets, t.state())
+	}
+	if err := checkpoint.Write(dir, c); err != nil {
+		fmt.Fprintf(os.Stderr, "Ignoring err in writing checkpoint: %s\n", err)
+	}
+}
+
+func run(ctx context.Context, t *target, step loadgen.Step) (loadgen.Result, error) {
+	if t.name == "" {
+		fmt.Fprintf(os.Stdout, "Running benchmark with %s\n", step)
+	} else {
+		fmt.Fprintf(os.Stdout, "Running benchmark against %s with %s\n", t.name, step)
+	}
+	return t.generator.Run(ctx, step)
+}
+
+func usageAndExit() {
+	flag.Usage()
+	fmt.Fprintf(os.Stderr, "\n")
+	os.Exit(1)
 }
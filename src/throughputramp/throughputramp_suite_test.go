@@ -31,12 +31,30 @@ type Args struct {
 	ConcurrencyStep  int
 	Host             string
 	Router           string
+	MoreRouters      []string
 	Endpoint         string
 	BucketName       string
 	AccessKeyID      string
 	SecretAccessKey  string
 	CPUMonitorURL    string
+	CPUMonitorRetry  string
 	localCSV         string
+	LowerRate        int
+	UpperRate        int
+	RateStep         int
+	Profile          string
+	Duration         string
+	Warmup           string
+	SLOLatency       string
+	StopP99          string
+	Generator        string
+	PutURL           string
+	Stdout           bool
+	Samples          bool
+	TargetOrder      string
+	ProgressInterval string
+	CheckpointDir    string
+	Resume           string
 }
 
 func (args Args) ArgSlice() []string {
@@ -54,9 +72,58 @@ func (args Args) ArgSlice() []string {
 		"-cpumonitor-url", args.CPUMonitorURL,
 		"-local-csv", args.localCSV,
 	}
+	if args.CPUMonitorRetry != "" {
+		argSlice = append(argSlice, "-cpumonitor-retries", args.CPUMonitorRetry)
+	}
+	if args.Duration != "" {
+		argSlice = append(argSlice, "-duration", args.Duration)
+	}
+	if args.Warmup != "" {
+		argSlice = append(argSlice, "-warmup", args.Warmup)
+	}
+	if args.SLOLatency != "" {
+		argSlice = append(argSlice, "-slo-latency", args.SLOLatency)
+	}
+	if args.StopP99 != "" {
+		argSlice = append(argSlice, "-stop-p99", args.StopP99)
+	}
+	if args.Generator != "" {
+		argSlice = append(argSlice, "-generator", args.Generator)
+	}
+	if args.PutURL != "" {
+		argSlice = append(argSlice, "-put-url", args.PutURL, "-put-header", "Authorization: Bearer token")
+	}
+	if args.Samples {
+		argSlice = append(argSlice, "-samples")
+	}
+	if args.Stdout {
+		argSlice = append(argSlice, "-stdout")
+	}
+	if args.Profile != "" {
+		argSlice = append(argSlice, "-profile", args.Profile)
+	}
+	if args.TargetOrder != "" {
+		argSlice = append(argSlice, "-target-order", args.TargetOrder)
+	}
+	if args.CheckpointDir != "" {
+		argSlice = append(argSlice, "-checkpoint-dir", args.CheckpointDir)
+	}
+	if args.Resume != "" {
+		argSlice = append(argSlice, "-resume", args.Resume)
+	}
+	if args.ProgressInterval != "" {
+		argSlice = append(argSlice, "-progress-interval", args.ProgressInterval)
+	}
+	if args.UpperRate > 0 {
+		argSlice = append(argSlice,
+			"-lower-rate", strconv.Itoa(args.LowerRate),
+			"-upper-rate", strconv.Itoa(args.UpperRate),
+			"-rate-step", strconv.Itoa(args.RateStep),
+		)
+	}
 
 	argSlice = append(argSlice, args.Router)
-	return argSlice
+	return append(argSlice, args.MoreRouters...)
 }
 
 func TestThroughputramp(t *testing.T) {
@@ -66,7 +133,7 @@ func TestThroughputramp(t *testing.T) {
 
 var _ = BeforeSuite(func() {
 	var err error
-	binPath, err = gexec.Build("throughputramp", "-race")
+	binPath, err = gexec.Build("throughputramp", "-race", "-ldflags", "-X main.version=1.2.3")
 	Expect(err).NotTo(HaveOccurred())
 })
 
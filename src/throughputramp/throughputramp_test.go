@@ -1,11 +1,19 @@
 package main_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
+
+	"throughputramp/analysis"
+	"throughputramp/checkpoint"
+	"throughputramp/data"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -45,7 +53,7 @@ var _ = Describe("Throughputramp", func() {
 			testServer.AllowUnhandledRequests = true
 			testServer.Start()
 
-			bodyChan = make(chan []byte, 3)
+			bodyChan = make(chan []byte, 9)
 
 			testS3Server = ghttp.NewServer()
 
@@ -62,6 +70,12 @@ var _ = Describe("Throughputramp", func() {
 			)
 			testS3Server.AppendHandlers(
 				bodyTestHandler,
+				bodyTestHandler,
+				bodyTestHandler,
+				bodyTestHandler,
+				bodyTestHandler,
+				bodyTestHandler,
+				bodyTestHandler,
 			)
 
 			runnerArgs = Args{
@@ -76,6 +90,7 @@ var _ = Describe("Throughputramp", func() {
 				Endpoint:         testS3Server.URL(),
 				AccessKeyID:      "ABCD",
 				SecretAccessKey:  "ABCD",
+				Samples:          true,
 			}
 		})
 
@@ -97,6 +112,197 @@ var _ = Describe("Throughputramp", func() {
 			Expect(testServer.ReceivedRequests()).To(HaveLen(24))
 		})
 
+		Context("when a latency SLO is specified", func() {
+			BeforeEach(func() {
+				runnerArgs.SLOLatency = "10s"
+			})
+
+			It("reports the knee and uploads a machine-readable summary", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+				Expect(runner).To(gbytes.Say(`knee at step \d \(concurrency \d, rate 0\)`))
+
+				var summaryBytes []byte
+				Eventually(bodyChan).Should(Receive())
+				Eventually(bodyChan).Should(Receive())
+				Eventually(bodyChan).Should(Receive(&summaryBytes))
+				Expect(string(summaryBytes)).To(ContainSubstring(`"knee": {`))
+				Expect(string(summaryBytes)).To(ContainSubstring(`"latency_ms": 10000`))
+			})
+		})
+
+		Context("when a stop condition is met", func() {
+			BeforeEach(func() {
+				runnerArgs.StopP99 = "1ns"
+			})
+
+			It("ends the ramp early and still uploads the results", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+				Expect(testServer.ReceivedRequests()).To(HaveLen(12))
+				Expect(runner).To(gbytes.Say(`Ending ramp early: step 1 p99 latency [\d.]+ms is above 1ns`))
+
+				var summaryBytes []byte
+				Eventually(bodyChan).Should(Receive())
+				Eventually(bodyChan).Should(Receive())
+				Eventually(bodyChan).Should(Receive(&summaryBytes))
+				Expect(string(summaryBytes)).To(ContainSubstring(`"stop_reason": "step 1 p99 latency`))
+			})
+		})
+
+		Context("when a step fails", func() {
+			BeforeEach(func() {
+				runnerArgs.Generator = "hey"
+				runnerArgs.LowerRate = 50
+				runnerArgs.UpperRate = 100
+				runnerArgs.RateStep = 50
+			})
+
+			It("uploads what was collected and exits 1", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(1))
+				Expect(runner.Err()).To(gbytes.Say("hey does not support open-loop rate steps"))
+
+				var csvBytes []byte
+				Eventually(bodyChan).Should(Receive(&csvBytes))
+				Expect(string(csvBytes)).To(BeEmpty())
+				Eventually(bodyChan).Should(Receive())
+
+				var summaryBytes []byte
+				Eventually(bodyChan).Should(Receive(&summaryBytes))
+				Expect(string(summaryBytes)).To(ContainSubstring(`"stop_reason": "step 1 failed: hey does not support open-loop rate steps"`))
+			})
+		})
+
+		Context("when a step duration is specified", func() {
+			BeforeEach(func() {
+				runnerArgs.Duration = "200ms"
+				runnerArgs.Warmup = "100ms"
+			})
+
+			It("runs each step for that duration and records the step boundaries", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+				Expect(runner).To(gbytes.Say("200ms of requests, 2 concurrency"))
+				Expect(runner).To(gbytes.Say("200ms of requests, 4 concurrency"))
+
+				var stepCsvBytes []byte
+				Eventually(bodyChan).Should(Receive())
+				Eventually(bodyChan).Should(Receive(&stepCsvBytes))
+				b := gbytes.BufferWithBytes(stepCsvBytes)
+				Expect(b).To(gbytes.Say(`step,start-time,end-time,concurrency,rate-limit,rate,warmup,requests,`))
+				Expect(b).To(gbytes.Say(`\n1,[^,]+,[^,]+,2,100,0,0.100000,`))
+				Expect(b).To(gbytes.Say(`\n2,[^,]+,[^,]+,4,100,0,0.100000,`))
+			})
+		})
+
+		Context("when a progress interval is specified", func() {
+			BeforeEach(func() {
+				runnerArgs.Duration = "300ms"
+				runnerArgs.ProgressInterval = "100ms"
+			})
+
+			It("prints the progress while the steps run", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+				Expect(runner).To(gbytes.Say(`Progress: step 1/2, \d+s elapsed, [\d.]+ requests per second, p50 [\d.]+ms, p99 [\d.]+ms, \d+ requests, 0 errors, \d+ non-2xx`))
+				Expect(runner).To(gbytes.Say(`Progress: step 2/2`))
+			})
+		})
+
+		Context("when the run is interrupted", func() {
+			BeforeEach(func() {
+				runnerArgs.Duration = "500ms"
+			})
+
+			It("stores the steps so far and marks the run and the interrupted step as incomplete", func() {
+				Eventually(runner, "5s").Should(gbytes.Say("500ms of requests, 4 concurrency"))
+				time.Sleep(200 * time.Millisecond)
+				process.Signal(syscall.SIGTERM)
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(1))
+				Expect(runner.Err()).To(gbytes.Say("Received terminated, storing the results collected so far"))
+
+				var stepCsvBytes, summaryBytes, runBytes []byte
+				Eventually(bodyChan).Should(Receive())
+				Eventually(bodyChan).Should(Receive(&stepCsvBytes))
+				Eventually(bodyChan).Should(Receive(&summaryBytes))
+				Eventually(bodyChan).Should(Receive(&runBytes))
+				stepRows := strings.Split(strings.TrimSpace(string(stepCsvBytes)), "\n")
+				Expect(stepRows).To(HaveLen(3))
+				Expect(stepRows[1]).To(MatchRegexp(`^1,.*,false$`))
+				Expect(stepRows[2]).To(MatchRegexp(`^2,.*,true$`))
+
+				var summary analysis.Summary
+				Expect(json.Unmarshal(summaryBytes, &summary)).To(Succeed())
+				Expect(summary.Incomplete).To(BeTrue())
+				Expect(summary.StopReason).To(Equal("interrupted by terminated during step 2"))
+				Expect(summary.Steps).To(HaveLen(2))
+				Expect(summary.Steps[0].Incomplete).To(BeFalse())
+				Expect(summary.Steps[1].Incomplete).To(BeTrue())
+				Expect(summary.Steps[1].Concurrency).To(Equal(4))
+				Expect(summary.Steps[1].Requests).To(BeNumerically(">", 0))
+				Expect(summary.Steps[1].End.Sub(summary.Steps[1].Start)).To(BeNumerically("<", 500*time.Millisecond))
+
+				var metadata data.RunMetadata
+				Expect(json.Unmarshal(runBytes, &metadata)).To(Succeed())
+				Expect(metadata.Incomplete).To(BeTrue())
+			})
+		})
+
+		Context("when a request rate ramp is specified", func() {
+			BeforeEach(func() {
+				runnerArgs.LowerRate = 50
+				runnerArgs.UpperRate = 150
+				runnerArgs.RateStep = 50
+			})
+
+			It("runs one open-loop step per rate", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+				Expect(testServer.ReceivedRequests()).To(HaveLen(36))
+				Expect(runner).To(gbytes.Say("12 requests at 50 requests per second"))
+				Expect(runner).To(gbytes.Say("12 requests at 100 requests per second"))
+				Expect(runner).To(gbytes.Say("12 requests at 150 requests per second"))
+			})
+		})
+
+		Context("when a profile is specified", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "profile")
+				Expect(err).NotTo(HaveOccurred())
+				runnerArgs.Profile = filepath.Join(dir, "profile.yml")
+				Expect(ioutil.WriteFile(runnerArgs.Profile, []byte(`
+stages:
+- type: step
+  from: 1
+  to: 2
+  by: 1
+  requests: 4
+- type: hold
+  unit: rate
+  level: 20
+  requests: 5
+`), 0644)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(dir)).To(Succeed())
+			})
+
+			It("runs the steps of the profile instead of the concurrency ramp", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+				Expect(testServer.ReceivedRequests()).To(HaveLen(13))
+				Expect(runner).To(gbytes.Say("4 requests, 1 concurrency"))
+				Expect(runner).To(gbytes.Say("4 requests, 2 concurrency"))
+				Expect(runner).To(gbytes.Say("5 requests at 20 requests per second"))
+			})
+		})
+
 		Context("when local-csv is specified", func() {
 			var dir string
 			BeforeEach(func() {
@@ -130,6 +336,8 @@ var _ = Describe("Throughputramp", func() {
 				)
 			})
 			It("stores the csv locally", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
 
 				checkFiles := func() int {
 					files, err := ioutil.ReadDir(dir)
@@ -143,9 +351,126 @@ var _ = Describe("Throughputramp", func() {
 					}
 					return fileCount
 				}
-				Eventually(checkFiles).Should(Equal(2))
+				Eventually(checkFiles).Should(Equal(4))
+				Eventually(filepath.Join(dir, "run.json")).Should(BeAnExistingFile())
+				Eventually(filepath.Join(dir, "report.html")).Should(BeAnExistingFile())
+				Expect(os.RemoveAll(dir)).To(Succeed())
+			})
+		})
+
+		Context("when a checkpoint directory is specified", func() {
+			var dir, resultsDir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "checkpoint")
+				Expect(err).NotTo(HaveOccurred())
+				resultsDir = filepath.Join(dir, "results")
+				runnerArgs.Endpoint = ""
+				runnerArgs.BucketName = ""
+				runnerArgs.AccessKeyID = ""
+				runnerArgs.SecretAccessKey = ""
+				runnerArgs.localCSV = resultsDir
+				runnerArgs.CheckpointDir = filepath.Join(dir, "checkpoint")
+			})
+
+			AfterEach(func() {
 				Expect(os.RemoveAll(dir)).To(Succeed())
 			})
+
+			It("persists every completed step", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+
+				c, err := checkpoint.Read(runnerArgs.CheckpointDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.Completed).To(Equal(2))
+				Expect(c.Targets).To(HaveLen(1))
+				Expect(c.Targets[0].Steps).To(HaveLen(2))
+				Expect(filepath.Join(runnerArgs.CheckpointDir, "step-1", "perfResults.csv")).To(BeAnExistingFile())
+				Expect(filepath.Join(runnerArgs.CheckpointDir, "step-2", "latency.hlog")).To(BeAnExistingFile())
+			})
+
+			It("continues an interrupted run after its last completed step", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+				original, err := ioutil.ReadFile(filepath.Join(resultsDir, "steps.csv"))
+				Expect(err).NotTo(HaveOccurred())
+
+				c, err := checkpoint.Read(runnerArgs.CheckpointDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.Finished).To(BeTrue())
+				c.Completed = 1
+				c.Targets[0].Steps = c.Targets[0].Steps[:1]
+				c.Finished = false
+				Expect(checkpoint.Write(runnerArgs.CheckpointDir, c)).To(Succeed())
+				Expect(os.RemoveAll(resultsDir)).To(Succeed())
+
+				resumeArgs := runnerArgs
+				resumeArgs.CheckpointDir = ""
+				resumeArgs.Resume = runnerArgs.CheckpointDir
+				resumeRunner := NewThroughputRamp(binPath, resumeArgs)
+				resumeProcess := ifrit.Background(resumeRunner)
+				Eventually(resumeProcess.Wait(), "5s").Should(Receive())
+				Expect(resumeRunner.ExitCode()).To(Equal(0))
+				Expect(resumeRunner).To(gbytes.Say("Resuming after step 1 of 2"))
+				Expect(resumeRunner).To(gbytes.Say("Running benchmark with 12 requests, 4 concurrency"))
+				Expect(resumeRunner.Buffer().Contents()).NotTo(ContainSubstring("2 concurrency"))
+				Expect(testServer.ReceivedRequests()).To(HaveLen(36))
+
+				steps, err := ioutil.ReadFile(filepath.Join(resultsDir, "steps.csv"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(strings.Split(string(steps), "\n")[:2]).To(Equal(strings.Split(string(original), "\n")[:2]))
+				Expect(string(steps)).To(MatchRegexp(`\n2,[^,]+,[^,]+,4,`))
+
+				samples, err := ioutil.ReadFile(filepath.Join(resultsDir, "perfResults.csv"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(strings.Count(string(samples), "step,concurrency")).To(Equal(1))
+				Expect(strings.Count(string(samples), "\n1,2,100,")).To(Equal(12))
+				Expect(strings.Count(string(samples), "\n2,4,100,")).To(Equal(12))
+
+				latencyLog, err := ioutil.ReadFile(filepath.Join(resultsDir, "latency.hlog"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(latencyLog)).To(MatchRegexp(`(?s)^#\[Histogram log.*\nTag=step-1,.*\nTag=step-2,`))
+
+				runJSON, err := ioutil.ReadFile(filepath.Join(resultsDir, "run.json"))
+				Expect(err).NotTo(HaveOccurred())
+				var metadata data.RunMetadata
+				Expect(json.Unmarshal(runJSON, &metadata)).To(Succeed())
+				Expect(metadata.StartTime).To(Equal(c.Run.StartTime))
+				Expect(metadata.ResumedAt).To(HaveLen(1))
+			})
+
+			It("starts a new run when resuming a run that finished", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+
+				resumeArgs := runnerArgs
+				resumeArgs.CheckpointDir = ""
+				resumeArgs.Resume = runnerArgs.CheckpointDir
+				for i := 0; i < 2; i++ {
+					Expect(os.RemoveAll(resultsDir)).To(Succeed())
+					resumeRunner := NewThroughputRamp(binPath, resumeArgs)
+					resumeProcess := ifrit.Background(resumeRunner)
+					Eventually(resumeProcess.Wait(), "5s").Should(Receive())
+					Expect(resumeRunner.ExitCode()).To(Equal(0))
+					Expect(resumeRunner).To(gbytes.Say("starting a new run"))
+					Expect(resumeRunner.Buffer().Contents()).NotTo(ContainSubstring("Resuming"))
+					Expect(resumeRunner).To(gbytes.Say("Running benchmark with 12 requests, 2 concurrency"))
+
+					runJSON, err := ioutil.ReadFile(filepath.Join(resultsDir, "run.json"))
+					Expect(err).NotTo(HaveOccurred())
+					var metadata data.RunMetadata
+					Expect(json.Unmarshal(runJSON, &metadata)).To(Succeed())
+					Expect(metadata.ResumedAt).To(BeEmpty())
+
+					c, err := checkpoint.Read(runnerArgs.CheckpointDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(c.Finished).To(BeTrue())
+					Expect(c.Completed).To(Equal(2))
+				}
+				Expect(testServer.ReceivedRequests()).To(HaveLen(72))
+			})
 		})
 
 		Context("when cpu monitor server is configured", func() {
@@ -203,6 +528,235 @@ var _ = Describe("Throughputramp", func() {
 			})
 		})
 
+		Context("when the cpumonitor fails", func() {
+			var cpumonitorServer *ghttp.Server
+
+			BeforeEach(func() {
+				cpumonitorServer = ghttp.NewServer()
+				cpumonitorServer.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/stop"),
+						ghttp.RespondWith(http.StatusBadRequest, "collector not running"),
+					),
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/start"),
+						ghttp.RespondWith(http.StatusOK, nil),
+					),
+					ghttp.RespondWith(http.StatusInternalServerError, nil),
+					ghttp.RespondWith(http.StatusInternalServerError, nil),
+				)
+				runnerArgs.CPUMonitorURL = cpumonitorServer.URL()
+				runnerArgs.CPUMonitorRetry = "1"
+			})
+
+			AfterEach(func() {
+				cpumonitorServer.Close()
+			})
+
+			It("retries and stores the results without CPU stats", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+				Expect(cpumonitorServer.ReceivedRequests()).To(HaveLen(4))
+				Expect(runner.Err()).To(gbytes.Say("Ignoring err in stopping CPU Monitor: cpumonitor stop: 400 Bad Request: collector not running"))
+				Expect(runner.Err()).To(gbytes.Say("Ignoring err in stopping CPU Monitor, the results will not include CPU stats: cpumonitor stop: 500 Internal Server Error, giving up after 2 attempts"))
+
+				var stepCsvBytes []byte
+				Eventually(bodyChan).Should(Receive())
+				Eventually(bodyChan).Should(Receive(&stepCsvBytes))
+				Expect(string(stepCsvBytes)).To(HavePrefix("step,start-time"))
+			})
+		})
+
+		Context("when several routers are given", func() {
+			var (
+				otherServer *ghttp.Server
+				dir         string
+			)
+
+			BeforeEach(func() {
+				otherServer = ghttp.NewServer()
+				otherServer.AllowUnhandledRequests = true
+				var err error
+				dir, err = ioutil.TempDir("", "targets")
+				Expect(err).NotTo(HaveOccurred())
+
+				runnerArgs.Router = "a=" + testServer.URL()
+				runnerArgs.MoreRouters = []string{"b=" + otherServer.URL()}
+				runnerArgs.Endpoint = ""
+				runnerArgs.BucketName = ""
+				runnerArgs.AccessKeyID = ""
+				runnerArgs.SecretAccessKey = ""
+				runnerArgs.localCSV = dir
+			})
+
+			AfterEach(func() {
+				otherServer.Close()
+				Expect(os.RemoveAll(dir)).To(Succeed())
+			})
+
+			It("alternates the steps across the routers and stores a dataset per router", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+				Expect(testServer.ReceivedRequests()).To(HaveLen(24))
+				Expect(otherServer.ReceivedRequests()).To(HaveLen(24))
+
+				Expect(runner).To(gbytes.Say("Running benchmark against a with 12 requests, 2 concurrency"))
+				Expect(runner).To(gbytes.Say("Running benchmark against b with 12 requests, 2 concurrency"))
+				Expect(runner).To(gbytes.Say("Running benchmark against b with 12 requests, 4 concurrency"))
+				Expect(runner).To(gbytes.Say("Running benchmark against a with 12 requests, 4 concurrency"))
+				Expect(runner).To(gbytes.Say("a: knee at step 2"))
+				Expect(runner).To(gbytes.Say("b: knee at step 2"))
+
+				for _, name := range []string{"a", "b"} {
+					for _, file := range []string{"perfResults.csv", "steps.csv", "summary.json", "latency.hlog", "throughput.csv", "report.html"} {
+						Expect(filepath.Join(dir, name, file)).To(BeAnExistingFile())
+					}
+				}
+				runJSON, err := ioutil.ReadFile(filepath.Join(dir, "b", "run.json"))
+				Expect(err).NotTo(HaveOccurred())
+				var metadata data.RunMetadata
+				Expect(json.Unmarshal(runJSON, &metadata)).To(Succeed())
+				Expect(metadata.Router).To(Equal(otherServer.URL()))
+				Expect(metadata.Target).To(Equal("b"))
+				Expect(metadata.TargetOrder).To(Equal("alternate"))
+				Expect(metadata.Targets).To(Equal([]data.TargetMetadata{
+					{Name: "a", Router: testServer.URL()},
+					{Name: "b", Router: otherServer.URL()},
+				}))
+			})
+
+			Context("in a fixed order", func() {
+				BeforeEach(func() {
+					runnerArgs.TargetOrder = "fixed"
+				})
+
+				It("runs every step against the routers in the given order", func() {
+					Eventually(process.Wait(), "5s").Should(Receive())
+					Expect(runner.ExitCode()).To(Equal(0))
+					Expect(runner).To(gbytes.Say("Running benchmark against a with 12 requests, 2 concurrency"))
+					Expect(runner).To(gbytes.Say("Running benchmark against b with 12 requests, 2 concurrency"))
+					Expect(runner).To(gbytes.Say("Running benchmark against a with 12 requests, 4 concurrency"))
+					Expect(runner).To(gbytes.Say("Running benchmark against b with 12 requests, 4 concurrency"))
+				})
+			})
+
+			Context("when the routers are not named", func() {
+				BeforeEach(func() {
+					runnerArgs.Router = testServer.URL()
+					runnerArgs.MoreRouters = []string{otherServer.URL()}
+				})
+
+				It("names them by position", func() {
+					Eventually(process.Wait(), "5s").Should(Receive())
+					Expect(runner.ExitCode()).To(Equal(0))
+					Expect(filepath.Join(dir, "target-1", "summary.json")).To(BeAnExistingFile())
+					Expect(filepath.Join(dir, "target-2", "summary.json")).To(BeAnExistingFile())
+				})
+			})
+		})
+
+		Context("when S3 is not configured", func() {
+			var putServer *ghttp.Server
+
+			BeforeEach(func() {
+				putServer = ghttp.NewServer()
+				putServer.AppendHandlers(
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token"),
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token"),
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token"),
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token"),
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token"),
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token"),
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token"),
+				)
+				runnerArgs.Endpoint = ""
+				runnerArgs.BucketName = ""
+				runnerArgs.AccessKeyID = ""
+				runnerArgs.SecretAccessKey = ""
+				runnerArgs.PutURL = putServer.URL() + "/results"
+				runnerArgs.Stdout = true
+			})
+
+			AfterEach(func() {
+				putServer.Close()
+			})
+
+			It("stores the results in the other destinations", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+				Expect(testS3Server.ReceivedRequests()).To(BeEmpty())
+				Expect(putServer.ReceivedRequests()).To(HaveLen(7))
+				Expect(putServer.ReceivedRequests()[0].URL.Path).To(MatchRegexp(`^/results/[^/]+\.csv$`))
+				Expect(runner).To(gbytes.Say(`==> steps.csv <==\nstep,start-time`))
+				Expect(runner).To(gbytes.Say(`==> run.json <==`))
+			})
+		})
+
+		Context("when raw samples are not requested", func() {
+			BeforeEach(func() {
+				runnerArgs.Samples = false
+			})
+
+			It("uploads the latency histograms instead of every request", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+
+				var stepCsvBytes, latencyBytes []byte
+				Eventually(bodyChan).Should(Receive(&stepCsvBytes))
+				Expect(string(stepCsvBytes)).To(HavePrefix("step,start-time"))
+				Eventually(bodyChan).Should(Receive())
+				Eventually(bodyChan).Should(Receive())
+				Eventually(bodyChan).Should(Receive(&latencyBytes))
+
+				b := gbytes.BufferWithBytes(latencyBytes)
+				Expect(b).To(gbytes.Say(`#\[Histogram log format version 1.3\]\n`))
+				Expect(b).To(gbytes.Say(`\nTag=step-1,[\d.]+,[\d.]+,[\d.]+,HISTFAAA`))
+				Expect(b).To(gbytes.Say(`\nTag=step-2,[\d.]+,[\d.]+,[\d.]+,HISTFAAA`))
+			})
+
+			It("uploads the throughput over time and an HTML report", func() {
+				Eventually(process.Wait(), "5s").Should(Receive())
+				Expect(runner.ExitCode()).To(Equal(0))
+
+				var throughputBytes, reportBytes []byte
+				for i := 0; i < 4; i++ {
+					Eventually(bodyChan).Should(Receive())
+				}
+				Eventually(bodyChan).Should(Receive(&throughputBytes))
+				Eventually(bodyChan).Should(Receive(&reportBytes))
+
+				Expect(string(throughputBytes)).To(MatchRegexp(`^step,start-time,throughput\n1,[^,]+,[\d.]+\n`))
+				Expect(string(throughputBytes)).To(MatchRegexp(`\n2,[^,]+,[\d.]+\n$`))
+				Expect(string(reportBytes)).To(HavePrefix("<!DOCTYPE html>"))
+				Expect(string(reportBytes)).To(ContainSubstring("<svg"))
+			})
+		})
+
+		It("uploads the run metadata without credentials", func() {
+			Eventually(process.Wait(), "5s").Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(0))
+
+			var runBytes []byte
+			Eventually(bodyChan).Should(Receive())
+			Eventually(bodyChan).Should(Receive())
+			Eventually(bodyChan).Should(Receive())
+			Eventually(bodyChan).Should(Receive(&runBytes))
+
+			var metadata map[string]interface{}
+			Expect(json.Unmarshal(runBytes, &metadata)).To(Succeed())
+			Expect(metadata["router"]).To(Equal(testServer.URL()))
+			Expect(metadata["host"]).To(Equal("example.com"))
+			Expect(metadata["generator"]).To(Equal("native"))
+			Expect(metadata["throughputramp_version"]).To(Equal("1.2.3"))
+			Expect(metadata["steps"]).To(HaveLen(2))
+			Expect(metadata["start_time"]).NotTo(BeEmpty())
+			Expect(metadata["end_time"]).NotTo(BeEmpty())
+			Expect(metadata["flags"]).To(HaveKeyWithValue("upper-concurrency", "4"))
+			Expect(metadata["flags"]).NotTo(HaveKey("access-key-id"))
+			Expect(metadata["flags"]).NotTo(HaveKey("secret-access-key"))
+			Expect(metadata["flags"]).NotTo(HaveKey("put-header"))
+		})
+
 		It("uploads the csv to the s3 bucket", func() {
 			Eventually(process.Wait(), "5s").Should(Receive())
 			Expect(runner.ExitCode()).To(Equal(0))
@@ -211,9 +765,13 @@ var _ = Describe("Throughputramp", func() {
 			Eventually(bodyChan).Should(Receive(&csvBytes))
 			Expect(csvBytes).ToNot(BeEmpty())
 			b := gbytes.BufferWithBytes(csvBytes)
-			Expect(b).To(gbytes.Say(`start-time,response-time\n`))
-			// Make sure the second csv header appears as well
-			Expect(b).To(gbytes.Say(`\nstart-time,response-time\n`))
+			header := "step,concurrency,rate-limit,rate,start-time,response-time,status-code,error,connection-reused,dns,connect,request-write,response-delay,response-read,schedule-delay,agent,protocol,tls-handshake,tls-resumed,host"
+			Expect(b).To(gbytes.Say(header + `\n`))
+			Expect(b).To(gbytes.Say(`1,2,100,0,[^,]+,[\d.]+,\d{3},,(true|false),[\d.]+,[\d.]+,[\d.]+,[\d.]+,[\d.]+,0.000000,,HTTP/1.1,0.000000,false,[^,]*\n`))
+			Expect(b).To(gbytes.Say(`2,4,100,0,[^,]+,[\d.]+,\d{3},`))
+			// The header is only written once
+			Expect(strings.Count(string(csvBytes), header)).To(Equal(1))
+			Expect(strings.Count(string(csvBytes), "\n")).To(Equal(25))
 		})
 	})
 
@@ -230,7 +788,167 @@ var _ = Describe("Throughputramp", func() {
 		})
 	})
 
+	Context("when an unknown generator is requested", func() {
+		BeforeEach(func() {
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath,
+				"-generator", "wrk",
+				"-s3-region", "us-east-1",
+				"-bucket-name", "blah-bucket",
+				"-access-key-id", "ABCD",
+				"-secret-access-key", "ABCD",
+				"http://example.com",
+			)
+		})
+
+		It("exits 1 with usage", func() {
+			process := ifrit.Background(runner)
+			Eventually(process.Wait()).Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say(`unknown generator "wrk"`))
+		})
+	})
+
+	Context("when the protocol does not match the router URL", func() {
+		BeforeEach(func() {
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath, "-protocol", "h2", "-stdout", "http://example.com")
+		})
+
+		It("exits 1 with usage", func() {
+			process := ifrit.Background(runner)
+			Eventually(process.Wait()).Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say("protocol h2 requires an https URL"))
+		})
+	})
+
+	Context("when a client certificate is given with agents reached over http", func() {
+		BeforeEach(func() {
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath, "-tls-cert", "client.pem", "-tls-key", "client.key", "-agents", "10.0.0.7:8090", "-stdout", "https://example.com")
+		})
+
+		It("exits 1 with usage", func() {
+			process := ifrit.Background(runner)
+			Eventually(process.Wait()).Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say("a client certificate can only be combined with agents reached over https"))
+		})
+	})
+
+	Context("when a maximum of requests per connection is given with HTTP/2", func() {
+		BeforeEach(func() {
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath, "-protocol", "h2c", "-max-requests-per-connection", "1", "-stdout", "http://example.com")
+		})
+
+		It("exits 1 with usage", func() {
+			process := ifrit.Background(runner)
+			Eventually(process.Wait()).Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say("a maximum of requests per connection is not supported with protocol h2c"))
+		})
+	})
+
+	Context("when both a host and routes are given", func() {
+		BeforeEach(func() {
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath, "-host", "example.com", "-app-name", "sample", "-app-domain", "apps.com", "-num-routes", "100", "-stdout", "http://example.com")
+		})
+
+		It("exits 1 with usage", func() {
+			process := ifrit.Background(runner)
+			Eventually(process.Wait()).Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say("a host cannot be combined with routes"))
+		})
+	})
+
+	Context("when the stream is unknown", func() {
+		BeforeEach(func() {
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath, "-stream", "grpc", "-duration", "1s", "-stdout", "http://example.com")
+		})
+
+		It("exits 1 with usage", func() {
+			process := ifrit.Background(runner)
+			Eventually(process.Wait()).Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say(`unknown stream "grpc"`))
+		})
+	})
+
+	Context("when the checkpoint does not match the ramp", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "checkpoint")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checkpoint.Write(dir, checkpoint.Checkpoint{
+				Run:     data.RunMetadata{Steps: []data.StepMetadata{{Requests: 10, Concurrency: 1}}},
+				Targets: []checkpoint.Target{{URL: "http://router"}},
+			})).To(Succeed())
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath, "-stdout", "-resume", dir, "http://router")
+			process = ifrit.Background(runner)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("exits 1 with usage", func() {
+			Eventually(process.Wait(), "5s").Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say("the steps of the ramp do not match the checkpoint"))
+		})
+	})
+
+	Context("when both a body and a body file are given", func() {
+		BeforeEach(func() {
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath, "-method", "POST", "-body", "{}", "-body-file", "body.json", "-stdout", "http://example.com")
+		})
+
+		It("exits 1 with usage", func() {
+			process := ifrit.Background(runner)
+			Eventually(process.Wait()).Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say("-body and -body-file cannot be combined"))
+		})
+	})
+
+	Context("when the TLS options are not valid", func() {
+		BeforeEach(func() {
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath, "-tls-min-version", "1.4", "-stdout", "https://example.com")
+		})
+
+		It("exits 1 with usage", func() {
+			process := ifrit.Background(runner)
+			Eventually(process.Wait()).Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say(`unknown TLS version "1.4"`))
+		})
+	})
+
 	Context("when the s3 config is not valid", func() {
+		BeforeEach(func() {
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath, "-bucket-name", "blah-bucket", "http://example.com")
+		})
+
+		It("exits 1 with usage", func() {
+			process := ifrit.Background(runner)
+			Eventually(process.Wait()).Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say("s3 config error"))
+		})
+	})
+
+	Context("when no result destination is given", func() {
 		BeforeEach(func() {
 			runner = NewThroughputRamp(binPath, Args{})
 			runner.Command = exec.Command(binPath, "http://example.com")
@@ -240,6 +958,21 @@ var _ = Describe("Throughputramp", func() {
 			process := ifrit.Background(runner)
 			Eventually(process.Wait()).Should(Receive())
 			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say("no result destination"))
+		})
+	})
+
+	Context("when two routers have the same name", func() {
+		BeforeEach(func() {
+			runner = NewThroughputRamp(binPath, Args{})
+			runner.Command = exec.Command(binPath, "-stdout", "a=http://example.com", "a=http://example.org")
+		})
+
+		It("exits 1 with usage", func() {
+			process := ifrit.Background(runner)
+			Eventually(process.Wait()).Should(Receive())
+			Expect(runner.ExitCode()).To(Equal(1))
+			Expect(runner.Err()).To(gbytes.Say(`duplicate target name "a"`))
 		})
 	})
 })
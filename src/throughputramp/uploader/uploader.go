@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
@@ -39,21 +40,7 @@ func (conf *Config) Validate() error {
 }
 
 func Upload(conf *Config, file io.Reader, fileName string) (string, error) {
-	s3Config := aws.NewConfig().
-		WithCredentials(credentials.NewStaticCredentials(conf.AccessKeyID, conf.SecretAccessKey, ""))
-
-	forcePathStyle := true
-	s3Config.S3ForcePathStyle = &forcePathStyle
-
-	if conf.AwsRegion == "" {
-		s3Config = s3Config.WithRegion(" ").WithEndpoint(conf.Endpoint)
-	} else {
-		s3Config = s3Config.WithRegion(conf.AwsRegion)
-	}
-
-	sess := session.New(s3Config)
-
-	uploader := s3manager.NewUploader(sess)
+	uploader := s3manager.NewUploader(newSession(conf))
 
 	upParams := &s3manager.UploadInput{
 		ACL:    aws.String("public-read"),
@@ -69,3 +56,35 @@ func Upload(conf *Config, file io.Reader, fileName string) (string, error) {
 
 	return result.Location, nil
 }
+
+// Download returns the contents of a file previously uploaded with Upload.
+func Download(conf *Config, fileName string) ([]byte, error) {
+	downloader := s3manager.NewDownloader(newSession(conf))
+
+	buf := aws.NewWriteAtBuffer(nil)
+	_, err := downloader.Download(buf, &s3.GetObjectInput{
+		Bucket: &conf.BucketName,
+		Key:    &fileName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download file %s, err: %s", fileName, err.Error())
+	}
+
+	return buf.Bytes(), nil
+}
+
+func newSession(conf *Config) *session.Session {
+	s3Config := aws.NewConfig().
+		WithCredentials(credentials.NewStaticCredentials(conf.AccessKeyID, conf.SecretAccessKey, ""))
+
+	forcePathStyle := true
+	s3Config.S3ForcePathStyle = &forcePathStyle
+
+	if conf.AwsRegion == "" {
+		s3Config = s3Config.WithRegion(" ").WithEndpoint(conf.Endpoint)
+	} else {
+		s3Config = s3Config.WithRegion(conf.AwsRegion)
+	}
+
+	return session.New(s3Config)
+}
@@ -140,4 +140,41 @@ var _ = Describe("Uploader", func() {
 			})
 		})
 	})
+
+	Describe("Download", func() {
+		var (
+			testS3Server *ghttp.Server
+			config       *uploader.Config
+		)
+
+		BeforeEach(func() {
+			testS3Server = ghttp.NewServer()
+			config = &uploader.Config{
+				BucketName:      "blah-bucket",
+				Endpoint:        testS3Server.URL(),
+				AccessKeyID:     "ABCD",
+				SecretAccessKey: "ABCD",
+			}
+		})
+
+		AfterEach(func() {
+			testS3Server.Close()
+		})
+
+		It("returns the contents of the file", func() {
+			testS3Server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/blah-bucket/testfile"),
+				ghttp.RespondWith(http.StatusOK, "test body"),
+			))
+			contents, err := uploader.Download(config, "testfile")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("test body"))
+		})
+
+		It("fails when the file does not exist", func() {
+			testS3Server.AppendHandlers(ghttp.RespondWith(http.StatusNotFound, ""))
+			_, err := uploader.Download(config, "testfile")
+			Expect(err).To(MatchError(ContainSubstring("testfile")))
+		})
+	})
 })